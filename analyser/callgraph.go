@@ -0,0 +1,522 @@
+package analyzer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"aml/lexer"
+	"aml/parser"
+	"aml/interpreter"
+)
+
+type CallNode struct {
+	Name string;
+	Decl lexer.Token; // zero for natives and the top level
+	Arity int;
+	Native bool;
+	Callees []*CallNode; // in the order of their first call
+	referenced bool; // used as a value, so it may be called from anywhere
+	index int; // declaration order, keeps the output stable
+}
+
+func (node *CallNode) id() string {
+	if node.Native {
+		return "native:" + node.Name;
+	}
+	if node.Decl.Line == 0 {
+		return node.Name;
+	}
+	return fmt.Sprintf("%s@%d:%d", node.Name, node.Decl.Line, node.Decl.Column);
+}
+
+func (node *CallNode) calls(callee *CallNode) bool {
+	for _, other := range node.Callees {
+		if other == callee {
+			return true;
+		}
+	}
+	return false;
+}
+
+// CallGraph links every function to the functions it calls by name.
+// a callee is statically known when it is a plain name bound to a function declaration
+// or a native that has not been reassigned, anything else (values passed around,
+// call results) is left out, the same way the interpreter only learns it at runtime.
+// on the way it reports calls with the wrong number of arguments.
+type CallGraph struct {
+	filename string;
+	Main *CallNode; // the top level code
+	Nodes []*CallNode; // declared functions and the natives they call
+	scopes []map[string]*CallNode; // name -> function, nil when the name holds something else
+	funcs []*CallNode;
+	errors []error;
+	warn bool;
+}
+
+func NewCallGraph(filename string) *CallGraph {
+	main := &CallNode{ Name: "<main>" };
+	globals := make(map[string]*CallNode);
+	for name, val := range interpreter.GetStdFuncs() {
+		fn, ok := val.(interpreter.Callable);
+		if !ok {
+			continue;
+		}
+		globals[name] = &CallNode{ Name: name, Arity: int(fn.Arity()), Native: true, index: -1 };
+	}
+	return &CallGraph{
+		filename: filename,
+		Main: main,
+		Nodes: make([]*CallNode, 0),
+		scopes: []map[string]*CallNode{ globals },
+		funcs: []*CallNode{ main },
+		errors: make([]error, 0),
+	};
+}
+
+// Warn makes calls with the wrong number of arguments warnings: the call may sit in code
+// that never runs, and the interpreter fails on it when it does
+func (cg *CallGraph) Warn() {
+	cg.warn = true;
+}
+
+func (cg *CallGraph) report(tok lexer.Token, format string, args ...any) {
+	kind := "SEMANTIC ERROR";
+	if cg.warn {
+		kind = "SEMANTIC WARNING";
+	}
+	cg.errors = append(cg.errors, &lexer.Diagnostic{ Kind: kind, Filename: cg.filename, Span: tok.Span(), Message: fmt.Sprintf(format, args...) });
+}
+
+func (cg *CallGraph) begin_scope() {
+	cg.scopes = append(cg.scopes, make(map[string]*CallNode));
+}
+
+func (cg *CallGraph) end_scope() {
+	cg.scopes = cg.scopes[:len(cg.scopes)-1];
+}
+
+func (cg *CallGraph) bind(name string, node *CallNode) {
+	cg.scopes[len(cg.scopes)-1][name] = node;
+}
+
+func (cg *CallGraph) lookup(name string) *CallNode {
+	for i := len(cg.scopes) - 1; i >= 0; i-- {
+		if node, ok := cg.scopes[i][name]; ok {
+			return node;
+		}
+	}
+	return nil;
+}
+
+// a reassigned name may hold anything afterwards
+func (cg *CallGraph) unbind(name string) {
+	for i := len(cg.scopes) - 1; i >= 0; i-- {
+		if _, ok := cg.scopes[i][name]; ok {
+			cg.scopes[i][name] = nil;
+			return;
+		}
+	}
+}
+
+func (cg *CallGraph) add_edge(callee *CallNode) {
+	caller := cg.funcs[len(cg.funcs)-1];
+	if !caller.calls(callee) {
+		caller.Callees = append(caller.Callees, callee);
+	}
+	if callee.Native && callee.index == -1 {
+		callee.index = len(cg.Nodes);
+		cg.Nodes = append(cg.Nodes, callee);
+	}
+}
+
+// names are bound in source order, as the interpreter declares them, so a call before
+// a declaration goes to whatever the name held until then. function bodies are visited
+// at the end of the block: they run once called, when the siblings declared after them exist
+func (cg *CallGraph) visit_stmts(stmts []parser.Stmt) {
+	decls := make([]parser.FuncDeclarationStmt, 0);
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+			case *parser.FuncDeclarationStmt: {
+				cg.bind(stmt.Name.Lexeme, cg.declare_func(*stmt));
+				decls = append(decls, *stmt);
+			}
+			case parser.ClassStmt: {
+				cg.bind(stmt.Name.Lexeme, nil);
+				decls = append(decls, cg.declare_methods(stmt.Name, stmt.Methods)...);
+			}
+			case parser.TraitStmt: {
+				cg.bind(stmt.Name.Lexeme, nil);
+				decls = append(decls, cg.declare_methods(stmt.Name, stmt.Defaults)...);
+			}
+			default: {
+				parser.AcceptStmt(stmt, cg);
+			}
+		}
+	}
+	for _, decl := range decls {
+		cg.visit_body(decl);
+	}
+}
+
+// methods are called through instances, which the graph does not follow:
+// they are functions of their own, used as soon as they are declared
+func (cg *CallGraph) declare_methods(owner lexer.Token, methods []parser.Func) []parser.FuncDeclarationStmt {
+	decls := make([]parser.FuncDeclarationStmt, len(methods));
+	for i, method := range methods {
+		decls[i] = parser.FuncDeclarationStmt(method);
+		node := cg.declare_func(decls[i]);
+		node.Name = owner.Lexeme + "." + method.Name.Lexeme;
+		node.referenced = true;
+	}
+	return decls;
+}
+
+func (cg *CallGraph) declare_func(decl parser.FuncDeclarationStmt) *CallNode {
+	for _, node := range cg.Nodes {
+		if !node.Native && node.Decl.Line == decl.Name.Line && node.Decl.Column == decl.Name.Column {
+			return node;
+		}
+	}
+	node := &CallNode{ Name: decl.Name.Lexeme, Decl: decl.Name, Arity: len(decl.Params), index: len(cg.Nodes) };
+	cg.Nodes = append(cg.Nodes, node);
+	return node;
+}
+
+func (cg *CallGraph) visit_expr(expr parser.Expr) {
+	if expr != nil {
+		parser.Accept(expr, cg);
+	}
+}
+
+// statements
+func (cg *CallGraph) VisitExpr(stmt parser.ExprStmt) (None, error) {
+	cg.visit_expr(stmt.InnerExpr);
+	return None{}, nil;
+}
+
+func (cg *CallGraph) VisitVariableDeclaration(stmt parser.VarDeclarationStmt) (None, error) {
+	cg.visit_expr(stmt.Asset);
+	cg.bind(stmt.Name.Lexeme, nil);
+	return None{}, nil;
+}
+
+func (cg *CallGraph) VisitVarUnpack(stmt parser.VarUnpackStmt) (None, error) {
+	cg.visit_expr(stmt.Asset);
+	for _, name := range stmt.Names {
+		cg.bind(name.Lexeme, nil);
+	}
+	return None{}, nil;
+}
+
+func (cg *CallGraph) visit_body(decl parser.FuncDeclarationStmt) {
+	cg.funcs = append(cg.funcs, cg.declare_func(decl));
+	cg.begin_scope();
+	for _, param := range decl.Params {
+		cg.bind(param.Lexeme, nil);
+	}
+	cg.visit_stmts(decl.Body);
+	cg.end_scope();
+	cg.funcs = cg.funcs[:len(cg.funcs)-1];
+}
+
+func (cg *CallGraph) VisitFuncDeclarationStmt(stmt parser.FuncDeclarationStmt) (None, error) {
+	cg.bind(stmt.Name.Lexeme, cg.declare_func(stmt));
+	cg.visit_body(stmt);
+	return None{}, nil;
+}
+
+func (cg *CallGraph) VisitClass(stmt parser.ClassStmt) (None, error) {
+	cg.bind(stmt.Name.Lexeme, nil);
+	for _, decl := range cg.declare_methods(stmt.Name, stmt.Methods) {
+		cg.visit_body(decl);
+	}
+	return None{}, nil;
+}
+
+func (cg *CallGraph) VisitTrait(stmt parser.TraitStmt) (None, error) {
+	cg.bind(stmt.Name.Lexeme, nil);
+	for _, decl := range cg.declare_methods(stmt.Name, stmt.Defaults) {
+		cg.visit_body(decl);
+	}
+	return None{}, nil;
+}
+
+func (cg *CallGraph) VisitReturn(stmt parser.ReturnStmt) (None, error) {
+	cg.visit_expr(stmt.Asset);
+	return None{}, nil;
+}
+
+func (cg *CallGraph) VisitBreak(parser.BreakStmt) (None, error) {
+	return None{}, nil;
+}
+
+func (cg *CallGraph) VisitContinue(parser.ContinueStmt) (None, error) {
+	return None{}, nil;
+}
+
+func (cg *CallGraph) VisitPrint(stmt parser.PrintStmt) (None, error) {
+	for _, asset := range stmt.Assets {
+		cg.visit_expr(asset);
+	}
+	return None{}, nil;
+}
+
+func (cg *CallGraph) VisitBlock(stmt parser.BlockStmt) (None, error) {
+	cg.begin_scope();
+	defer cg.end_scope();
+	cg.visit_stmts(stmt.Stmts);
+	return None{}, nil;
+}
+
+func (cg *CallGraph) VisitConditional(stmt parser.ConditionalStmt) (None, error) {
+	for _, branch := range stmt.Branches {
+		cg.visit_expr(branch.Condition);
+		parser.AcceptStmt(branch.NDStmt, cg);
+	}
+	return None{}, nil;
+}
+
+func (cg *CallGraph) VisitWhile(stmt parser.WhileStmt) (None, error) {
+	cg.visit_expr(stmt.Cond);
+	parser.AcceptStmt(stmt.NDStmt, cg);
+	return None{}, nil;
+}
+
+func (cg *CallGraph) VisitFor(stmt parser.ForStmt) (None, error) {
+	if stmt.Init != nil {
+		parser.AcceptStmt(stmt.Init, cg);
+	}
+	cg.visit_expr(stmt.Cond);
+	cg.visit_expr(stmt.Step);
+	parser.AcceptStmt(stmt.NDStmt, cg);
+	return None{}, nil;
+}
+
+// expressions
+func (cg *CallGraph) VisitFuncCall(expr parser.FuncCall) (None, error) {
+	for _, arg := range expr.Args {
+		cg.visit_expr(arg);
+	}
+	vari, ok := expr.Callee.(parser.VariableExpr);
+	if !ok {
+		cg.visit_expr(expr.Callee);
+		return None{}, nil;
+	}
+	callee := cg.lookup(vari.Name.Lexeme);
+	if callee == nil {
+		return None{}, nil;
+	}
+	if callee.Arity != len(expr.Args) {
+		cg.report(vari.Name, "'%s' expects %d arguments got %d", callee.Name, callee.Arity, len(expr.Args));
+	}
+	cg.add_edge(callee);
+	return None{}, nil;
+}
+
+func (cg *CallGraph) VisitVariable(expr parser.VariableExpr) (None, error) {
+	if node := cg.lookup(expr.Name.Lexeme); node != nil {
+		node.referenced = true;
+	}
+	return None{}, nil;
+}
+
+func (cg *CallGraph) VisitAssign(expr parser.AssignExpr) (None, error) {
+	cg.visit_expr(expr.Asset);
+	cg.unbind(expr.Name.Lexeme);
+	return None{}, nil;
+}
+
+func (cg *CallGraph) VisitLiteral(parser.LiteralExpr) (None, error) {
+	return None{}, nil;
+}
+
+func (cg *CallGraph) VisitUnary(expr parser.UnaryExpr) (None, error) {
+	cg.visit_expr(expr.Operand);
+	return None{}, nil;
+}
+
+func (cg *CallGraph) VisitBinary(expr parser.BinaryExpr) (None, error) {
+	cg.visit_expr(expr.LOperand);
+	cg.visit_expr(expr.ROperand);
+	return None{}, nil;
+}
+
+func (cg *CallGraph) VisitTernary(expr parser.TernaryExpr) (None, error) {
+	cg.visit_expr(expr.Cond);
+	cg.visit_expr(expr.Iftrue);
+	cg.visit_expr(expr.Iffalse);
+	return None{}, nil;
+}
+
+func (cg *CallGraph) VisitGroup(expr parser.GroupingExpr) (None, error) {
+	cg.visit_expr(expr.InnerExpr);
+	return None{}, nil;
+}
+
+func (cg *CallGraph) VisitCoalesce(expr parser.CoalesceExpr) (None, error) {
+	cg.visit_expr(expr.LOperand);
+	cg.visit_expr(expr.ROperand);
+	return None{}, nil;
+}
+
+func (cg *CallGraph) VisitOptionalChain(expr parser.OptionalChainExpr) (None, error) {
+	cg.visit_expr(expr.Chain);
+	return None{}, nil;
+}
+
+func (cg *CallGraph) VisitTuple(expr parser.TupleExpr) (None, error) {
+	for _, element := range expr.Elements {
+		cg.visit_expr(element);
+	}
+	return None{}, nil;
+}
+
+func (cg *CallGraph) VisitIndex(expr parser.IndexExpr) (None, error) {
+	cg.visit_expr(expr.Object);
+	cg.visit_expr(expr.Index);
+	return None{}, nil;
+}
+
+func (cg *CallGraph) VisitGet(expr parser.GetExpr) (None, error) {
+	cg.visit_expr(expr.Object);
+	return None{}, nil;
+}
+
+func (cg *CallGraph) VisitSet(expr parser.SetExpr) (None, error) {
+	cg.visit_expr(expr.Object);
+	cg.visit_expr(expr.Asset);
+	return None{}, nil;
+}
+
+func (cg *CallGraph) VisitThis(parser.ThisExpr) (None, error) {
+	return None{}, nil;
+}
+
+// builds the graph and returns the arity mismatches
+func (cg *CallGraph) Build(stmts []parser.Stmt) []error {
+	cg.visit_stmts(stmts);
+	return cg.errors;
+}
+
+// Recursive returns the groups of functions that call each other (directly or not),
+// a group of one is a function that calls itself.
+func (cg *CallGraph) Recursive() [][]*CallNode {
+	// tarjan's strongly connected components
+	var (
+		index = make(map[*CallNode]int)
+		low = make(map[*CallNode]int)
+		on_stack = make(map[*CallNode]bool)
+		stack = make([]*CallNode, 0)
+		groups = make([][]*CallNode, 0)
+		connect func(*CallNode)
+	);
+	connect = func(node *CallNode) {
+		index[node], low[node] = len(index), len(index);
+		stack = append(stack, node);
+		on_stack[node] = true;
+		for _, callee := range node.Callees {
+			if _, seen := index[callee]; !seen {
+				connect(callee);
+				low[node] = min(low[node], low[callee]);
+			} else if on_stack[callee] {
+				low[node] = min(low[node], index[callee]);
+			}
+		}
+		if low[node] != index[node] {
+			return;
+		}
+		group := make([]*CallNode, 0);
+		for {
+			top := stack[len(stack)-1];
+			stack = stack[:len(stack)-1];
+			on_stack[top] = false;
+			group = append(group, top);
+			if top == node {
+				break;
+			}
+		}
+		if len(group) > 1 || node.calls(node) {
+			sort.Slice(group, func(i, j int) bool { return group[i].index < group[j].index; });
+			groups = append(groups, group);
+		}
+	};
+	for _, node := range cg.Nodes {
+		if _, seen := index[node]; !seen {
+			connect(node);
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i][0].index < groups[j][0].index; });
+	return groups;
+}
+
+// Unused returns the declared functions that can never be called: they are not
+// reachable from the top level and never used as a value. recursion alone does not count.
+func (cg *CallGraph) Unused() []*CallNode {
+	reached := make(map[*CallNode]bool);
+	var reach func(*CallNode);
+	reach = func(node *CallNode) {
+		if reached[node] {
+			return;
+		}
+		reached[node] = true;
+		for _, callee := range node.Callees {
+			reach(callee);
+		}
+	};
+	reach(cg.Main);
+	for _, node := range cg.Nodes {
+		if node.referenced {
+			reach(node);
+		}
+	}
+	unused := make([]*CallNode, 0);
+	for _, node := range cg.Nodes {
+		if !node.Native && !reached[node] {
+			unused = append(unused, node);
+		}
+	}
+	return unused;
+}
+
+// DOT renders the graph for graphviz, recursive functions are red and unused ones dotted
+func (cg *CallGraph) DOT() string {
+	var sb strings.Builder;
+	sb.WriteString("digraph callgraph {\n");
+	recursive := make(map[*CallNode]bool);
+	for _, group := range cg.Recursive() {
+		names := make([]string, len(group));
+		for i, node := range group {
+			recursive[node] = true;
+			names[i] = node.Name;
+		}
+		fmt.Fprintf(&sb, "\t// recursive: %s\n", strings.Join(names, ", "));
+	}
+	unused := make(map[*CallNode]bool);
+	for _, node := range cg.Unused() {
+		unused[node] = true;
+		fmt.Fprintf(&sb, "\t// never called: %s\n", node.Name);
+	}
+	sb.WriteString("\tnode [shape=box];\n");
+	fmt.Fprintf(&sb, "\t%q [shape=doubleoctagon];\n", cg.Main.id());
+	for _, node := range cg.Nodes {
+		attrs := []string{ fmt.Sprintf("label=%q", fmt.Sprintf("%s/%d", node.Name, node.Arity)) };
+		if node.Native {
+			attrs = append(attrs, "shape=ellipse");
+		}
+		if recursive[node] {
+			attrs = append(attrs, "color=red");
+		}
+		if unused[node] {
+			attrs = append(attrs, "style=dotted");
+		}
+		fmt.Fprintf(&sb, "\t%q [%s];\n", node.id(), strings.Join(attrs, ", "));
+	}
+	for _, caller := range append([]*CallNode{ cg.Main }, cg.Nodes...) {
+		for _, callee := range caller.Callees {
+			fmt.Fprintf(&sb, "\t%q -> %q;\n", caller.id(), callee.id());
+		}
+	}
+	sb.WriteString("}\n");
+	return sb.String();
+}
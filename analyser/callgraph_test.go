@@ -0,0 +1,131 @@
+package analyzer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"aml/lexer"
+	"aml/parser"
+)
+
+func parse(t *testing.T, source string) []parser.Stmt {
+	t.Helper();
+	stmts, errs := parser.NewStreamParser("test.aml", lexer.NewScanner("test.aml", source)).Parse();
+	if len(errs) != 0 {
+		t.Fatalf("parsing %q: %v", source, errs[0]);
+	}
+	return stmts;
+}
+
+// the messages of diagnostics, in order
+func messages(errs []error) []string {
+	msgs := make([]string, len(errs));
+	for i, err := range errs {
+		var diag *lexer.Diagnostic;
+		if errors.As(err, &diag) {
+			msgs[i] = diag.Message;
+		} else {
+			msgs[i] = err.Error();
+		}
+	}
+	return msgs;
+}
+
+func TestCallGraphArity(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+		want []string;
+	}{
+		{ "matching", "func f(a, b) { return a + b; } print f(1, 2);", nil },
+		{ "too many", "func f() {} f(1);", []string{ "'f' expects 0 arguments got 1" } },
+		{ "too few", "func f(a, b) {} f(1);", []string{ "'f' expects 2 arguments got 1" } },
+		{ "native", "time(1);", []string{ "'time' expects 0 arguments got 1" } },
+		{ "inside a body", "func f(a) {} func g() { f(); }", []string{ "'f' expects 1 arguments got 0" } },
+		{ "later sibling", "func g() { f(); } func f(a) {}", []string{ "'f' expects 1 arguments got 0" } },
+		{ "reassigned", "func f() {} f = time; f(1);", nil },
+		{ "variable", "var f = 1; f(1);", nil },
+		{ "parameter", "func f() {} func g(f) { f(1); }", nil },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := messages(NewCallGraph("test.aml").Build(parse(t, test.source)));
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("got %q, want %q", got, test.want);
+			}
+		});
+	}
+}
+
+func TestCallGraphWarn(t *testing.T) {
+	for _, warn := range []bool{ false, true } {
+		cg := NewCallGraph("test.aml");
+		want := "SEMANTIC ERROR";
+		if warn {
+			cg.Warn();
+			want = "SEMANTIC WARNING";
+		}
+		errs := cg.Build(parse(t, "func f() {} f(1);"));
+		var diag *lexer.Diagnostic;
+		if len(errs) != 1 || !errors.As(errs[0], &diag) || diag.Kind != want {
+			t.Errorf("warn %v: got %v, want one %s", warn, errs, want);
+		}
+	}
+}
+
+// a block-local function only shadows the outer one from its declaration on
+func TestCallGraphShadowing(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+		want []string;
+	}{
+		{ "call before the declaration", "func g(a) { return a; } { print g(1); func g() { return 0; } print g(); }", nil },
+		{ "call after the declaration", "func g(a) { return a; } { func g() { return 0; } print g(1); }", []string{ "'g' expects 0 arguments got 1" } },
+		{ "outside the block", "func g(a) { return a; } { func g() { return 0; } } print g(1);", nil },
+		{ "shadowed by a variable", "func g(a) {} { var g = 1; g(); }", nil },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := messages(NewCallGraph("test.aml").Build(parse(t, test.source)));
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("got %q, want %q", got, test.want);
+			}
+		});
+	}
+}
+
+func TestCallGraphRecursive(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+		want []string; // one group per entry, names joined by spaces
+	}{
+		{ "none", "func f() {} func g() { f(); } g();", nil },
+		{ "self", "func fib(n) { return n < 2 ? n : fib(n - 1) + fib(n - 2); }", []string{ "fib" } },
+		{ "mutual", "func even(n) { return n == 0 ? true : odd(n - 1); } func odd(n) { return n == 0 ? false : even(n - 1); }", []string{ "even odd" } },
+		{ "cycle of three", "func a() { b(); } func b() { c(); } func c() { a(); } func d() { a(); }", []string{ "a b c" } },
+		{ "separate groups", "func f() { f(); } func g() { h(); } func h() { g(); }", []string{ "f", "g h" } },
+		{ "shadowed callee", "func f() { { func f() {} f(); } }", nil },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cg := NewCallGraph("test.aml");
+			if errs := cg.Build(parse(t, test.source)); len(errs) != 0 {
+				t.Fatalf("unexpected errors %q", messages(errs));
+			}
+			got := make([]string, 0);
+			for _, group := range cg.Recursive() {
+				names := make([]string, len(group));
+				for i, node := range group {
+					names[i] = node.Name;
+				}
+				got = append(got, strings.Join(names, " "));
+			}
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("got %q, want %q", got, test.want);
+			}
+		});
+	}
+}
@@ -0,0 +1,664 @@
+package analyzer
+
+import (
+	"fmt"
+	"strings"
+
+	"aml/lexer"
+	"aml/parser"
+)
+
+// static types, unannotated code is typed as any so it keeps
+// working exactly as before (gradual typing)
+type Type interface {
+	String() string;
+}
+
+type BasicType string;
+
+const (
+	AnyType BasicType = "any"
+	NumberType BasicType = "number"
+	StringType BasicType = "string"
+	BoolType BasicType = "bool"
+	NullType BasicType = "null"
+);
+
+type UnionType []Type;
+
+type FuncType struct {
+	Params []Type;
+	Return Type;
+};
+
+type TupleType []Type;
+
+func (typ BasicType) String() string {
+	return string(typ);
+}
+
+func (typ UnionType) String() string {
+	strs := make([]string, len(typ));
+	for i, option := range typ {
+		strs[i] = option.String();
+	}
+	return strings.Join(strs, " | ");
+}
+
+func (typ FuncType) String() string {
+	strs := make([]string, len(typ.Params));
+	for i, param := range typ.Params {
+		strs[i] = param.String();
+	}
+	return fmt.Sprintf("func(%s): %s", strings.Join(strs, ", "), typ.Return.String());
+}
+
+func (typ TupleType) String() string {
+	strs := make([]string, len(typ));
+	for i, element := range typ {
+		strs[i] = element.String();
+	}
+	return "(" + strings.Join(strs, ", ") + ")";
+}
+
+// flattens nested unions and drops duplicates, any absorbs everything
+func union(types ...Type) Type {
+	options := make(UnionType, 0, len(types));
+	var add func(typ Type);
+	add = func(typ Type) {
+		if nested, ok := typ.(UnionType); ok {
+			for _, option := range nested {
+				add(option);
+			}
+			return;
+		}
+		for _, option := range options {
+			if option.String() == typ.String() {
+				return;
+			}
+		}
+		options = append(options, typ);
+	};
+	for _, typ := range types {
+		if typ == AnyType {
+			return AnyType;
+		}
+		add(typ);
+	}
+	if len(options) == 1 {
+		return options[0];
+	}
+	return options;
+}
+
+func without_null(typ Type) Type {
+	if typ == NullType {
+		return AnyType;
+	}
+	if options, ok := typ.(UnionType); ok {
+		rest := make([]Type, 0, len(options));
+		for _, option := range options {
+			if option != NullType {
+				rest = append(rest, option);
+			}
+		}
+		return union(rest...);
+	}
+	return typ;
+}
+
+// reports whether a value of typ could be of the basic type b at runtime
+func may_be(typ Type, b BasicType) bool {
+	if typ == AnyType || typ == b {
+		return true;
+	}
+	if options, ok := typ.(UnionType); ok {
+		for _, option := range options {
+			if may_be(option, b) {
+				return true;
+			}
+		}
+	}
+	return false;
+}
+
+func assignable(src Type, dst Type) bool {
+	if src == AnyType || dst == AnyType {
+		return true;
+	}
+	if options, ok := src.(UnionType); ok {
+		for _, option := range options {
+			if !assignable(option, dst) {
+				return false;
+			}
+		}
+		return true;
+	}
+	if options, ok := dst.(UnionType); ok {
+		for _, option := range options {
+			if assignable(src, option) {
+				return true;
+			}
+		}
+		return false;
+	}
+	switch dst := dst.(type) {
+		case FuncType: {
+			src, ok := src.(FuncType);
+			if !ok || len(src.Params) != len(dst.Params) {
+				return false;
+			}
+			for i := range dst.Params {
+				if !assignable(dst.Params[i], src.Params[i]) {
+					return false;
+				}
+			}
+			return assignable(src.Return, dst.Return);
+		}
+		case TupleType: {
+			src, ok := src.(TupleType);
+			if !ok || len(src) != len(dst) {
+				return false;
+			}
+			for i := range dst {
+				if !assignable(src[i], dst[i]) {
+					return false;
+				}
+			}
+			return true;
+		}
+	}
+	return src == dst;
+}
+
+func std_types() map[string]Type {
+	return map[string]Type{
+		"read": FuncType{ Params: []Type{}, Return: TupleType{ StringType, BoolType } },
+		"time": FuncType{ Params: []Type{}, Return: NumberType },
+		"implements": FuncType{ Params: []Type{ AnyType, AnyType }, Return: BoolType },
+	};
+}
+
+type checker_func struct {
+	name string;
+	ret Type;
+}
+
+// Checker reports type mismatches before anything is executed,
+// it never stops at the first error
+type Checker struct {
+	filename string;
+	scopes []map[string]Type;
+	funcs []checker_func;
+	errors []error;
+}
+
+func NewChecker(filename string) *Checker {
+	return &Checker{
+		filename: filename,
+		scopes: []map[string]Type{ std_types() },
+		funcs: make([]checker_func, 0),
+		errors: make([]error, 0),
+	};
+}
+
+func (ch *Checker) report(tok lexer.Token, format string, args ...any) {
+	ch.errors = append(ch.errors, &lexer.Diagnostic{ Kind: "TYPE ERROR", Filename: ch.filename, Span: tok.Span(), Message: fmt.Sprintf(format, args...) });
+}
+
+func (ch *Checker) push() {
+	ch.scopes = append(ch.scopes, make(map[string]Type));
+}
+
+func (ch *Checker) pop() {
+	ch.scopes = ch.scopes[:len(ch.scopes)-1];
+}
+
+func (ch *Checker) declare(name string, typ Type) {
+	ch.scopes[len(ch.scopes)-1][name] = typ;
+}
+
+func (ch *Checker) lookup(name string) Type {
+	for i := len(ch.scopes) - 1; i >= 0; i-- {
+		if typ, ok := ch.scopes[i][name]; ok {
+			return typ;
+		}
+	}
+	return AnyType;
+}
+
+func (ch *Checker) type_of(expr parser.Expr) Type {
+	typ, _ := parser.Accept(expr, ch);
+	if typ == nil {
+		return AnyType;
+	}
+	return typ;
+}
+
+// converts an annotation into a Type, missing annotations are any
+func (ch *Checker) from_annotation(annotation parser.TypeExpr) Type {
+	switch annotation := annotation.(type) {
+		case nil: {
+			return AnyType;
+		}
+		case parser.NamedType: {
+			switch annotation.Name.Lexeme {
+				case "any": return AnyType;
+				case "number": return NumberType;
+				case "string": return StringType;
+				case "bool": return BoolType;
+				case "null": return NullType;
+			}
+			ch.report(annotation.Name, "unknown type '%s'", annotation.Name.Lexeme);
+			return AnyType;
+		}
+		case parser.UnionType: {
+			options := make([]Type, len(annotation.Options));
+			for i, option := range annotation.Options {
+				options[i] = ch.from_annotation(option);
+			}
+			return union(options...);
+		}
+		case parser.FuncType: {
+			params := make([]Type, len(annotation.Params));
+			for i, param := range annotation.Params {
+				params[i] = ch.from_annotation(param);
+			}
+			return FuncType{ Params: params, Return: ch.from_annotation(annotation.Return) };
+		}
+		case parser.TupleType: {
+			elements := make(TupleType, len(annotation.Elements));
+			for i, element := range annotation.Elements {
+				elements[i] = ch.from_annotation(element);
+			}
+			return elements;
+		}
+	}
+	return AnyType;
+}
+
+func (ch *Checker) func_type(fn parser.Func) FuncType {
+	params := make([]Type, len(fn.Params));
+	for i := range fn.Params {
+		var annotation parser.TypeExpr = nil;
+		if i < len(fn.ParamTypes) {
+			annotation = fn.ParamTypes[i];
+		}
+		params[i] = ch.from_annotation(annotation);
+	}
+	return FuncType{ Params: params, Return: ch.from_annotation(fn.ReturnType) };
+}
+
+func (ch *Checker) expect_number(typ Type, operator lexer.Token) {
+	if !may_be(typ, NumberType) {
+		ch.report(operator, "operator '%s' expects number operands, got %s", operator.Lexeme, typ);
+	}
+}
+
+// expressions
+func (ch *Checker) VisitTernary(expr parser.TernaryExpr) (Type, error) {
+	ch.type_of(expr.Cond);
+	return union(ch.type_of(expr.Iftrue), ch.type_of(expr.Iffalse)), nil;
+}
+
+func (ch *Checker) VisitBinary(expr parser.BinaryExpr) (Type, error) {
+	lt, rt := ch.type_of(expr.LOperand), ch.type_of(expr.ROperand);
+	switch expr.Operator.Type {
+		case lexer.MINUS, lexer.STAR, lexer.SLASH: {
+			ch.expect_number(lt, expr.Operator);
+			ch.expect_number(rt, expr.Operator);
+			return NumberType, nil;
+		}
+		case lexer.GREATER, lexer.GREATER_EQUAL, lexer.LESS, lexer.LESS_EQUAL: {
+			ch.expect_number(lt, expr.Operator);
+			ch.expect_number(rt, expr.Operator);
+			return BoolType, nil;
+		}
+		case lexer.PLUS: {
+			for _, typ := range []Type{ lt, rt } {
+				if !may_be(typ, NumberType) && !may_be(typ, StringType) {
+					ch.report(expr.Operator, "operator '+' expects number or string operands, got %s", typ);
+					return AnyType, nil;
+				}
+			}
+			lbasic, lok := lt.(BasicType);
+			rbasic, rok := rt.(BasicType);
+			if !lok || !rok || lbasic == AnyType || rbasic == AnyType {
+				return AnyType, nil;
+			}
+			if lbasic != rbasic {
+				ch.report(expr.Operator, "operator '+' cannot mix %s and %s", lt, rt);
+				return AnyType, nil;
+			}
+			return lbasic, nil;
+		}
+	}
+	return BoolType, nil;
+}
+
+func (ch *Checker) VisitUnary(expr parser.UnaryExpr) (Type, error) {
+	typ := ch.type_of(expr.Operand);
+	if expr.Operator.Type == lexer.MINUS {
+		ch.expect_number(typ, expr.Operator);
+		return NumberType, nil;
+	}
+	return BoolType, nil;
+}
+
+func (ch *Checker) VisitLiteral(expr parser.LiteralExpr) (Type, error) {
+	switch expr.ValueLiteral.(type) {
+		case float64: return NumberType, nil;
+		case string: return StringType, nil;
+		case bool: return BoolType, nil;
+		case nil: return NullType, nil;
+	}
+	return AnyType, nil;
+}
+
+func (ch *Checker) VisitVariable(expr parser.VariableExpr) (Type, error) {
+	return ch.lookup(expr.Name.Lexeme), nil;
+}
+
+func (ch *Checker) VisitGroup(expr parser.GroupingExpr) (Type, error) {
+	return ch.type_of(expr.InnerExpr), nil;
+}
+
+func (ch *Checker) VisitAssign(expr parser.AssignExpr) (Type, error) {
+	typ := ch.type_of(expr.Asset);
+	declared := ch.lookup(expr.Name.Lexeme);
+	if !assignable(typ, declared) {
+		ch.report(expr.Name, "cannot assign %s to variable %s of type %s", typ, expr.Name.Lexeme, declared);
+	}
+	return typ, nil;
+}
+
+func (ch *Checker) VisitFuncCall(expr parser.FuncCall) (Type, error) {
+	callee := ch.type_of(expr.Callee);
+	args := make([]Type, len(expr.Args));
+	for i, arg := range expr.Args {
+		args[i] = ch.type_of(arg);
+	}
+	if expr.Optional {
+		callee = without_null(callee);
+	}
+	var ret Type = AnyType;
+	switch fn := callee.(type) {
+		case FuncType: {
+			name := "function";
+			if vari, ok := expr.Callee.(parser.VariableExpr); ok {
+				name = vari.Name.Lexeme;
+			}
+			// arity is left to the runtime, only the types are checked here
+			for i := 0; i < len(args) && i < len(fn.Params); i++ {
+				if !assignable(args[i], fn.Params[i]) {
+					ch.report(expr.Paren, "argument %d of %s must be %s, got %s", i + 1, name, fn.Params[i], args[i]);
+				}
+			}
+			ret = fn.Return;
+			break;
+		}
+		case BasicType, TupleType: {
+			if callee != AnyType {
+				ch.report(expr.Paren, "cannot call value of type %s", callee);
+			}
+			break;
+		}
+	}
+	if expr.Optional {
+		return union(ret, NullType), nil;
+	}
+	return ret, nil;
+}
+
+func (ch *Checker) VisitCoalesce(expr parser.CoalesceExpr) (Type, error) {
+	lt := ch.type_of(expr.LOperand);
+	return union(without_null(lt), ch.type_of(expr.ROperand)), nil;
+}
+
+func (ch *Checker) VisitOptionalChain(expr parser.OptionalChainExpr) (Type, error) {
+	return union(ch.type_of(expr.Chain), NullType), nil;
+}
+
+func (ch *Checker) VisitTuple(expr parser.TupleExpr) (Type, error) {
+	elements := make(TupleType, len(expr.Elements));
+	for i, element := range expr.Elements {
+		elements[i] = ch.type_of(element);
+	}
+	return elements, nil;
+}
+
+func (ch *Checker) VisitIndex(expr parser.IndexExpr) (Type, error) {
+	object := ch.type_of(expr.Object);
+	index := ch.type_of(expr.Index);
+	ch.expect_number(index, expr.Bracket);
+	if expr.Optional {
+		object = without_null(object);
+	}
+	var typ Type = AnyType;
+	switch object := object.(type) {
+		case TupleType: {
+			lit, ok := expr.Index.(parser.LiteralExpr);
+			if !ok {
+				typ = union(object...);
+				break;
+			}
+			if num, ok := lit.ValueLiteral.(float64); ok {
+				if num < 0 || int(num) >= len(object) {
+					ch.report(expr.Bracket, "tuple index %v out of range for %s", num, object);
+				} else {
+					typ = object[int(num)];
+				}
+			}
+			break;
+		}
+		case BasicType, FuncType: {
+			if object != AnyType {
+				ch.report(expr.Bracket, "only tuples can be indexed, got %s", object);
+			}
+			break;
+		}
+	}
+	if expr.Optional {
+		return union(typ, NullType), nil;
+	}
+	return typ, nil;
+}
+
+// only instances have properties, and they are not typed
+func (ch *Checker) property_of(object Type, name lexer.Token, optional bool) {
+	if optional {
+		object = without_null(object);
+	}
+	if _, ok := object.(UnionType); !ok && object != AnyType {
+		ch.report(name, "only instances have properties, got %s", object);
+	}
+}
+
+func (ch *Checker) VisitGet(expr parser.GetExpr) (Type, error) {
+	ch.property_of(ch.type_of(expr.Object), expr.Name, expr.Optional);
+	return AnyType, nil;
+}
+
+func (ch *Checker) VisitSet(expr parser.SetExpr) (Type, error) {
+	ch.property_of(ch.type_of(expr.Object), expr.Name, false);
+	typ := ch.type_of(expr.Asset);
+	// '??=' may keep the value the property had
+	if expr.Operator.Type == lexer.QUESTION_QUESTION_EQUAL {
+		return AnyType, nil;
+	}
+	return typ, nil;
+}
+
+func (ch *Checker) VisitThis(parser.ThisExpr) (Type, error) {
+	return AnyType, nil;
+}
+
+// statements
+func (ch *Checker) VisitExpr(stmt parser.ExprStmt) (None, error) {
+	ch.type_of(stmt.InnerExpr);
+	return None{}, nil;
+}
+
+func (ch *Checker) VisitVariableDeclaration(stmt parser.VarDeclarationStmt) (None, error) {
+	declared := ch.from_annotation(stmt.Type);
+	if stmt.Asset != nil {
+		typ := ch.type_of(stmt.Asset);
+		if !assignable(typ, declared) {
+			ch.report(stmt.Name, "cannot initialize variable %s of type %s with %s", stmt.Name.Lexeme, declared, typ);
+		}
+	} else if !assignable(NullType, declared) {
+		ch.report(stmt.Name, "variable %s of type %s must be initialized", stmt.Name.Lexeme, declared);
+	}
+	ch.declare(stmt.Name.Lexeme, declared);
+	return None{}, nil;
+}
+
+func (ch *Checker) VisitVarUnpack(stmt parser.VarUnpackStmt) (None, error) {
+	typ := ch.type_of(stmt.Asset);
+	tup, is_tuple := typ.(TupleType);
+	if !is_tuple && typ != AnyType {
+		ch.report(stmt.Names[0], "cannot unpack %s into %d variables", typ, len(stmt.Names));
+	} else if is_tuple && len(tup) != len(stmt.Names) {
+		ch.report(stmt.Names[0], "cannot unpack %s into %d variables", typ, len(stmt.Names));
+		is_tuple = false;
+	}
+	for i, name := range stmt.Names {
+		var annotation parser.TypeExpr = nil;
+		if i < len(stmt.Types) {
+			annotation = stmt.Types[i];
+		}
+		declared := ch.from_annotation(annotation);
+		if is_tuple && !assignable(tup[i], declared) {
+			ch.report(name, "cannot initialize variable %s of type %s with %s", name.Lexeme, declared, tup[i]);
+		}
+		ch.declare(name.Lexeme, declared);
+	}
+	return None{}, nil;
+}
+
+func (ch *Checker) VisitFuncDeclarationStmt(stmt parser.FuncDeclarationStmt) (None, error) {
+	typ := ch.func_type(parser.Func(stmt));
+	ch.declare(stmt.Name.Lexeme, typ);
+	ch.check_body(parser.Func(stmt), typ);
+	return None{}, nil;
+}
+
+func (ch *Checker) check_body(fn parser.Func, typ FuncType) {
+	ch.push();
+	defer ch.pop();
+	for i, param := range fn.Params {
+		ch.declare(param.Lexeme, typ.Params[i]);
+	}
+	ch.funcs = append(ch.funcs, checker_func{ name: fn.Name.Lexeme, ret: typ.Return });
+	defer func() { ch.funcs = ch.funcs[:len(ch.funcs)-1]; }();
+	for _, body := range fn.Body {
+		parser.AcceptStmt(body, ch);
+	}
+	if !assignable(NullType, typ.Return) && falls_off(fn) {
+		ch.report(fn.Name, "function %s must return %s on every path", fn.Name.Lexeme, typ.Return);
+	}
+}
+
+// instances are not typed, classes and traits are any
+func (ch *Checker) check_methods(methods []parser.Func) {
+	ch.push();
+	defer ch.pop();
+	ch.declare("this", AnyType);
+	for _, method := range methods {
+		ch.check_body(method, ch.func_type(method));
+	}
+}
+
+func (ch *Checker) VisitClass(stmt parser.ClassStmt) (None, error) {
+	ch.declare(stmt.Name.Lexeme, AnyType);
+	ch.check_methods(stmt.Methods);
+	return None{}, nil;
+}
+
+func (ch *Checker) VisitTrait(stmt parser.TraitStmt) (None, error) {
+	ch.declare(stmt.Name.Lexeme, AnyType);
+	for _, sig := range stmt.Required {
+		for _, annotation := range append(sig.ParamTypes, sig.ReturnType) {
+			ch.from_annotation(annotation);
+		}
+	}
+	ch.check_methods(stmt.Defaults);
+	return None{}, nil;
+}
+
+func (ch *Checker) VisitReturn(stmt parser.ReturnStmt) (None, error) {
+	var typ Type = NullType;
+	if stmt.Asset != nil {
+		typ = ch.type_of(stmt.Asset);
+	}
+	if len(ch.funcs) == 0 {
+		return None{}, nil;
+	}
+	fn := ch.funcs[len(ch.funcs)-1];
+	if !assignable(typ, fn.ret) {
+		ch.report(stmt.Keyword, "function %s must return %s, got %s", fn.name, fn.ret, typ);
+	}
+	return None{}, nil;
+}
+
+func (ch *Checker) VisitBreak(parser.BreakStmt) (None, error) {
+	return None{}, nil;
+}
+
+func (ch *Checker) VisitContinue(parser.ContinueStmt) (None, error) {
+	return None{}, nil;
+}
+
+func (ch *Checker) VisitPrint(stmt parser.PrintStmt) (None, error) {
+	for _, asset := range stmt.Assets {
+		ch.type_of(asset);
+	}
+	return None{}, nil;
+}
+
+func (ch *Checker) VisitBlock(stmt parser.BlockStmt) (None, error) {
+	ch.push();
+	defer ch.pop();
+	for _, inner := range stmt.Stmts {
+		parser.AcceptStmt(inner, ch);
+	}
+	return None{}, nil;
+}
+
+func (ch *Checker) VisitConditional(stmt parser.ConditionalStmt) (None, error) {
+	for _, branch := range stmt.Branches {
+		if branch.Condition != nil {
+			ch.type_of(branch.Condition);
+		}
+		parser.AcceptStmt(branch.NDStmt, ch);
+	}
+	return None{}, nil;
+}
+
+func (ch *Checker) VisitWhile(stmt parser.WhileStmt) (None, error) {
+	ch.type_of(stmt.Cond);
+	parser.AcceptStmt(stmt.NDStmt, ch);
+	return None{}, nil;
+}
+
+func (ch *Checker) VisitFor(stmt parser.ForStmt) (None, error) {
+	// the interpreter declares the init statement in the enclosing scope
+	if stmt.Init != nil {
+		parser.AcceptStmt(stmt.Init, ch);
+	}
+	if stmt.Cond != nil {
+		ch.type_of(stmt.Cond);
+	}
+	if stmt.Step != nil {
+		ch.type_of(stmt.Step);
+	}
+	parser.AcceptStmt(stmt.NDStmt, ch);
+	return None{}, nil;
+}
+
+func (ch *Checker) Check(stmts []parser.Stmt) []error {
+	for _, stmt := range stmts {
+		parser.AcceptStmt(stmt, ch);
+	}
+	return ch.errors;
+}
@@ -0,0 +1,32 @@
+package analyzer
+
+import (
+	"strings"
+	"testing"
+)
+
+// a function annotated with a type that excludes null has to return on every path
+func TestCheckerReturnPaths(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+		want []string;
+	}{
+		{ "missing else", "func f(x: number): number { if (x > 0) return 1; }", []string{ "function f must return number on every path" } },
+		{ "every path", "func f(x: number): number { if (x > 0) return 1; else return 2; }", nil },
+		{ "return after the branch", "func f(x: number): number { if (x > 0) return 1; return 2; }", nil },
+		{ "empty body", "func f(): string {}", []string{ "function f must return string on every path" } },
+		{ "nullable", "func f(x: number): number | null { if (x > 0) return 1; }", nil },
+		{ "not annotated", "func f(x) { if (x > 0) return 1; }", nil },
+		{ "method", "class C { f(x: number): number { if (x > 0) return 1; } }", []string{ "function f must return number on every path" } },
+		{ "inner function", "func f(): number { func g(): number {} return 1; }", []string{ "function g must return number on every path" } },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := messages(NewChecker("test.aml").Check(parse(t, test.source)));
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("got %q, want %q", got, test.want);
+			}
+		});
+	}
+}
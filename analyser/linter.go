@@ -0,0 +1,571 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"aml/lexer"
+	"aml/parser"
+)
+
+// every lint rule has an id, used in configs and in `// aml:ignore rule-id`
+const (
+	RuleUnusedVariable = "unused-variable"
+	RuleUnusedParameter = "unused-parameter"
+	RuleShadowedName = "shadowed-name"
+	RuleUnreachableCode = "unreachable-code"
+	RuleConstantCondition = "constant-condition"
+	RuleSelfAssignment = "self-assignment"
+	RuleNullOrdering = "null-ordering"
+);
+
+var LintRules = []string{
+	RuleUnusedVariable,
+	RuleUnusedParameter,
+	RuleShadowedName,
+	RuleUnreachableCode,
+	RuleConstantCondition,
+	RuleSelfAssignment,
+	RuleNullOrdering,
+};
+
+type LintDiagnostic struct {
+	Rule string `json:"rule"`;
+	File string `json:"file"`;
+	Line uint `json:"line"`;
+	Column uint `json:"column"`;
+	Message string `json:"message"`;
+}
+
+func (diag LintDiagnostic) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s (%s)", diag.File, diag.Line, diag.Column, diag.Message, diag.Rule);
+}
+
+// rules are enabled unless the config turns them off:
+// { "rules": { "shadowed-name": false } }
+type LintConfig struct {
+	Rules map[string]bool `json:"rules"`;
+}
+
+func LoadLintConfig(path string) (LintConfig, error) {
+	config := LintConfig{};
+	bytes, err := os.ReadFile(path);
+	if err != nil {
+		return config, err;
+	}
+	if err := json.Unmarshal(bytes, &config); err != nil {
+		return config, fmt.Errorf("%s: %s", path, err.Error());
+	}
+	for rule := range config.Rules {
+		known := false;
+		for _, id := range LintRules {
+			known = known || id == rule;
+		}
+		if !known {
+			return config, fmt.Errorf("%s: unknown lint rule '%s'", path, rule);
+		}
+	}
+	return config, nil;
+}
+
+func (config LintConfig) enabled(rule string) bool {
+	if enabled, ok := config.Rules[rule]; ok {
+		return enabled;
+	}
+	return true;
+}
+
+type lint_symbol struct {
+	name lexer.Token;
+	rule string; // reported when unused, empty if it is never reported
+	used bool;
+}
+
+// Linter reports suspicious but valid code, it never stops the program from running
+type Linter struct {
+	filename string;
+	config LintConfig;
+	ignored map[uint][]string; // line -> suppressed rule ids, empty means every rule
+	scopes []map[string]*lint_symbol;
+	diagnostics []LintDiagnostic;
+}
+
+func NewLinter(filename string, source string, config LintConfig) *Linter {
+	return &Linter{
+		filename: filename,
+		config: config,
+		ignored: parse_suppressions(filename, source),
+		scopes: []map[string]*lint_symbol{ make(map[string]*lint_symbol) },
+		diagnostics: make([]LintDiagnostic, 0),
+	};
+}
+
+// `// aml:ignore rule-id...` or `/* aml:ignore rule-id... */` applies to its own line,
+// or to the next one when the comment is alone on its line.
+// comments are taken from the scanner's trivia, text inside strings never looks like one
+func parse_suppressions(filename string, source string) map[uint][]string {
+	ignored := make(map[uint][]string);
+	s := lexer.NewScanner(filename, source);
+	s.KeepTrivia();
+	for {
+		token, err := s.Next();
+		// the parser reports lexical errors, the comments before one are kept
+		if err != nil {
+			return ignored;
+		}
+		// leading trivia starts on a new line, a comment in it is alone unless the token follows on its last line
+		for _, trivia := range token.Leading {
+			suppress(ignored, trivia, token.Line > trivia.Span.End.Line);
+		}
+		for _, trivia := range token.Trailing {
+			suppress(ignored, trivia, false);
+		}
+		if token.Type == lexer.EOF {
+			return ignored;
+		}
+	}
+}
+
+func suppress(ignored map[uint][]string, trivia lexer.Trivia, alone bool) {
+	if trivia.Kind != lexer.COMMENT {
+		return;
+	}
+	comment := strings.TrimPrefix(trivia.Text, "//");
+	if strings.HasPrefix(trivia.Text, "/*") {
+		comment = strings.TrimSuffix(strings.TrimPrefix(trivia.Text, "/*"), "*/");
+	}
+	comment = strings.TrimSpace(comment);
+	if !strings.HasPrefix(comment, "aml:ignore") {
+		return;
+	}
+	rules := strings.FieldsFunc(strings.TrimPrefix(comment, "aml:ignore"), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r';
+	});
+	target := trivia.Span.End.Line;
+	if alone {
+		target++;
+	}
+	ignored[target] = append(ignored[target], rules...);
+	if len(rules) == 0 {
+		ignored[target] = []string{};
+	}
+}
+
+func (lin *Linter) suppressed(rule string, line uint) bool {
+	rules, ok := lin.ignored[line];
+	if !ok {
+		return false;
+	}
+	if len(rules) == 0 {
+		return true;
+	}
+	for _, id := range rules {
+		if id == rule {
+			return true;
+		}
+	}
+	return false;
+}
+
+func (lin *Linter) report(rule string, tok lexer.Token, format string, args ...any) {
+	if !lin.config.enabled(rule) || lin.suppressed(rule, tok.Line) {
+		return;
+	}
+	lin.diagnostics = append(lin.diagnostics, LintDiagnostic{
+		Rule: rule,
+		File: lin.filename,
+		Line: tok.Line,
+		Column: tok.Column,
+		Message: fmt.Sprintf(format, args...),
+	});
+}
+
+func (lin *Linter) begin_scope() {
+	lin.scopes = append(lin.scopes, make(map[string]*lint_symbol));
+}
+
+func (lin *Linter) end_scope() {
+	scope := lin.scopes[len(lin.scopes)-1];
+	lin.scopes = lin.scopes[:len(lin.scopes)-1];
+	lin.report_unused(scope);
+}
+
+func (lin *Linter) report_unused(scope map[string]*lint_symbol) {
+	for _, sym := range scope {
+		if sym.used || sym.rule == "" || strings.HasPrefix(sym.name.Lexeme, "_") {
+			continue;
+		}
+		if sym.rule == RuleUnusedParameter {
+			lin.report(sym.rule, sym.name, "parameter '%s' is never used", sym.name.Lexeme);
+		} else {
+			lin.report(sym.rule, sym.name, "variable '%s' is never used", sym.name.Lexeme);
+		}
+	}
+}
+
+func (lin *Linter) declare(name lexer.Token, rule string) {
+	for i := len(lin.scopes) - 2; i >= 0; i-- {
+		if outer, ok := lin.scopes[i][name.Lexeme]; ok {
+			lin.report(RuleShadowedName, name, "'%s' shadows the declaration at line %d", name.Lexeme, outer.name.Line);
+			break;
+		}
+	}
+	lin.scopes[len(lin.scopes)-1][name.Lexeme] = &lint_symbol{ name: name, rule: rule };
+}
+
+func (lin *Linter) use(name string) {
+	for i := len(lin.scopes) - 1; i >= 0; i-- {
+		if sym, ok := lin.scopes[i][name]; ok {
+			sym.used = true;
+			return;
+		}
+	}
+}
+
+func (lin *Linter) lint_stmts(stmts []parser.Stmt) {
+	reported := false;
+	for i, stmt := range stmts {
+		parser.AcceptStmt(stmt, lin);
+		if reported || i + 1 == len(stmts) {
+			continue;
+		}
+		if keyword, ok := jump_keyword(stmt); ok {
+			lin.report(RuleUnreachableCode, keyword, "code after '%s' is unreachable", keyword.Lexeme);
+			reported = true;
+		}
+	}
+}
+
+func jump_keyword(stmt parser.Stmt) (lexer.Token, bool) {
+	switch stmt := stmt.(type) {
+		case parser.ReturnStmt: return stmt.Keyword, true;
+		case parser.BreakStmt: return stmt.Keyword, true;
+		case parser.ContinueStmt: return stmt.Keyword, true;
+	}
+	return lexer.Token{}, false;
+}
+
+// reports whether a loop body can leave the loop through a break or a return
+func exits_loop(stmt parser.Stmt) bool {
+	switch stmt := stmt.(type) {
+		case parser.BreakStmt, parser.ReturnStmt: {
+			return true;
+		}
+		case parser.BlockStmt: {
+			for _, inner := range stmt.Stmts {
+				if exits_loop(inner) {
+					return true;
+				}
+			}
+		}
+		case parser.ConditionalStmt: {
+			for _, branch := range stmt.Branches {
+				if exits_loop(branch.NDStmt) {
+					return true;
+				}
+			}
+		}
+		// a break inside a nested loop only leaves that loop
+		case parser.WhileStmt: {
+			return returns_anywhere(stmt.NDStmt);
+		}
+		case parser.ForStmt: {
+			return returns_anywhere(stmt.NDStmt);
+		}
+	}
+	return false;
+}
+
+func returns_anywhere(stmt parser.Stmt) bool {
+	switch stmt := stmt.(type) {
+		case parser.ReturnStmt: return true;
+		case parser.BlockStmt: {
+			for _, inner := range stmt.Stmts {
+				if returns_anywhere(inner) {
+					return true;
+				}
+			}
+		}
+		case parser.ConditionalStmt: {
+			for _, branch := range stmt.Branches {
+				if returns_anywhere(branch.NDStmt) {
+					return true;
+				}
+			}
+		}
+		case parser.WhileStmt: return returns_anywhere(stmt.NDStmt);
+		case parser.ForStmt: return returns_anywhere(stmt.NDStmt);
+	}
+	return false;
+}
+
+func literal_bool(expr parser.Expr) (bool, bool) {
+	if grp, ok := expr.(parser.GroupingExpr); ok {
+		return literal_bool(grp.InnerExpr);
+	}
+	lit, ok := expr.(parser.LiteralExpr);
+	if !ok {
+		return false, false;
+	}
+	switch val := lit.ValueLiteral.(type) {
+		case bool: return val, true;
+		case nil: return false, true;
+		case float64: return true, true;
+		case string: return true, true;
+	}
+	return false, false;
+}
+
+func is_null_literal(expr parser.Expr) bool {
+	if grp, ok := expr.(parser.GroupingExpr); ok {
+		return is_null_literal(grp.InnerExpr);
+	}
+	lit, ok := expr.(parser.LiteralExpr);
+	return ok && lit.ValueLiteral == nil;
+}
+
+// statements
+func (lin *Linter) VisitExpr(stmt parser.ExprStmt) (None, error) {
+	parser.Accept(stmt.InnerExpr, lin);
+	return None{}, nil;
+}
+
+func (lin *Linter) VisitVariableDeclaration(stmt parser.VarDeclarationStmt) (None, error) {
+	if stmt.Asset != nil {
+		parser.Accept(stmt.Asset, lin);
+	}
+	lin.declare(stmt.Name, RuleUnusedVariable);
+	return None{}, nil;
+}
+
+func (lin *Linter) VisitVarUnpack(stmt parser.VarUnpackStmt) (None, error) {
+	parser.Accept(stmt.Asset, lin);
+	for _, name := range stmt.Names {
+		lin.declare(name, RuleUnusedVariable);
+	}
+	return None{}, nil;
+}
+
+func (lin *Linter) VisitFuncDeclarationStmt(stmt parser.FuncDeclarationStmt) (None, error) {
+	lin.declare(stmt.Name, "");
+	lin.lint_func(parser.Func(stmt));
+	return None{}, nil;
+}
+
+func (lin *Linter) lint_func(fn parser.Func) {
+	lin.begin_scope();
+	defer lin.end_scope();
+	for _, param := range fn.Params {
+		lin.declare(param, RuleUnusedParameter);
+	}
+	lin.lint_stmts(fn.Body);
+}
+
+func (lin *Linter) VisitClass(stmt parser.ClassStmt) (None, error) {
+	lin.declare(stmt.Name, "");
+	for _, trait := range stmt.Traits {
+		lin.use(trait.Name.Lexeme);
+	}
+	for _, method := range stmt.Methods {
+		lin.lint_func(method);
+	}
+	return None{}, nil;
+}
+
+func (lin *Linter) VisitTrait(stmt parser.TraitStmt) (None, error) {
+	lin.declare(stmt.Name, "");
+	for _, method := range stmt.Defaults {
+		lin.lint_func(method);
+	}
+	return None{}, nil;
+}
+
+func (lin *Linter) VisitReturn(stmt parser.ReturnStmt) (None, error) {
+	if stmt.Asset != nil {
+		parser.Accept(stmt.Asset, lin);
+	}
+	return None{}, nil;
+}
+
+func (lin *Linter) VisitBreak(parser.BreakStmt) (None, error) {
+	return None{}, nil;
+}
+
+func (lin *Linter) VisitContinue(parser.ContinueStmt) (None, error) {
+	return None{}, nil;
+}
+
+func (lin *Linter) VisitPrint(stmt parser.PrintStmt) (None, error) {
+	for _, asset := range stmt.Assets {
+		parser.Accept(asset, lin);
+	}
+	return None{}, nil;
+}
+
+func (lin *Linter) VisitBlock(stmt parser.BlockStmt) (None, error) {
+	lin.begin_scope();
+	defer lin.end_scope();
+	lin.lint_stmts(stmt.Stmts);
+	return None{}, nil;
+}
+
+func (lin *Linter) VisitConditional(stmt parser.ConditionalStmt) (None, error) {
+	for _, branch := range stmt.Branches {
+		if branch.Condition != nil {
+			parser.Accept(branch.Condition, lin);
+			if val, ok := literal_bool(branch.Condition); ok {
+				lin.report(RuleConstantCondition, branch.Keyword, "condition is always %t", val);
+			}
+		}
+		parser.AcceptStmt(branch.NDStmt, lin);
+	}
+	return None{}, nil;
+}
+
+func (lin *Linter) VisitWhile(stmt parser.WhileStmt) (None, error) {
+	parser.Accept(stmt.Cond, lin);
+	if val, ok := literal_bool(stmt.Cond); ok {
+		if !val {
+			lin.report(RuleConstantCondition, stmt.Keyword, "loop condition is always false");
+		} else if !exits_loop(stmt.NDStmt) {
+			lin.report(RuleConstantCondition, stmt.Keyword, "loop never exits, its condition is always true and it has no 'break'");
+		}
+	}
+	parser.AcceptStmt(stmt.NDStmt, lin);
+	return None{}, nil;
+}
+
+func (lin *Linter) VisitFor(stmt parser.ForStmt) (None, error) {
+	if stmt.Init != nil {
+		parser.AcceptStmt(stmt.Init, lin);
+	}
+	if stmt.Cond != nil {
+		parser.Accept(stmt.Cond, lin);
+	}
+	if stmt.Step != nil {
+		parser.Accept(stmt.Step, lin);
+	}
+	val, constant := true, stmt.Cond == nil;
+	if stmt.Cond != nil {
+		val, constant = literal_bool(stmt.Cond);
+	}
+	if constant && val && !exits_loop(stmt.NDStmt) {
+		lin.report(RuleConstantCondition, stmt.Keyword, "loop never exits, its condition is always true and it has no 'break'");
+	} else if constant && !val {
+		lin.report(RuleConstantCondition, stmt.Keyword, "loop condition is always false");
+	}
+	parser.AcceptStmt(stmt.NDStmt, lin);
+	return None{}, nil;
+}
+
+// expressions
+func (lin *Linter) VisitTernary(expr parser.TernaryExpr) (None, error) {
+	parser.Accept(expr.Cond, lin);
+	parser.Accept(expr.Iftrue, lin);
+	parser.Accept(expr.Iffalse, lin);
+	return None{}, nil;
+}
+
+func (lin *Linter) VisitBinary(expr parser.BinaryExpr) (None, error) {
+	parser.Accept(expr.LOperand, lin);
+	parser.Accept(expr.ROperand, lin);
+	switch expr.Operator.Type {
+		case lexer.LESS, lexer.LESS_EQUAL, lexer.GREATER, lexer.GREATER_EQUAL: {
+			if is_null_literal(expr.LOperand) || is_null_literal(expr.ROperand) {
+				lin.report(RuleNullOrdering, expr.Operator, "comparing with null using '%s' always fails, use '==' or '!='", expr.Operator.Lexeme);
+			}
+		}
+	}
+	return None{}, nil;
+}
+
+func (lin *Linter) VisitUnary(expr parser.UnaryExpr) (None, error) {
+	parser.Accept(expr.Operand, lin);
+	return None{}, nil;
+}
+
+func (lin *Linter) VisitLiteral(parser.LiteralExpr) (None, error) {
+	return None{}, nil;
+}
+
+func (lin *Linter) VisitVariable(expr parser.VariableExpr) (None, error) {
+	lin.use(expr.Name.Lexeme);
+	return None{}, nil;
+}
+
+func (lin *Linter) VisitGroup(expr parser.GroupingExpr) (None, error) {
+	parser.Accept(expr.InnerExpr, lin);
+	return None{}, nil;
+}
+
+func (lin *Linter) VisitAssign(expr parser.AssignExpr) (None, error) {
+	if vari, ok := expr.Asset.(parser.VariableExpr); ok && vari.Name.Lexeme == expr.Name.Lexeme {
+		lin.report(RuleSelfAssignment, expr.Name, "'%s' is assigned to itself", expr.Name.Lexeme);
+	}
+	// assigning alone does not count as using the variable
+	parser.Accept(expr.Asset, lin);
+	return None{}, nil;
+}
+
+func (lin *Linter) VisitFuncCall(expr parser.FuncCall) (None, error) {
+	parser.Accept(expr.Callee, lin);
+	for _, arg := range expr.Args {
+		parser.Accept(arg, lin);
+	}
+	return None{}, nil;
+}
+
+func (lin *Linter) VisitCoalesce(expr parser.CoalesceExpr) (None, error) {
+	parser.Accept(expr.LOperand, lin);
+	parser.Accept(expr.ROperand, lin);
+	return None{}, nil;
+}
+
+func (lin *Linter) VisitOptionalChain(expr parser.OptionalChainExpr) (None, error) {
+	parser.Accept(expr.Chain, lin);
+	return None{}, nil;
+}
+
+func (lin *Linter) VisitTuple(expr parser.TupleExpr) (None, error) {
+	for _, element := range expr.Elements {
+		parser.Accept(element, lin);
+	}
+	return None{}, nil;
+}
+
+func (lin *Linter) VisitIndex(expr parser.IndexExpr) (None, error) {
+	parser.Accept(expr.Object, lin);
+	parser.Accept(expr.Index, lin);
+	return None{}, nil;
+}
+
+func (lin *Linter) VisitGet(expr parser.GetExpr) (None, error) {
+	parser.Accept(expr.Object, lin);
+	return None{}, nil;
+}
+
+func (lin *Linter) VisitSet(expr parser.SetExpr) (None, error) {
+	parser.Accept(expr.Object, lin);
+	parser.Accept(expr.Asset, lin);
+	return None{}, nil;
+}
+
+func (lin *Linter) VisitThis(parser.ThisExpr) (None, error) {
+	return None{}, nil;
+}
+
+func (lin *Linter) Lint(stmts []parser.Stmt) []LintDiagnostic {
+	lin.lint_stmts(stmts);
+	lin.report_unused(lin.scopes[0]);
+	sort.SliceStable(lin.diagnostics, func(i, j int) bool {
+		a, b := lin.diagnostics[i], lin.diagnostics[j];
+		if a.Line != b.Line {
+			return a.Line < b.Line;
+		}
+		return a.Column < b.Column;
+	});
+	return lin.diagnostics;
+}
@@ -0,0 +1,44 @@
+package analyzer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLintSuppressions(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+		want []string; // the rules reported, in order
+	}{
+		{ "not suppressed", "var x = 1;\nx = x;\n", []string{ RuleSelfAssignment } },
+		{ "same line", "var x = 1;\nx = x; // aml:ignore self-assignment\n", nil },
+		{ "line above", "var x = 1;\n// aml:ignore self-assignment\nx = x;\n", nil },
+		{ "every rule", "var x = 1;\nx = x; // aml:ignore\n", nil },
+		{ "another rule", "var x = 1;\nx = x; // aml:ignore shadowed-name\n", []string{ RuleSelfAssignment } },
+		{ "a list", "var x = 1;\nx = x; // aml:ignore shadowed-name, self-assignment\n", nil },
+		{ "only the next line", "var x = 1;\n// aml:ignore\nx = x;\nx = x;\n", []string{ RuleSelfAssignment } },
+
+		{ "block comment", "var x = 1;\nx = x; /* aml:ignore self-assignment */\n", nil },
+		{ "block comment above", "var x = 1;\n/* aml:ignore\n   self-assignment */\nx = x;\n", nil },
+		{ "block comment before the code", "var x = 1;\n/* aml:ignore */ x = x;\n", nil },
+
+		// not comments
+		{ "in a string", "var x = 1;\nx = x; print \"// aml:ignore\";\n", []string{ RuleSelfAssignment } },
+		{ "after a raw string holding a quote", "var x = 1;\nx = x; print `\"`; // aml:ignore\n", nil },
+		{ "in a raw string", "var x = 1;\nx = x; print `// aml:ignore`;\n", []string{ RuleSelfAssignment } },
+		{ "in a multi-line string", "var x = 1;\nprint \"\"\"\n// aml:ignore\n\"\"\"; x = x;\n", []string{ RuleSelfAssignment } },
+		{ "in a block comment", "var x = 1;\n/* // aml:ignore */\nx = x;\n", []string{ RuleSelfAssignment } },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := make([]string, 0);
+			for _, diag := range NewLinter("test.aml", test.source, LintConfig{}).Lint(parse(t, test.source)) {
+				got = append(got, diag.Rule);
+			}
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("got %q, want %q", got, test.want);
+			}
+		});
+	}
+}
@@ -0,0 +1,572 @@
+package analyzer
+
+import (
+	"fmt"
+	"sort"
+
+	"aml/lexer"
+	"aml/parser"
+)
+
+type null_var struct {
+	name lexer.Token;
+	fn int; // depth of the function that declared it, 0 for the top level
+	is_func bool;
+	returns_null bool; // only for functions
+}
+
+// variable -> may be null, a nil state means the code is unreachable
+type null_state map[*null_var]bool;
+
+func (state null_state) copy() null_state {
+	if state == nil {
+		return nil;
+	}
+	cpy := make(null_state, len(state));
+	for v, maybe := range state {
+		cpy[v] = maybe;
+	}
+	return cpy;
+}
+
+// join point: a variable may be null if it may be null on any incoming path
+func merge(a null_state, b null_state) null_state {
+	if a == nil {
+		return b.copy();
+	}
+	if b == nil {
+		return a.copy();
+	}
+	merged := a.copy();
+	for v, maybe := range b {
+		merged[v] = merged[v] || maybe;
+	}
+	return merged;
+}
+
+func same_state(a null_state, b null_state) bool {
+	if (a == nil) != (b == nil) || len(a) != len(b) {
+		return false;
+	}
+	for v, maybe := range a {
+		if other, ok := b[v]; !ok || other != maybe {
+			return false;
+		}
+	}
+	return true;
+}
+
+type null_loop struct {
+	breaks null_state;
+	continues null_state;
+}
+
+type null_func struct {
+	sym *null_var; // nil for the top level
+	returns_null bool;
+	returns_value bool;
+}
+
+// NullChecker is a flow-sensitive dataflow analysis that warns about values that
+// may be null where the interpreter would fail on them (operators, calls, indexing).
+// it tracks `var x;` without an initializer, assignments in every branch,
+// `if (x != null)` narrowing and functions that do not return on every path.
+type NullChecker struct {
+	filename string;
+	scopes []map[string]*null_var;
+	state null_state;
+	loops []*null_loop;
+	funcs []*null_func;
+	warnings map[null_warning]error; // keyed by position and message, loops report them again
+}
+
+type null_warning struct {
+	line uint;
+	column uint;
+	message string;
+}
+
+func NewNullChecker(filename string) *NullChecker {
+	return &NullChecker{
+		filename: filename,
+		scopes: []map[string]*null_var{ make(map[string]*null_var) },
+		state: make(null_state),
+		loops: make([]*null_loop, 0),
+		funcs: []*null_func{ {} },
+		warnings: make(map[null_warning]error),
+	};
+}
+
+// loops are analysed more than once, so the same warning may be reported again
+func (nc *NullChecker) warn(tok lexer.Token, format string, args ...any) {
+	key := null_warning{ line: tok.Line, column: tok.Column, message: fmt.Sprintf(format, args...) };
+	nc.warnings[key] = &lexer.Diagnostic{ Kind: "NULL WARNING", Filename: nc.filename, Span: tok.Span(), Message: key.message };
+}
+
+func (nc *NullChecker) begin_scope() {
+	nc.scopes = append(nc.scopes, make(map[string]*null_var));
+}
+
+func (nc *NullChecker) end_scope() {
+	nc.scopes = nc.scopes[:len(nc.scopes)-1];
+}
+
+func (nc *NullChecker) declare(name lexer.Token, maybe_null bool) *null_var {
+	v := &null_var{ name: name, fn: len(nc.funcs) - 1 };
+	nc.scopes[len(nc.scopes)-1][name.Lexeme] = v;
+	if nc.state != nil {
+		nc.state[v] = maybe_null;
+	}
+	return v;
+}
+
+func (nc *NullChecker) lookup(name string) *null_var {
+	for i := len(nc.scopes) - 1; i >= 0; i-- {
+		if v, ok := nc.scopes[i][name]; ok {
+			return v;
+		}
+	}
+	return nil;
+}
+
+// only variables of the current function are tracked, captured ones
+// may have been assigned anywhere before the call
+func (nc *NullChecker) tracked(v *null_var) bool {
+	return v != nil && v.fn == len(nc.funcs) - 1 && nc.state != nil;
+}
+
+func (nc *NullChecker) maybe_null(expr parser.Expr) bool {
+	maybe, _ := parser.Accept(expr, nc);
+	return maybe;
+}
+
+// reports operands that the interpreter refuses to work with when null
+func (nc *NullChecker) check_operand(expr parser.Expr, maybe bool, operator lexer.Token) {
+	if !maybe {
+		return;
+	}
+	switch expr := expr.(type) {
+		case parser.VariableExpr: {
+			nc.warn(expr.Name, "'%s' may be null here, '%s' fails on null", expr.Name.Lexeme, operator.Lexeme);
+			return;
+		}
+		case parser.FuncCall: {
+			nc.warn(expr.Paren, "call may return null, '%s' fails on null", operator.Lexeme);
+			return;
+		}
+		case parser.LiteralExpr: {
+			nc.warn(operator, "'%s' fails on null", operator.Lexeme);
+			return;
+		}
+	}
+	nc.warn(operator, "operand may be null, '%s' fails on null", operator.Lexeme);
+}
+
+// returns the states in which cond is truthy and falsy
+func (nc *NullChecker) narrow(cond parser.Expr, state null_state) (null_state, null_state) {
+	then_state, else_state := state.copy(), state.copy();
+	if state == nil {
+		return nil, nil;
+	}
+	switch cond := cond.(type) {
+		case parser.GroupingExpr: {
+			return nc.narrow(cond.InnerExpr, state);
+		}
+		case parser.UnaryExpr: {
+			if cond.Operator.Type == lexer.BANG {
+				then_state, else_state = nc.narrow(cond.Operand, state);
+				return else_state, then_state;
+			}
+		}
+		case parser.VariableExpr: {
+			if v := nc.lookup(cond.Name.Lexeme); nc.tracked(v) {
+				then_state[v] = false;
+			}
+		}
+		case parser.BinaryExpr: {
+			if cond.Operator.Type != lexer.EQUAL_EQUAL && cond.Operator.Type != lexer.BANG_EQUAL {
+				break;
+			}
+			operand := cond.LOperand;
+			if !is_null_literal(cond.ROperand) {
+				if !is_null_literal(cond.LOperand) {
+					break;
+				}
+				operand = cond.ROperand;
+			}
+			vari, ok := operand.(parser.VariableExpr);
+			if !ok {
+				break;
+			}
+			if v := nc.lookup(vari.Name.Lexeme); nc.tracked(v) {
+				// x != null
+				then_state[v], else_state[v] = false, true;
+				if cond.Operator.Type == lexer.EQUAL_EQUAL {
+					then_state[v], else_state[v] = true, false;
+				}
+			}
+		}
+	}
+	return then_state, else_state;
+}
+
+func (nc *NullChecker) check_stmts(stmts []parser.Stmt) {
+	for _, stmt := range stmts {
+		parser.AcceptStmt(stmt, nc);
+	}
+}
+
+// statements
+func (nc *NullChecker) VisitExpr(stmt parser.ExprStmt) (None, error) {
+	nc.maybe_null(stmt.InnerExpr);
+	return None{}, nil;
+}
+
+func (nc *NullChecker) VisitVariableDeclaration(stmt parser.VarDeclarationStmt) (None, error) {
+	maybe := true;
+	if stmt.Asset != nil {
+		maybe = nc.maybe_null(stmt.Asset);
+	}
+	nc.declare(stmt.Name, maybe);
+	return None{}, nil;
+}
+
+func (nc *NullChecker) VisitVarUnpack(stmt parser.VarUnpackStmt) (None, error) {
+	nc.maybe_null(stmt.Asset);
+	for _, name := range stmt.Names {
+		nc.declare(name, false);
+	}
+	return None{}, nil;
+}
+
+func (nc *NullChecker) VisitFuncDeclarationStmt(stmt parser.FuncDeclarationStmt) (None, error) {
+	sym := nc.declare(stmt.Name, false);
+	sym.is_func = true;
+	nc.check_func(parser.Func(stmt), sym);
+	return None{}, nil;
+}
+
+// analyses the body of fn on its own, records on sym whether it may return null
+// and reports whether the end of the body is reachable
+func (nc *NullChecker) check_func(stmt parser.Func, sym *null_var) bool {
+	outer_state, outer_loops := nc.state, nc.loops;
+	fn := &null_func{ sym: sym };
+	nc.funcs = append(nc.funcs, fn);
+	nc.state, nc.loops = make(null_state), make([]*null_loop, 0);
+	nc.begin_scope();
+	for _, param := range stmt.Params {
+		nc.declare(param, false);
+	}
+	nc.check_stmts(stmt.Body);
+	falls_off := nc.state != nil;
+	nc.end_scope();
+	nc.funcs = nc.funcs[:len(nc.funcs)-1];
+	nc.state, nc.loops = outer_state, outer_loops;
+
+	if falls_off && fn.returns_value {
+		nc.warn(stmt.Name, "function '%s' does not return a value on every path", stmt.Name.Lexeme);
+	}
+	sym.returns_null = fn.returns_null || falls_off;
+	return falls_off;
+}
+
+// whether fn may end without returning, the body is analysed apart from the code around it
+func falls_off(fn parser.Func) bool {
+	return NewNullChecker("").check_func(fn, &null_var{ name: fn.Name, is_func: true });
+}
+
+// methods are only called through instances, which are not tracked
+func (nc *NullChecker) check_methods(methods []parser.Func) {
+	for _, method := range methods {
+		nc.check_func(method, &null_var{ name: method.Name, is_func: true });
+	}
+}
+
+func (nc *NullChecker) VisitClass(stmt parser.ClassStmt) (None, error) {
+	nc.declare(stmt.Name, false);
+	nc.check_methods(stmt.Methods);
+	return None{}, nil;
+}
+
+func (nc *NullChecker) VisitTrait(stmt parser.TraitStmt) (None, error) {
+	nc.declare(stmt.Name, false);
+	nc.check_methods(stmt.Defaults);
+	return None{}, nil;
+}
+
+func (nc *NullChecker) VisitReturn(stmt parser.ReturnStmt) (None, error) {
+	fn := nc.funcs[len(nc.funcs)-1];
+	if stmt.Asset == nil {
+		fn.returns_null = true;
+	} else {
+		fn.returns_value = true;
+		fn.returns_null = nc.maybe_null(stmt.Asset) || fn.returns_null;
+	}
+	nc.state = nil;
+	return None{}, nil;
+}
+
+func (nc *NullChecker) VisitBreak(parser.BreakStmt) (None, error) {
+	if len(nc.loops) != 0 {
+		loop := nc.loops[len(nc.loops)-1];
+		loop.breaks = merge(loop.breaks, nc.state);
+	}
+	nc.state = nil;
+	return None{}, nil;
+}
+
+func (nc *NullChecker) VisitContinue(parser.ContinueStmt) (None, error) {
+	if len(nc.loops) != 0 {
+		loop := nc.loops[len(nc.loops)-1];
+		loop.continues = merge(loop.continues, nc.state);
+	}
+	nc.state = nil;
+	return None{}, nil;
+}
+
+func (nc *NullChecker) VisitPrint(stmt parser.PrintStmt) (None, error) {
+	for _, asset := range stmt.Assets {
+		nc.maybe_null(asset);
+	}
+	return None{}, nil;
+}
+
+func (nc *NullChecker) VisitBlock(stmt parser.BlockStmt) (None, error) {
+	nc.begin_scope();
+	defer nc.end_scope();
+	nc.check_stmts(stmt.Stmts);
+	return None{}, nil;
+}
+
+func (nc *NullChecker) VisitConditional(stmt parser.ConditionalStmt) (None, error) {
+	var out null_state = nil;
+	has_else := false;
+	for _, branch := range stmt.Branches {
+		if branch.Condition == nil {
+			has_else = true;
+			parser.AcceptStmt(branch.NDStmt, nc);
+			out = merge(out, nc.state);
+			break;
+		}
+		nc.maybe_null(branch.Condition);
+		then_state, else_state := nc.narrow(branch.Condition, nc.state);
+		nc.state = then_state;
+		parser.AcceptStmt(branch.NDStmt, nc);
+		out = merge(out, nc.state);
+		nc.state = else_state;
+	}
+	if !has_else {
+		out = merge(out, nc.state);
+	}
+	nc.state = out;
+	return None{}, nil;
+}
+
+// runs the loop body until the states at the loop head stop changing
+func (nc *NullChecker) check_loop(cond parser.Expr, body parser.Stmt, step parser.Expr) {
+	head := nc.state.copy();
+	var exit null_state = nil;
+	for range 8 {
+		nc.state = head.copy();
+		body_state, exit_state := nc.state, nc.state.copy();
+		if cond != nil {
+			nc.maybe_null(cond);
+			body_state, exit_state = nc.narrow(cond, nc.state);
+		} else {
+			exit_state = nil;
+		}
+		loop := &null_loop{};
+		nc.loops = append(nc.loops, loop);
+		nc.state = body_state;
+		parser.AcceptStmt(body, nc);
+		nc.loops = nc.loops[:len(nc.loops)-1];
+		nc.state = merge(nc.state, loop.continues);
+		if step != nil && nc.state != nil {
+			nc.maybe_null(step);
+		}
+		exit = merge(exit_state, loop.breaks);
+		next := merge(head, nc.state);
+		if same_state(next, head) {
+			break;
+		}
+		head = next;
+	}
+	nc.state = exit;
+}
+
+func (nc *NullChecker) VisitWhile(stmt parser.WhileStmt) (None, error) {
+	nc.check_loop(stmt.Cond, stmt.NDStmt, nil);
+	return None{}, nil;
+}
+
+func (nc *NullChecker) VisitFor(stmt parser.ForStmt) (None, error) {
+	if stmt.Init != nil {
+		parser.AcceptStmt(stmt.Init, nc);
+	}
+	nc.check_loop(stmt.Cond, stmt.NDStmt, stmt.Step);
+	return None{}, nil;
+}
+
+// expressions, each one returns whether its value may be null
+func (nc *NullChecker) VisitTernary(expr parser.TernaryExpr) (bool, error) {
+	nc.maybe_null(expr.Cond);
+	then_state, else_state := nc.narrow(expr.Cond, nc.state);
+	nc.state = then_state;
+	iftrue := nc.maybe_null(expr.Iftrue);
+	then_state = nc.state;
+	nc.state = else_state;
+	iffalse := nc.maybe_null(expr.Iffalse);
+	nc.state = merge(then_state, nc.state);
+	return iftrue || iffalse, nil;
+}
+
+func (nc *NullChecker) VisitBinary(expr parser.BinaryExpr) (bool, error) {
+	left := nc.maybe_null(expr.LOperand);
+	right := nc.maybe_null(expr.ROperand);
+	if expr.Operator.Type != lexer.EQUAL_EQUAL && expr.Operator.Type != lexer.BANG_EQUAL {
+		nc.check_operand(expr.LOperand, left, expr.Operator);
+		nc.check_operand(expr.ROperand, right, expr.Operator);
+	}
+	return false, nil;
+}
+
+func (nc *NullChecker) VisitUnary(expr parser.UnaryExpr) (bool, error) {
+	nc.check_operand(expr.Operand, nc.maybe_null(expr.Operand), expr.Operator);
+	return false, nil;
+}
+
+func (nc *NullChecker) VisitLiteral(expr parser.LiteralExpr) (bool, error) {
+	return expr.ValueLiteral == nil, nil;
+}
+
+func (nc *NullChecker) VisitVariable(expr parser.VariableExpr) (bool, error) {
+	v := nc.lookup(expr.Name.Lexeme);
+	if !nc.tracked(v) {
+		return false, nil;
+	}
+	return nc.state[v], nil;
+}
+
+func (nc *NullChecker) VisitGroup(expr parser.GroupingExpr) (bool, error) {
+	return nc.maybe_null(expr.InnerExpr), nil;
+}
+
+func (nc *NullChecker) VisitAssign(expr parser.AssignExpr) (bool, error) {
+	maybe := nc.maybe_null(expr.Asset);
+	if v := nc.lookup(expr.Name.Lexeme); nc.tracked(v) {
+		nc.state[v] = maybe;
+	}
+	return maybe, nil;
+}
+
+func (nc *NullChecker) VisitFuncCall(expr parser.FuncCall) (bool, error) {
+	callee := nc.maybe_null(expr.Callee);
+	for _, arg := range expr.Args {
+		nc.maybe_null(arg);
+	}
+	if callee && !expr.Optional {
+		if vari, ok := expr.Callee.(parser.VariableExpr); ok {
+			nc.warn(vari.Name, "'%s' may be null here, calling it fails", vari.Name.Lexeme);
+		} else {
+			nc.warn(expr.Paren, "callee may be null, calling it fails");
+		}
+	}
+	if vari, ok := expr.Callee.(parser.VariableExpr); ok {
+		if v := nc.lookup(vari.Name.Lexeme); v != nil && v.is_func {
+			return v.returns_null || expr.Optional, nil;
+		}
+	}
+	return expr.Optional, nil;
+}
+
+func (nc *NullChecker) VisitCoalesce(expr parser.CoalesceExpr) (bool, error) {
+	left := nc.maybe_null(expr.LOperand);
+	// the right operand only runs when the left one is null, a variable skipping it is not
+	skipped := nc.state.copy();
+	operand := expr.LOperand;
+	for group, ok := operand.(parser.GroupingExpr); ok; group, ok = operand.(parser.GroupingExpr) {
+		operand = group.InnerExpr;
+	}
+	if vari, ok := operand.(parser.VariableExpr); ok {
+		if v := nc.lookup(vari.Name.Lexeme); nc.tracked(v) {
+			skipped[v] = false;
+		}
+	}
+	right := nc.maybe_null(expr.ROperand);
+	nc.state = merge(skipped, nc.state);
+	return left && right, nil;
+}
+
+func (nc *NullChecker) VisitOptionalChain(expr parser.OptionalChainExpr) (bool, error) {
+	nc.maybe_null(expr.Chain);
+	return true, nil;
+}
+
+func (nc *NullChecker) VisitTuple(expr parser.TupleExpr) (bool, error) {
+	for _, element := range expr.Elements {
+		nc.maybe_null(element);
+	}
+	return false, nil;
+}
+
+func (nc *NullChecker) VisitIndex(expr parser.IndexExpr) (bool, error) {
+	object := nc.maybe_null(expr.Object);
+	nc.maybe_null(expr.Index);
+	if object && !expr.Optional {
+		nc.check_operand(expr.Object, object, expr.Bracket);
+	}
+	return expr.Optional, nil;
+}
+
+// reports objects that may be null where the interpreter reads or writes their property
+func (nc *NullChecker) check_object(object parser.Expr, name lexer.Token, access string) {
+	if !nc.maybe_null(object) {
+		return;
+	}
+	if vari, ok := object.(parser.VariableExpr); ok {
+		nc.warn(vari.Name, "'%s' may be null here, %s '%s' fails", vari.Name.Lexeme, access, name.Lexeme);
+		return;
+	}
+	nc.warn(name, "object may be null, %s '%s' fails", access, name.Lexeme);
+}
+
+// properties are not tracked
+func (nc *NullChecker) VisitGet(expr parser.GetExpr) (bool, error) {
+	if expr.Optional {
+		nc.maybe_null(expr.Object);
+	} else {
+		nc.check_object(expr.Object, expr.Name, "reading");
+	}
+	return expr.Optional, nil;
+}
+
+func (nc *NullChecker) VisitSet(expr parser.SetExpr) (bool, error) {
+	nc.check_object(expr.Object, expr.Name, "assigning");
+	return nc.maybe_null(expr.Asset), nil;
+}
+
+func (nc *NullChecker) VisitThis(parser.ThisExpr) (bool, error) {
+	return false, nil;
+}
+
+func (nc *NullChecker) Check(stmts []parser.Stmt) []error {
+	nc.check_stmts(stmts);
+	keys := make([]null_warning, 0, len(nc.warnings));
+	for key := range nc.warnings {
+		keys = append(keys, key);
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].line != keys[j].line {
+			return keys[i].line < keys[j].line;
+		}
+		if keys[i].column != keys[j].column {
+			return keys[i].column < keys[j].column;
+		}
+		return keys[i].message < keys[j].message;
+	});
+	warnings := make([]error, len(keys));
+	for i, key := range keys {
+		warnings[i] = nc.warnings[key];
+	}
+	return warnings;
+}
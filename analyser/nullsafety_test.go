@@ -0,0 +1,64 @@
+package analyzer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"aml/lexer"
+)
+
+func TestNullNarrowing(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+		want []string;
+	}{
+		{ "uninitialized", "var x; print x + 1;", []string{ "'x' may be null here, '+' fails on null" } },
+		{ "initialized", "var x = 1; print x + 1;", nil },
+
+		{ "coalesce", "var x; print (x ?? 1) + 1;", nil },
+		{ "coalesce with null", "var x; var y = x ?? null; print y + 1;", []string{ "'y' may be null here, '+' fails on null" } },
+		{ "coalesce assignment", "var x; x ??= 1; print x + 1;", nil },
+		{ "coalesce leaves its operand", "var x; x ?? 1; print x + 1;", []string{ "'x' may be null here, '+' fails on null" } },
+
+		{ "optional call", "var f; f?.(1);", nil },
+		{ "optional property", "var o; print o?.a + 1;", []string{ "operand may be null, '+' fails on null" } },
+		{ "optional property coalesced", "var o; print (o?.a ?? 0) + 1;", nil },
+
+		{ "not null", "var x; if (x != null) print x + 1;", nil },
+		{ "not null, else", "var x; if (x != null) print 1; else print x + 1;", []string{ "'x' may be null here, '+' fails on null" } },
+		{ "null, else", "var x; if (x == null) print 1; else print x + 1;", nil },
+		{ "null first", "var x; if (null == x) {} else print x + 1;", nil },
+		{ "negated", "var x; if (!(x == null)) print x + 1;", nil },
+		{ "truthy", "var x; if (x) print x + 1;", nil },
+		{ "after the branch", "var x; if (x != null) print 1; print x + 1;", []string{ "'x' may be null here, '+' fails on null" } },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := messages(NewNullChecker("test.aml").Check(parse(t, test.source)));
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("got %q, want %q", got, test.want);
+			}
+		});
+	}
+}
+
+// line 10 sorts after line 9 and columns compare as numbers, which formatted positions do not
+func TestNullWarningOrder(t *testing.T) {
+	source := "var x;" + strings.Repeat("\n", 8) + "print x + 1;\nprint x + (x + (x + (x + (x + (x + (x + (x + 1)))))));";
+	want := []lexer.Pos{ { Line: 9, Column: 7 } };
+	for column := uint(7); column <= 42; column += 5 {
+		want = append(want, lexer.Pos{ Line: 10, Column: column });
+	}
+	errs := NewNullChecker("test.aml").Check(parse(t, source));
+	if len(errs) != len(want) {
+		t.Fatalf("got %d warnings, want %d: %v", len(errs), len(want), errs);
+	}
+	for i, err := range errs {
+		var diag *lexer.Diagnostic;
+		if !errors.As(err, &diag) || diag.Span.Start.Line != want[i].Line || diag.Span.Start.Column != want[i].Column {
+			t.Errorf("warning %d: got %v, want it at %d:%d", i, err, want[i].Line, want[i].Column);
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package analyzer
+
+import (
+	"slices"
+	"testing"
+)
+
+// conformance is reported by the Resolver when the traits are declared in the same source
+func TestResolverTraits(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+		want []string;
+	}{
+		{ "conforms", "trait P { f(a); g() { return this.f(1); } }\nclass C implements P { f(a) { return a; } }\n", []string{} },
+		{
+			"missing and arity", "trait P { f(); g(a, b); }\nclass C implements P { g(a) { return a; } }\n",
+			[]string{ "class 'C' does not implement 'f' required by trait 'P'", "'C.g' takes 1 parameters, trait 'P' requires 2" },
+		},
+		{ "required by a default", "trait A { f(); }\ntrait B { f() { return 1; } }\nclass C implements A, B {}\n", []string{} },
+		{
+			"conflicting defaults", "trait A { f() { return 1; } }\ntrait B { f() { return 2; } }\nclass C implements A, B {}\n",
+			[]string{ "class 'C' inherits 'f' from both 'A' and 'B', it must define its own" },
+		},
+		// the trait is only known at runtime
+		{ "through a variable", "trait P { f(); }\nvar Q = P;\nclass C implements Q {}\n", []string{} },
+		{ "shadowed trait", "trait P { f(); }\n{\n\tvar P = 1;\n\tclass C implements P {}\n}\n", []string{} },
+		{ "this outside a method", "func f() { return this; }\n", []string{ "'this' should only be used inside a method" } },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := messages(NewResolver("test.aml").Resolve(parse(t, test.source)));
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want);
+			}
+		});
+	}
+}
@@ -1,47 +1,381 @@
 package analyzer
 
 import (
+	"fmt"
+
+	"aml/lexer"
 	"aml/parser"
 	"aml/interpreter"
 )
 
+// Resolver statically binds every variable reference to the scope that declares it,
+// so that the interpreter can jump straight to that scope instead of searching for it.
+// it mirrors the interpreter's scoping: blocks and function bodies open a scope,
+// "for" initializers live in the enclosing one and anything at the top level is global.
+// on the way it reports misplaced control flow and declarations, collecting all of them.
 type Resolver struct {
-	in interpreter.Interpreter;
-}
-
-type Value = parser.Value;
-
-func (res *Resolver) declare(name string) {
-}
-func (res *Resolver) resolve(name string);
-func (res *Resolver) define(name string);
-
-func (ana *Resolver) VisitVariableDeclaration(*parser.VarDeclarationStmt) (Value, error);
-func (ana *Resolver) VisitFuncDeclarationStmt(*parser.FuncDeclarationStmt) (Value, error);
-func (ana *Resolver) VisitVariable(*parser.VariableExpr) (Value, error);
-func (ana *Resolver) VisitFuncCall(*parser.FuncCall) (Value, error);
-func (ana *Resolver) VisitAssign(*parser.AssignExpr) (Value, error);
-func (ana *Resolver) VisitLiteral(*parser.LiteralExpr) (Value, error);
-func (ana *Resolver) VisitUnary(*parser.UnaryExpr) (Value, error);
-func (ana *Resolver) VisitBinary(*parser.BinaryExpr) (Value, error);
-func (ana *Resolver) VisitTernary(*parser.TernaryExpr) (Value, error);
-func (ana *Resolver) VisitGroup(*parser.GroupingExpr) (Value, error);
-func (ana *Resolver) VisitExpr(*parser.ExprStmt) (Value, error);
-func (ana *Resolver) VisitReturn(*parser.ReturnStmt) (Value, error);
-func (ana *Resolver) VisitBreak(*parser.BreakStmt) (Value, error);
-func (ana *Resolver) VisitContinue(*parser.ContinueStmt) (Value, error);
-func (ana *Resolver) VisitConditional(*parser.ConditionalStmt) (Value, error);
-func (ana *Resolver) VisitWhile(*parser.WhileStmt) (Value, error);
-func (ana *Resolver) VisitFor(*parser.ForStmt) (Value, error);
-func (ana *Resolver) VisitPrint(*parser.PrintStmt) (Value, error);
-func (ana *Resolver) VisitBlock(*parser.BlockStmt) (Value, error);
-
-func NewResolver(in interpreter.Interpreter) *Resolver {
+	filename string;
+	scopes []map[string]bool; // name -> defined, scopes[0] is the global scope
+	traits []map[string]*parser.TraitStmt; // the traits among the names of each scope
+	ahead []map[string]bool; // the functions each scope declares further down, see resolve_stmts
+	funcs int; // enclosing functions
+	classes int; // enclosing class and trait bodies
+	loops int; // enclosing loops inside the current function
+	errors []error;
+}
+
+type None = parser.None;
+
+func (res *Resolver) begin_scope() {
+	res.scopes = append(res.scopes, make(map[string]bool));
+	res.traits = append(res.traits, make(map[string]*parser.TraitStmt));
+	res.ahead = append(res.ahead, make(map[string]bool));
+}
+
+func (res *Resolver) end_scope() {
+	res.scopes = res.scopes[:len(res.scopes)-1];
+	res.traits = res.traits[:len(res.traits)-1];
+	res.ahead = res.ahead[:len(res.ahead)-1];
+}
+
+func (res *Resolver) report(tok lexer.Token, format string, args ...any) {
+	res.errors = append(res.errors, &lexer.Diagnostic{ Kind: "SEMANTIC ERROR", Filename: res.filename, Span: tok.Span(), Message: fmt.Sprintf(format, args...) });
+}
+
+func (res *Resolver) declare(name lexer.Token) {
+	scope := res.scopes[len(res.scopes)-1];
+	if _, exists := scope[name.Lexeme]; exists {
+		res.report(name, "'%s' is already declared in this scope", name.Lexeme);
+	}
+	scope[name.Lexeme] = false;
+	delete(res.traits[len(res.traits)-1], name.Lexeme);
+}
+
+func (res *Resolver) define(name lexer.Token) {
+	res.scopes[len(res.scopes)-1][name.Lexeme] = true;
+}
+
+func (res *Resolver) resolve(name lexer.Token, resolution *parser.Resolution) {
+	if defined, exists := res.scopes[len(res.scopes)-1][name.Lexeme]; exists && !defined {
+		res.report(name, "cannot read '%s' in its own initializer", name.Lexeme);
+	}
+	if resolution == nil {
+		return;
+	}
+	resolution.Resolved = true;
+	resolution.Depth = -1;
+	// globals are looked up by name, they may be declared by a later REPL line
+	for i := len(res.scopes) - 1; i > 0; i-- {
+		if _, ok := res.scopes[i][name.Lexeme]; ok || res.ahead[i][name.Lexeme] {
+			resolution.Depth = len(res.scopes) - 1 - i;
+			return;
+		}
+	}
+}
+
+// the trait declaration name refers to, nil when it refers to anything else
+func (res *Resolver) trait(name string) *parser.TraitStmt {
+	for i := len(res.scopes) - 1; i >= 0; i-- {
+		if _, ok := res.scopes[i][name]; ok {
+			return res.traits[i][name];
+		}
+	}
+	return nil;
+}
+
+// methods are functions declared in a scope holding "this"
+func (res *Resolver) resolve_methods(methods []parser.Func) {
+	res.begin_scope();
+	res.scopes[len(res.scopes)-1]["this"] = true;
+	res.classes++;
+	defer func() {
+		res.end_scope();
+		res.classes--;
+	}();
+	for _, method := range methods {
+		res.resolve_func(method);
+	}
+}
+
+func (res *Resolver) resolve_expr(expr parser.Expr) {
+	parser.Accept(expr, res);
+}
+
+// the functions of a block may call each other whatever their order: their bodies
+// run once called, when the functions declared after them in the block exist
+func (res *Resolver) resolve_stmts(stmts []parser.Stmt) {
+	ahead := res.ahead[len(res.ahead)-1];
+	for _, stmt := range stmts {
+		switch decl := stmt.(type) {
+			case parser.FuncDeclarationStmt: ahead[decl.Name.Lexeme] = true;
+			case *parser.FuncDeclarationStmt: ahead[decl.Name.Lexeme] = true;
+		}
+	}
+	for _, stmt := range stmts {
+		parser.AcceptStmt(stmt, res);
+	}
+}
+
+func (res *Resolver) resolve_func(fn parser.Func) {
+	res.begin_scope();
+	enclosing_loops := res.loops;
+	res.funcs++;
+	res.loops = 0;
+	defer func() {
+		res.end_scope();
+		res.funcs--;
+		res.loops = enclosing_loops;
+	}();
+	for _, param := range fn.Params {
+		res.declare(param);
+		res.define(param);
+	}
+	// the interpreter runs the body in the same environment as the parameters
+	res.resolve_stmts(fn.Body);
+}
+
+func (res *Resolver) resolve_loop_body(body parser.Stmt) {
+	res.loops++;
+	defer func() { res.loops--; }();
+	parser.AcceptStmt(body, res);
+}
+
+// statements
+func (res *Resolver) VisitVariableDeclaration(stmt parser.VarDeclarationStmt) (None, error) {
+	res.declare(stmt.Name);
+	if stmt.Asset != nil {
+		res.resolve_expr(stmt.Asset);
+	}
+	res.define(stmt.Name);
+	return None{}, nil;
+}
+
+func (res *Resolver) VisitVarUnpack(stmt parser.VarUnpackStmt) (None, error) {
+	for _, name := range stmt.Names {
+		res.declare(name);
+	}
+	res.resolve_expr(stmt.Asset);
+	for _, name := range stmt.Names {
+		res.define(name);
+	}
+	return None{}, nil;
+}
+
+func (res *Resolver) VisitFuncDeclarationStmt(stmt parser.FuncDeclarationStmt) (None, error) {
+	// defined before the body so that it can call itself
+	res.declare(stmt.Name);
+	res.define(stmt.Name);
+	res.resolve_func(parser.Func(stmt));
+	return None{}, nil;
+}
+
+func (res *Resolver) VisitClass(stmt parser.ClassStmt) (None, error) {
+	res.declare(stmt.Name);
+	res.define(stmt.Name);
+	traits := make([]parser.TraitStmt, 0, len(stmt.Traits));
+	for _, name := range stmt.Traits {
+		res.resolve(name.Name, name.Res);
+		if decl := res.trait(name.Name.Lexeme); decl != nil {
+			traits = append(traits, *decl);
+		}
+	}
+	// variables holding traits and traits declared by an earlier REPL line are only known to the interpreter
+	if len(traits) == len(stmt.Traits) {
+		for _, problem := range interpreter.Conformance(stmt, traits) {
+			res.report(stmt.Name, "%s", problem);
+		}
+	}
+	res.resolve_methods(stmt.Methods);
+	return None{}, nil;
+}
+
+func (res *Resolver) VisitTrait(stmt parser.TraitStmt) (None, error) {
+	res.declare(stmt.Name);
+	res.define(stmt.Name);
+	res.traits[len(res.traits)-1][stmt.Name.Lexeme] = &stmt;
+	res.resolve_methods(stmt.Defaults);
+	return None{}, nil;
+}
+
+func (res *Resolver) VisitExpr(stmt parser.ExprStmt) (None, error) {
+	res.resolve_expr(stmt.InnerExpr);
+	return None{}, nil;
+}
+
+func (res *Resolver) VisitReturn(stmt parser.ReturnStmt) (None, error) {
+	if res.funcs == 0 {
+		res.report(stmt.Keyword, "'return' should only be used inside a function");
+	}
+	if stmt.Asset != nil {
+		res.resolve_expr(stmt.Asset);
+	}
+	return None{}, nil;
+}
+
+func (res *Resolver) VisitBreak(stmt parser.BreakStmt) (None, error) {
+	if res.loops == 0 {
+		res.report(stmt.Keyword, "'break' should only be used inside 'for' or 'while'");
+	}
+	return None{}, nil;
+}
+
+func (res *Resolver) VisitContinue(stmt parser.ContinueStmt) (None, error) {
+	if res.loops == 0 {
+		res.report(stmt.Keyword, "'continue' should only be used inside 'for' or 'while'");
+	}
+	return None{}, nil;
+}
+
+func (res *Resolver) VisitConditional(stmt parser.ConditionalStmt) (None, error) {
+	for _, branch := range stmt.Branches {
+		if branch.Condition != nil {
+			res.resolve_expr(branch.Condition);
+		}
+		parser.AcceptStmt(branch.NDStmt, res);
+	}
+	return None{}, nil;
+}
+
+func (res *Resolver) VisitWhile(stmt parser.WhileStmt) (None, error) {
+	res.resolve_expr(stmt.Cond);
+	res.resolve_loop_body(stmt.NDStmt);
+	return None{}, nil;
+}
+
+func (res *Resolver) VisitFor(stmt parser.ForStmt) (None, error) {
+	if stmt.Init != nil {
+		parser.AcceptStmt(stmt.Init, res);
+	}
+	if stmt.Cond != nil {
+		res.resolve_expr(stmt.Cond);
+	}
+	if stmt.Step != nil {
+		res.resolve_expr(stmt.Step);
+	}
+	res.resolve_loop_body(stmt.NDStmt);
+	return None{}, nil;
+}
+
+func (res *Resolver) VisitPrint(stmt parser.PrintStmt) (None, error) {
+	for _, asset := range stmt.Assets {
+		res.resolve_expr(asset);
+	}
+	return None{}, nil;
+}
+
+func (res *Resolver) VisitBlock(stmt parser.BlockStmt) (None, error) {
+	res.begin_scope();
+	defer res.end_scope();
+	res.resolve_stmts(stmt.Stmts);
+	return None{}, nil;
+}
+
+// expressions
+func (res *Resolver) VisitVariable(expr parser.VariableExpr) (None, error) {
+	res.resolve(expr.Name, expr.Res);
+	return None{}, nil;
+}
+
+func (res *Resolver) VisitAssign(expr parser.AssignExpr) (None, error) {
+	res.resolve_expr(expr.Asset);
+	res.resolve(expr.Name, expr.Res);
+	return None{}, nil;
+}
+
+func (res *Resolver) VisitFuncCall(expr parser.FuncCall) (None, error) {
+	res.resolve_expr(expr.Callee);
+	for _, arg := range expr.Args {
+		res.resolve_expr(arg);
+	}
+	return None{}, nil;
+}
+
+func (res *Resolver) VisitLiteral(parser.LiteralExpr) (None, error) {
+	return None{}, nil;
+}
+
+func (res *Resolver) VisitUnary(expr parser.UnaryExpr) (None, error) {
+	res.resolve_expr(expr.Operand);
+	return None{}, nil;
+}
+
+func (res *Resolver) VisitBinary(expr parser.BinaryExpr) (None, error) {
+	res.resolve_expr(expr.LOperand);
+	res.resolve_expr(expr.ROperand);
+	return None{}, nil;
+}
+
+func (res *Resolver) VisitTernary(expr parser.TernaryExpr) (None, error) {
+	res.resolve_expr(expr.Cond);
+	res.resolve_expr(expr.Iftrue);
+	res.resolve_expr(expr.Iffalse);
+	return None{}, nil;
+}
+
+func (res *Resolver) VisitGroup(expr parser.GroupingExpr) (None, error) {
+	res.resolve_expr(expr.InnerExpr);
+	return None{}, nil;
+}
+
+func (res *Resolver) VisitCoalesce(expr parser.CoalesceExpr) (None, error) {
+	res.resolve_expr(expr.LOperand);
+	res.resolve_expr(expr.ROperand);
+	return None{}, nil;
+}
+
+func (res *Resolver) VisitOptionalChain(expr parser.OptionalChainExpr) (None, error) {
+	res.resolve_expr(expr.Chain);
+	return None{}, nil;
+}
+
+func (res *Resolver) VisitTuple(expr parser.TupleExpr) (None, error) {
+	for _, element := range expr.Elements {
+		res.resolve_expr(element);
+	}
+	return None{}, nil;
+}
+
+func (res *Resolver) VisitIndex(expr parser.IndexExpr) (None, error) {
+	res.resolve_expr(expr.Object);
+	res.resolve_expr(expr.Index);
+	return None{}, nil;
+}
+
+func (res *Resolver) VisitGet(expr parser.GetExpr) (None, error) {
+	res.resolve_expr(expr.Object);
+	return None{}, nil;
+}
+
+func (res *Resolver) VisitSet(expr parser.SetExpr) (None, error) {
+	res.resolve_expr(expr.Asset);
+	res.resolve_expr(expr.Object);
+	return None{}, nil;
+}
+
+func (res *Resolver) VisitThis(expr parser.ThisExpr) (None, error) {
+	if res.classes == 0 {
+		res.report(expr.Keyword, "'this' should only be used inside a method");
+		return None{}, nil;
+	}
+	res.resolve(expr.Keyword, expr.Res);
+	return None{}, nil;
+}
+
+func NewResolver(filename string) *Resolver {
+	globals := make(map[string]bool);
+	for name := range interpreter.GetStdFuncs() {
+		globals[name] = true;
+	}
 	return &Resolver{
-		in: in,
+		filename: filename,
+		scopes: []map[string]bool{ globals },
+		traits: []map[string]*parser.TraitStmt{ make(map[string]*parser.TraitStmt) },
+		ahead: []map[string]bool{ make(map[string]bool) },
+		errors: make([]error, 0),
 	};
 }
 
-func (ana *Resolver) Resolve(stmt parser.Stmt) (Value, error) {
-	return stmt.Accept(ana);
+func (res *Resolver) Resolve(stmts []parser.Stmt) []error {
+	res.resolve_stmts(stmts);
+	return res.errors;
 }
@@ -0,0 +1,208 @@
+// the concrete syntax tree keeps every token with its trivia (whitespace, line breaks and comments)
+// so that printing it gives back the source byte for byte. it only knows about statements and
+// brackets, which is enough for formatting, syntax highlighting and rewriting tokens in place;
+// anything that needs the meaning of the code should go through the parser's AST instead.
+// it is built even for code that does not parse: an unclosed bracket ends at the end of the file
+// and a stray closing one is kept as a token.
+package cst
+
+import (
+	"io"
+	"strings"
+
+	"aml/lexer"
+)
+
+type Kind int;
+
+const (
+	TokenNode Kind = iota // a leaf
+	FileNode
+	StatementNode // up to its ';', or its last block
+	BlockNode // "{" statement* "}"
+	ParenNode // "(" ... ")"
+	BracketNode // "[" ... "]"
+);
+
+func (kind Kind) String() string {
+	switch kind {
+		case TokenNode: return "Token";
+		case FileNode: return "File";
+		case StatementNode: return "Statement";
+		case BlockNode: return "Block";
+		case ParenNode: return "Paren";
+		case BracketNode: return "Bracket";
+	}
+	return "Unknown";
+}
+
+type Node struct {
+	Kind Kind;
+	Token lexer.Token; // leaves only
+	Children []*Node;
+}
+
+// String prints the node back as it was written, trivia included
+func (n *Node) String() string {
+	sb := strings.Builder{};
+	n.write(&sb);
+	return sb.String();
+}
+
+func (n *Node) write(sb *strings.Builder) {
+	if n.Kind != TokenNode {
+		for _, child := range n.Children {
+			child.write(sb);
+		}
+		return;
+	}
+	for _, trivia := range n.Token.Leading {
+		sb.WriteString(trivia.Text);
+	}
+	sb.WriteString(n.Token.Text());
+	for _, trivia := range n.Token.Trailing {
+		sb.WriteString(trivia.Text);
+	}
+}
+
+// Tokens returns the leaves in source order, the file's last one is the EOF token
+func (n *Node) Tokens() []lexer.Token {
+	if n.Kind == TokenNode {
+		return []lexer.Token{ n.Token };
+	}
+	tokens := make([]lexer.Token, 0);
+	for _, child := range n.Children {
+		tokens = append(tokens, child.Tokens()...);
+	}
+	return tokens;
+}
+
+// Span covers the tokens of the node, without the trivia around them
+func (n *Node) Span() lexer.Span {
+	if n.Kind == TokenNode {
+		return n.Token.Span();
+	}
+	spans := make([]lexer.Span, 0, len(n.Children));
+	for _, child := range n.Children {
+		spans = append(spans, child.Span());
+	}
+	return lexer.Cover(spans...);
+}
+
+type builder struct {
+	scanner *lexer.Scanner;
+	next lexer.Token; // lookahead
+}
+
+func (b *builder) advance() (*Node, error) {
+	leaf := &Node{ Kind: TokenNode, Token: b.next };
+	token, err := b.scanner.Next();
+	if err != nil {
+		return nil, err;
+	}
+	b.next = token;
+	return leaf, nil;
+}
+
+// Parse builds the tree of the source read from reader, only lexical errors stop it
+func Parse(filename string, reader io.Reader) (*Node, error) {
+	s := lexer.NewReaderScanner(filename, reader);
+	s.KeepTrivia();
+	first, err := s.Next();
+	if err != nil {
+		return nil, err;
+	}
+	b := &builder{ scanner: s, next: first };
+	file := &Node{ Kind: FileNode, Children: make([]*Node, 0) };
+	for b.next.Type != lexer.EOF {
+		stmt, err := b.statement();
+		if err != nil {
+			return nil, err;
+		}
+		file.Children = append(file.Children, stmt);
+	}
+	// the EOF token holds the trivia at the end of the file
+	file.Children = append(file.Children, &Node{ Kind: TokenNode, Token: b.next });
+	return file, nil;
+}
+
+// ParseString is Parse over a string
+func ParseString(filename string, source string) (*Node, error) {
+	return Parse(filename, strings.NewReader(source));
+}
+
+// statement -> (token | group)* ";" | (token | group)* block ("else" statement)?
+func (b *builder) statement() (*Node, error) {
+	stmt := &Node{ Kind: StatementNode, Children: make([]*Node, 0) };
+	for b.next.Type != lexer.EOF {
+		// a stray '}' is a statement of its own, otherwise it closes the enclosing block
+		if len(stmt.Children) != 0 && b.next.Type == lexer.RIGHT_BRACE {
+			break;
+		}
+		child, err := b.element();
+		if err != nil {
+			return nil, err;
+		}
+		stmt.Children = append(stmt.Children, child);
+		if child.Kind == TokenNode && child.Token.Type == lexer.SEMICOLON {
+			break;
+		}
+		if child.Kind == BlockNode && b.next.Type != lexer.ELSE {
+			break;
+		}
+	}
+	return stmt, nil;
+}
+
+// a token or a bracketed group
+func (b *builder) element() (*Node, error) {
+	switch b.next.Type {
+		case lexer.LEFT_BRACE: return b.block();
+		case lexer.LEFT_PAREN: return b.group(ParenNode, lexer.RIGHT_PAREN);
+		case lexer.LEFT_BRACKET: return b.group(BracketNode, lexer.RIGHT_BRACKET);
+	}
+	return b.advance();
+}
+
+func (b *builder) block() (*Node, error) {
+	open, err := b.advance();
+	if err != nil {
+		return nil, err;
+	}
+	block := &Node{ Kind: BlockNode, Children: []*Node{ open } };
+	for b.next.Type != lexer.EOF && b.next.Type != lexer.RIGHT_BRACE {
+		stmt, err := b.statement();
+		if err != nil {
+			return nil, err;
+		}
+		block.Children = append(block.Children, stmt);
+	}
+	if b.next.Type == lexer.RIGHT_BRACE {
+		close, err := b.advance();
+		if err != nil {
+			return nil, err;
+		}
+		block.Children = append(block.Children, close);
+	}
+	return block, nil;
+}
+
+func (b *builder) group(kind Kind, closing lexer.TokenType) (*Node, error) {
+	open, err := b.advance();
+	if err != nil {
+		return nil, err;
+	}
+	group := &Node{ Kind: kind, Children: []*Node{ open } };
+	for b.next.Type != lexer.EOF {
+		is_closing := b.next.Type == closing;
+		child, err := b.element();
+		if err != nil {
+			return nil, err;
+		}
+		group.Children = append(group.Children, child);
+		if is_closing {
+			break;
+		}
+	}
+	return group, nil;
+}
@@ -0,0 +1,30 @@
+package cst
+
+import "testing"
+
+// the tree prints back the source it was built from, whether it parses or not
+func TestLossless(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+	}{
+		{ "statements", "var a = 1; // one\n/* two */ print a;\n" },
+		{ "line breaks", "var a = 1\nprint a\n\n" },
+		{ "blocks", "func f(a) {\n\treturn a\n}\nif (f(1)) { print 1 } else { print 2 }\n" },
+		{ "ambiguous continuation", "var b = a\n(f)()\nprint b\n" },
+		{ "unclosed bracket", "print (1\nprint 2\n" },
+		{ "stray brace", "}\nprint 1;\n" },
+		{ "no trailing line break", "print 1 /* end */" },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tree, err := ParseString("test.aml", test.source);
+			if err != nil {
+				t.Fatalf("unexpected error %v", err);
+			}
+			if got := tree.String(); got != test.source {
+				t.Errorf("got %q, want %q", got, test.source);
+			}
+		});
+	}
+}
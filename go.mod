@@ -1,3 +1,5 @@
 module aml
 
 go 1.24.5
+
+require golang.org/x/text v0.29.0
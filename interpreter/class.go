@@ -0,0 +1,130 @@
+package interpreter
+
+import (
+	"fmt"
+	"slices"
+
+	"aml/parser"
+);
+
+// calling a class makes an instance and runs its init method on it
+type Class struct {
+	name string;
+	methods map[string]AMLFunc; // its own and the defaults inherited from its traits
+	traits []*Trait;
+}
+
+func (class *Class) Arity() byte {
+	if init, ok := class.methods["init"]; ok {
+		return init.Arity();
+	}
+	return 0;
+}
+
+func (class *Class) Execute(in *Interpreter, args []parser.Value) (parser.Value, error) {
+	instance := &Instance{
+		class: class,
+		fields: make(map[string]parser.Value),
+	};
+	if init, ok := class.methods["init"]; ok {
+		if _, err := init.bind(instance).Execute(in, args); err != nil {
+			return nil, err;
+		}
+	}
+	return instance, nil;
+}
+
+func (class *Class) String() string {
+	return fmt.Sprintf("class %s", class.name);
+}
+
+// nominal: a class only implements the traits it names
+func (class *Class) implements(trait *Trait) bool {
+	return slices.Contains(class.traits, trait);
+}
+
+type Instance struct {
+	class *Class;
+	fields map[string]parser.Value;
+}
+
+// fields shadow methods
+func (instance *Instance) get(name string) (parser.Value, bool) {
+	if value, ok := instance.fields[name]; ok {
+		return value, true;
+	}
+	if method, ok := instance.class.methods[name]; ok {
+		return method.bind(instance), true;
+	}
+	return nil, false;
+}
+
+func (instance *Instance) String() string {
+	return fmt.Sprintf("%s instance", instance.class.name);
+}
+
+type Trait struct {
+	decl parser.TraitStmt;
+	closure *Environment; // of its default methods
+}
+
+func (trait *Trait) String() string {
+	return fmt.Sprintf("trait %s", trait.decl.Name.Lexeme);
+}
+
+// the method sees the instance as "this", declared in a scope between its closure and its parameters
+func (fn AMLFunc) bind(instance *Instance) AMLFunc {
+	env := NewEnvironment(fn.closure);
+	env.declare("this", instance);
+	return AMLFunc{
+		closure: env,
+		internal: fn.internal,
+	};
+}
+
+// Conformance lists what keeps class from implementing traits, in source order: the methods it
+// inherits a default for from two traits without defining them, then the required methods
+// it neither defines nor inherits, or defines with another number of parameters.
+// the Resolver reports them before running, the interpreter when the class is declared
+func Conformance(class parser.ClassStmt, traits []parser.TraitStmt) []string {
+	problems := make([]string, 0);
+	arities := make(map[string]int);
+	for _, method := range class.Methods {
+		arities[method.Name.Lexeme] = len(method.Params);
+	}
+	inherited := make(map[string]string); // method -> trait
+	for _, trait := range traits {
+		for _, method := range trait.Defaults {
+			name := method.Name.Lexeme;
+			if _, own := arities[name]; own {
+				continue;
+			}
+			if from, ok := inherited[name]; ok && from != trait.Name.Lexeme {
+				problems = append(problems, fmt.Sprintf("class '%s' inherits '%s' from both '%s' and '%s', it must define its own",
+					class.Name.Lexeme, name, from, trait.Name.Lexeme));
+				continue;
+			}
+			inherited[name] = trait.Name.Lexeme;
+		}
+	}
+	for _, trait := range traits {
+		for _, method := range trait.Defaults {
+			if _, ok := arities[method.Name.Lexeme]; !ok && inherited[method.Name.Lexeme] == trait.Name.Lexeme {
+				arities[method.Name.Lexeme] = len(method.Params);
+			}
+		}
+	}
+	for _, trait := range traits {
+		for _, sig := range trait.Required {
+			arity, ok := arities[sig.Name.Lexeme];
+			if !ok {
+				problems = append(problems, fmt.Sprintf("class '%s' does not implement '%s' required by trait '%s'",
+					class.Name.Lexeme, sig.Name.Lexeme, trait.Name.Lexeme));
+			} else if arity != len(sig.Params) {
+				problems = append(problems, fmt.Sprintf("'%s.%s' takes %d parameters, trait '%s' requires %d",
+					class.Name.Lexeme, sig.Name.Lexeme, arity, trait.Name.Lexeme, len(sig.Params)));
+			}
+		}
+	}
+	return problems;
+}
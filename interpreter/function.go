@@ -2,7 +2,6 @@ package interpreter
 
 import (
 	"fmt"
-	"errors"
 
 	"aml/parser"
 );
@@ -16,7 +15,7 @@ func (fn AMLFunc) Arity() byte {
 	return byte(len(fn.internal.Params));
 }
 
-func (fn AMLFunc) Execute(in Interpreter, args []parser.Value) (parser.Value, error) {
+func (fn AMLFunc) Execute(in *Interpreter, args []parser.Value) (parser.Value, error) {
 	old_env := in.environment;
 	env := NewEnvironment(fn.closure); in.environment = env;
 	defer func() { in.environment = old_env; }();
@@ -26,20 +25,16 @@ func (fn AMLFunc) Execute(in Interpreter, args []parser.Value) (parser.Value, er
 			return nil, err;
 		}
 	}
-	var (
-		reterr *ReturnError = nil
-		retvalue parser.Value = nil
-	);
 	for _, stmt := range fn.internal.Body {
-		if _, err := stmt.Accept(in); err != nil {
-			if errors.As(err, &reterr) {
-				retvalue = reterr.val;
-				break;
+		if _, err := parser.AcceptStmt(stmt, in); err != nil {
+			// returns are never wrapped, errors.As would cost a reflection walk per call
+			if reterr, ok := err.(*ReturnError); ok {
+				return reterr.val, nil;
 			}
 			return nil, err;
 		}
 	}
-	return retvalue, nil;
+	return nil, nil;
 }
 
 func (fn AMLFunc) String() string {
@@ -17,6 +17,9 @@ func (e *ReturnError) Error() string {
 
 var BreakError = fmt.Errorf("RUNTIME ERROR: 'break' should only be used inside 'for' or 'while'");
 var ContinueError = fmt.Errorf("RUNTIME ERROR: 'continue' should only be used inside 'for' or 'while'");
+// internal: raised by a "?." link on a null value, the parser wraps every chain with
+// such a link in an OptionalChainExpr which catches it, so it never reaches the user
+var short_circuit = errors.New("optional chain short-circuited");
 
 type Environment struct {
 	refs map[string]parser.Value;
@@ -41,6 +44,21 @@ func (env *Environment) get(name string) (parser.Value, error) {
 	return nil, fmt.Errorf("variable %s is not declared", name);
 }
 
+func (env *Environment) ancestor(depth int) *Environment {
+	curr := env;
+	for range depth {
+		curr = curr.prev;
+	}
+	return curr;
+}
+
+func (env *Environment) get_at(depth int, name string) (parser.Value, error) {
+	if value, exists := env.ancestor(depth).refs[name]; exists {
+		return value, nil;
+	}
+	return nil, fmt.Errorf("variable %s is not declared", name);
+}
+
 func (env *Environment) declare(name string, value parser.Value) error {
 	if _, exists := env.refs[name]; exists {
 		return fmt.Errorf("variable %s is already declared", name);
@@ -61,43 +79,71 @@ func (env *Environment) assign(name string, new_value parser.Value) error {
 	return fmt.Errorf("variable %s is not declared", name);
 }
 
+func (env *Environment) assign_at(depth int, name string, new_value parser.Value) error {
+	scope := env.ancestor(depth);
+	if _, exists := scope.refs[name]; !exists {
+		return fmt.Errorf("variable %s is not declared", name);
+	}
+	scope.refs[name] = new_value;
+	return nil;
+}
+
 type Callable interface {
 	Arity() byte;
-	Execute(in Interpreter, args []parser.Value) (parser.Value, error);
+	Execute(in *Interpreter, args []parser.Value) (parser.Value, error);
 	String() string;
 }
 
 type Interpreter struct {
+	filename string;
 	environment *Environment;
+	globals *Environment;
 };
 
-func (in Interpreter) generate_error(format string, args ...any) error {
-	return fmt.Errorf("RUNTIME ERROR: %s", fmt.Sprintf(format, args...));
+// runtime errors are diagnostics over the source range of the failing node
+func (in *Interpreter) generate_error(span lexer.Span, format string, args ...any) error {
+	return &lexer.Diagnostic{ Kind: "RUNTIME ERROR", Filename: in.filename, Span: span, Message: fmt.Sprintf(format, args...) };
 }
 
-func (in Interpreter) extract_boolean(value parser.Value) bool {
+func (in *Interpreter) extract_boolean(value parser.Value) bool {
 	if value == nil || value == false {
 		return false;
 	}
 	return true;
 }
 
-func (in Interpreter) extract_string(value parser.Value) string {
+func (in *Interpreter) extract_string(value parser.Value) string {
 	return fmt.Sprint(value);
 }
 
-func (in Interpreter) equal(a parser.Value, b parser.Value) bool {
+func (in *Interpreter) equal(a parser.Value, b parser.Value) bool {
+	// tuples are slices, comparing them with == would panic
+	if atup, ok := a.(Tuple); ok {
+		btup, ok := b.(Tuple);
+		if !ok || len(atup) != len(btup) {
+			return false;
+		}
+		for i := range atup {
+			if !in.equal(atup[i], btup[i]) {
+				return false;
+			}
+		}
+		return true;
+	}
+	if _, ok := b.(Tuple); ok {
+		return false;
+	}
 	return a == b;
 }
 
 // expressions
-func (in Interpreter) VisitUnary(expr parser.UnaryExpr) (parser.Value, error) {
-	value, err := expr.Operand.Accept(in);
+func (in *Interpreter) VisitUnary(expr parser.UnaryExpr) (parser.Value, error) {
+	value, err := parser.Accept(expr.Operand, in);
 	if err != nil {
 		return nil, err;
 	}
 	if value == nil {
-		return nil, in.generate_error("cannot apply unary operator on null operand");
+		return nil, in.generate_error(expr.Operand.Span(), "cannot apply unary operator on null operand");
 	}
 	switch expr.Operator.Type {
 		case lexer.BANG: {
@@ -107,26 +153,34 @@ func (in Interpreter) VisitUnary(expr parser.UnaryExpr) (parser.Value, error) {
 			if num, ok := value.(float64); ok {
 				return -num, nil;
 			}
-			return nil, in.generate_error("unary '-' can only be used on numbers");
+			return nil, in.generate_error(expr.Span(), "unary '-' can only be used on numbers");
 		};
 	}
-	return nil, in.generate_error("invalid unary operation, got %s", expr.Operator.Type.ToString());
+	return nil, in.generate_error(expr.Span(), "invalid unary operation, got %s", expr.Operator.Type.ToString());
 }
 
-func (in Interpreter) VisitBinary(expr parser.BinaryExpr) (parser.Value, error) {
-	leftval, err := expr.LOperand.Accept(in);
+func (in *Interpreter) VisitBinary(expr parser.BinaryExpr) (parser.Value, error) {
+	leftval, err := parser.Accept(expr.LOperand, in);
 	if err != nil {
 		return nil, err;
 	}
-	if leftval == nil {
-		return nil, in.generate_error("cannot apply binary operator on null left operand");
+	// comparing with null is the only thing allowed on it
+	equality := expr.Operator.Type == lexer.EQUAL_EQUAL || expr.Operator.Type == lexer.BANG_EQUAL;
+	if leftval == nil && !equality {
+		return nil, in.generate_error(expr.LOperand.Span(), "cannot apply binary operator on null left operand");
 	}
-	rightval, err := expr.ROperand.Accept(in);
+	rightval, err := parser.Accept(expr.ROperand, in);
 	if err != nil {
 		return nil, err;
 	}
+	if equality {
+		if expr.Operator.Type == lexer.EQUAL_EQUAL {
+			return in.equal(leftval, rightval), nil;
+		}
+		return !in.equal(leftval, rightval), nil;
+	}
 	if rightval == nil {
-		return nil, in.generate_error("cannot apply binary operator on null right operand");
+		return nil, in.generate_error(expr.ROperand.Span(), "cannot apply binary operator on null right operand");
 	}
 	switch expr.Operator.Type {
 		case lexer.PLUS: {
@@ -134,83 +188,77 @@ func (in Interpreter) VisitBinary(expr parser.BinaryExpr) (parser.Value, error)
 				if rnum, ok := rightval.(float64); ok {
 					return lnum + rnum, nil;
 				}
-				return nil, in.generate_error("right operand in binary '+' must be number");
+				return nil, in.generate_error(expr.Span(), "right operand in binary '+' must be number");
 			} else if lstr, ok := leftval.(string); ok {
 				if rstr, ok := rightval.(string); ok {
 					return lstr + rstr, nil;
 				}
-				return nil, in.generate_error("right operand in binary '+' must be string");
+				return nil, in.generate_error(expr.Span(), "right operand in binary '+' must be string");
 			}
-			return nil, in.generate_error("operands in binary '+' must be strings or numbers");
+			return nil, in.generate_error(expr.Span(), "operands in binary '+' must be strings or numbers");
 		};
 		case lexer.MINUS: {
 			if rnum, ok := rightval.(float64); ok {
 				if lnum, ok := leftval.(float64); ok {
 					return lnum - rnum, nil;
 				}
-				return nil, in.generate_error("right operand in binary '-' must be number");
+				return nil, in.generate_error(expr.Span(), "right operand in binary '-' must be number");
 			}
-			return nil, in.generate_error("right operand in binary '*' must be number");
+			return nil, in.generate_error(expr.Span(), "right operand in binary '*' must be number");
 		};
 		case lexer.STAR: {
 			if rnum, ok := rightval.(float64); ok {
 				if lnum, ok := leftval.(float64); ok {
 					return lnum * rnum, nil;
 				}
-				return nil, in.generate_error("right operand in binary '*' must be number");
+				return nil, in.generate_error(expr.Span(), "right operand in binary '*' must be number");
 			}
-			return nil, in.generate_error("right operand in binary '*' must be number");
+			return nil, in.generate_error(expr.Span(), "right operand in binary '*' must be number");
 		};
 		case lexer.SLASH: {
 			if rnum, ok := rightval.(float64); ok {
 				if lnum, ok := leftval.(float64); ok {
 					return lnum / rnum, nil;
 				}
-				return nil, in.generate_error("right operand in binary '/' must be number");
+				return nil, in.generate_error(expr.Span(), "right operand in binary '/' must be number");
 			}
-			return nil, in.generate_error("right operand in binary '/' must be number");
-		};
-		case lexer.EQUAL_EQUAL: {
-			return in.equal(leftval, rightval), nil;
-		};
-		case lexer.BANG_EQUAL: {
-			return !in.equal(leftval, rightval), nil;
+			return nil, in.generate_error(expr.Span(), "right operand in binary '/' must be number");
 		};
 		case lexer.GREATER: {
 			if rnum, ok := rightval.(float64); ok {
 				if lnum, ok := leftval.(float64); ok {
 					return lnum > rnum, nil;
 				}
-				return nil, in.generate_error("right operand in binary '>' must be number");
+				return nil, in.generate_error(expr.Span(), "right operand in binary '>' must be number");
 			}
-			return nil, in.generate_error("right operand in binary '>' must be number");
+			return nil, in.generate_error(expr.Span(), "right operand in binary '>' must be number");
 		};
 		case lexer.GREATER_EQUAL: {
 			if rnum, ok := rightval.(float64); ok {
 				if lnum, ok := leftval.(float64); ok {
 					return lnum >= rnum, nil;
 				}
-				return nil, in.generate_error("right operand in binary '>=' must be number");
+				return nil, in.generate_error(expr.Span(), "right operand in binary '>=' must be number");
 			}
-			return nil, in.generate_error("right operand in binary '>=' must be number");
+			return nil, in.generate_error(expr.Span(), "right operand in binary '>=' must be number");
 		};
 		case lexer.LESS: {
 			if rnum, ok := rightval.(float64); ok {
 				if lnum, ok := leftval.(float64); ok {
 					return lnum < rnum, nil;
 				}
-				return nil, in.generate_error("right operand in binary '<' must be number");
+				return nil, in.generate_error(expr.Span(), "right operand in binary '<' must be number");
 			}
-			return nil, in.generate_error("right operand in binary '<' must be number");
+			return nil, in.generate_error(expr.Span(), "right operand in binary '<' must be number");
 		};
 		case lexer.LESS_EQUAL: {
 			if rnum, ok := rightval.(float64); ok {
 				if lnum, ok := leftval.(float64); ok {
 					return lnum <= rnum, nil;
 				}
-				return nil, in.generate_error("right operand in binary '<=' must be number");
+				return nil, in.generate_error(expr.Span(), "right operand in binary '<=' must be number");
 			}
-			return nil, in.generate_error("right operand in binary '<=' must be number");
+			return nil, in.generate_error(expr.Span(), "right operand in binary '<=' must be number");
 		};
 		case lexer.AND: {
 			return in.extract_boolean(leftval) && in.extract_boolean(rightval), nil;
@@ -219,87 +267,221 @@ func (in Interpreter) VisitBinary(expr parser.BinaryExpr) (parser.Value, error)
 			return in.extract_boolean(leftval) || in.extract_boolean(rightval), nil;
 		};
 	}
-	return nil, in.generate_error("invalid binary operation, got %s", expr.Operator.Type.ToString());
+	return nil, in.generate_error(expr.Span(), "invalid binary operation, got %s", expr.Operator.Type.ToString());
 }
 
-func (in Interpreter) VisitTernary(expr parser.TernaryExpr) (parser.Value, error) {
-	condval, err := expr.Cond.Accept(in);
+func (in *Interpreter) VisitTernary(expr parser.TernaryExpr) (parser.Value, error) {
+	condval, err := parser.Accept(expr.Cond, in);
 	if err != nil {
 		return nil, err;
 	}
 	if in.extract_boolean(condval) {
-		value, err := expr.Iftrue.Accept(in);
+		value, err := parser.Accept(expr.Iftrue, in);
 		if err != nil {
 			return nil, err;
 		}
 		return value, nil;
 	}
-	value, err := expr.Iffalse.Accept(in);
+	value, err := parser.Accept(expr.Iffalse, in);
 	if err != nil {
 		return nil, err;
 	}
 	return value, nil;
 }
 
-func (in Interpreter) VisitGroup(expr parser.GroupingExpr) (parser.Value, error) {
-	return expr.InnerExpr.Accept(in);
+func (in *Interpreter) VisitGroup(expr parser.GroupingExpr) (parser.Value, error) {
+	return parser.Accept(expr.InnerExpr, in);
 }
 
-func (in Interpreter) VisitLiteral(expr parser.LiteralExpr) (parser.Value, error) {
-	if str, ok := expr.ValueLiteral.(string); ok {
-		bytes := []byte(str);
-		return string(bytes[1:len(bytes)-1]), nil;
-	}
+func (in *Interpreter) VisitLiteral(expr parser.LiteralExpr) (parser.Value, error) {
 	return expr.ValueLiteral, nil;
 }
 
-func (in Interpreter) VisitVariable(expr parser.VariableExpr) (parser.Value, error) {
-	value, err := in.environment.get(expr.Name.Lexeme);
+// resolved references jump straight to their scope, the rest are either globals
+// or come from an AST that never went through the Resolver
+func (in *Interpreter) lookup(name string, res *parser.Resolution) (parser.Value, error) {
+	if res == nil || !res.Resolved {
+		return in.environment.get(name);
+	}
+	if res.Depth < 0 {
+		return in.globals.get(name);
+	}
+	return in.environment.get_at(res.Depth, name);
+}
+
+func (in *Interpreter) assign(name string, res *parser.Resolution, value parser.Value) error {
+	if res == nil || !res.Resolved {
+		return in.environment.assign(name, value);
+	}
+	if res.Depth < 0 {
+		return in.globals.assign(name, value);
+	}
+	return in.environment.assign_at(res.Depth, name, value);
+}
+
+func (in *Interpreter) VisitVariable(expr parser.VariableExpr) (parser.Value, error) {
+	value, err := in.lookup(expr.Name.Lexeme, expr.Res);
 	if err != nil {
-		return nil, in.generate_error("%s", err.Error());
+		return nil, in.generate_error(expr.Name.Span(), "%s", err.Error());
 	}
 	return value, nil;
 }
 
-func (in Interpreter) VisitAssign(expr parser.AssignExpr) (parser.Value, error) {
-	value, err := expr.Asset.Accept(in);
+func (in *Interpreter) VisitAssign(expr parser.AssignExpr) (parser.Value, error) {
+	value, err := parser.Accept(expr.Asset, in);
 	if err != nil {
 		return nil, err;
 	}
-	err = in.environment.assign(expr.Name.Lexeme, value);
+	err = in.assign(expr.Name.Lexeme, expr.Res, value);
 	if err != nil {
-		return nil, err;
+		return nil, in.generate_error(expr.Name.Span(), "%s", err.Error());
 	}
 	return value, nil;
 }
 
-func (in Interpreter) VisitFuncCall(expr parser.FuncCall) (parser.Value, error) {
-	val, err := expr.Callee.Accept(in);
+func (in *Interpreter) VisitFuncCall(expr parser.FuncCall) (parser.Value, error) {
+	val, err := parser.Accept(expr.Callee, in);
 	if err != nil {
 		return nil, err;
 	}
+	if val == nil && expr.Optional {
+		return nil, short_circuit;
+	}
 	fn, callable_ok := val.(Callable);
 	if !callable_ok {
-		return nil, in.generate_error("invalid callee target");
+		return nil, in.generate_error(expr.Callee.Span(), "invalid callee target");
 	}
 	if int(fn.Arity()) != len(expr.Args) {
-		return nil, in.generate_error("expected %d arguments got %d", fn.Arity(), len(expr.Args));
+		return nil, in.generate_error(expr.Span(), "expected %d arguments got %d", fn.Arity(), len(expr.Args));
 	}
 	args := make([]parser.Value, fn.Arity());
 	for i := range fn.Arity() {
-		val, err := expr.Args[i].Accept(in);
+		val, err := parser.Accept(expr.Args[i], in);
 		if err != nil {
 			return nil, err;
 		}
 		args[i] = val;
 	}
-	return fn.Execute(in, args);
+	val, err = fn.Execute(in, args);
+	// errors of natives know nothing about the source
+	var diag *lexer.Diagnostic;
+	if err != nil && !errors.As(err, &diag) {
+		return nil, in.generate_error(expr.Span(), "%s", err.Error());
+	}
+	return val, err;
+}
+
+func (in *Interpreter) VisitCoalesce(expr parser.CoalesceExpr) (parser.Value, error) {
+	leftval, err := parser.Accept(expr.LOperand, in);
+	if err != nil {
+		return nil, err;
+	}
+	if leftval != nil {
+		return leftval, nil;
+	}
+	return parser.Accept(expr.ROperand, in);
+}
+
+func (in *Interpreter) VisitTuple(expr parser.TupleExpr) (parser.Value, error) {
+	tup := make(Tuple, len(expr.Elements));
+	for i, element := range expr.Elements {
+		val, err := parser.Accept(element, in);
+		if err != nil {
+			return nil, err;
+		}
+		tup[i] = val;
+	}
+	return tup, nil;
+}
+
+func (in *Interpreter) VisitIndex(expr parser.IndexExpr) (parser.Value, error) {
+	val, err := parser.Accept(expr.Object, in);
+	if err != nil {
+		return nil, err;
+	}
+	if val == nil && expr.Optional {
+		return nil, short_circuit;
+	}
+	tup, ok := val.(Tuple);
+	if !ok {
+		return nil, in.generate_error(expr.Object.Span(), "only tuples can be indexed");
+	}
+	index, err := parser.Accept(expr.Index, in);
+	if err != nil {
+		return nil, err;
+	}
+	num, ok := index.(float64);
+	if !ok || num != float64(int(num)) {
+		return nil, in.generate_error(expr.Index.Span(), "tuple index must be an integer");
+	}
+	if num < 0 || int(num) >= len(tup) {
+		return nil, in.generate_error(expr.Index.Span(), "tuple index %d out of range [0, %d)", int(num), len(tup));
+	}
+	return tup[int(num)], nil;
 }
 
-func (in Interpreter) VisitReturn(stmt parser.ReturnStmt) (parser.Value, error) {
+func (in *Interpreter) VisitGet(expr parser.GetExpr) (parser.Value, error) {
+	val, err := parser.Accept(expr.Object, in);
+	if err != nil {
+		return nil, err;
+	}
+	if val == nil && expr.Optional {
+		return nil, short_circuit;
+	}
+	instance, ok := val.(*Instance);
+	if !ok {
+		return nil, in.generate_error(expr.Object.Span(), "only instances have properties");
+	}
+	property, ok := instance.get(expr.Name.Lexeme);
+	if !ok {
+		return nil, in.generate_error(expr.Name.Span(), "%s has no property '%s'", instance, expr.Name.Lexeme);
+	}
+	return property, nil;
+}
+
+func (in *Interpreter) VisitSet(expr parser.SetExpr) (parser.Value, error) {
+	val, err := parser.Accept(expr.Object, in);
+	if err != nil {
+		return nil, err;
+	}
+	instance, ok := val.(*Instance);
+	if !ok {
+		return nil, in.generate_error(expr.Object.Span(), "only instances have fields");
+	}
+	if current := instance.fields[expr.Name.Lexeme]; current != nil && expr.Operator.Type == lexer.QUESTION_QUESTION_EQUAL {
+		return current, nil;
+	}
+	value, err := parser.Accept(expr.Asset, in);
+	if err != nil {
+		return nil, err;
+	}
+	instance.fields[expr.Name.Lexeme] = value;
+	return value, nil;
+}
+
+func (in *Interpreter) VisitThis(expr parser.ThisExpr) (parser.Value, error) {
+	value, err := in.lookup(expr.Keyword.Lexeme, expr.Res);
+	if err != nil {
+		return nil, in.generate_error(expr.Keyword.Span(), "'this' should only be used inside a method");
+	}
+	return value, nil;
+}
+
+func (in *Interpreter) VisitOptionalChain(expr parser.OptionalChainExpr) (parser.Value, error) {
+	val, err := parser.Accept(expr.Chain, in);
+	if err != nil {
+		if errors.Is(err, short_circuit) {
+			return nil, nil;
+		}
+		return nil, err;
+	}
+	return val, nil;
+}
+
+func (in *Interpreter) VisitReturn(stmt parser.ReturnStmt) (parser.Value, error) {
 	var ( val parser.Value; err error = nil; );
 	if stmt.Asset != nil {
-		val, err = stmt.Asset.Accept(in);
+		val, err = parser.Accept(stmt.Asset, in);
 		if err != nil {
 			return nil, err;
 		}
@@ -307,52 +489,128 @@ func (in Interpreter) VisitReturn(stmt parser.ReturnStmt) (parser.Value, error)
 	return nil, &ReturnError{ val: val };
 }
 
-func (in Interpreter) VisitBreak(_ parser.BreakStmt) (parser.Value, error) {
+func (in *Interpreter) VisitBreak(_ parser.BreakStmt) (parser.Value, error) {
 	return nil, BreakError;
 }
 
-func (in Interpreter) VisitContinue(_ parser.ContinueStmt) (parser.Value, error) {
+func (in *Interpreter) VisitContinue(_ parser.ContinueStmt) (parser.Value, error) {
 	return nil, ContinueError;
 }
 
 // statements
-func (in Interpreter) VisitExpr(stmt parser.ExprStmt) (parser.Value, error) {
-	return stmt.InnerExpr.Accept(in);
+func (in *Interpreter) VisitExpr(stmt parser.ExprStmt) (parser.Value, error) {
+	return parser.Accept(stmt.InnerExpr, in);
 }
 
-func (in Interpreter) VisitVariableDeclaration(stmt parser.VarDeclarationStmt) (parser.Value, error) {
+func (in *Interpreter) VisitVariableDeclaration(stmt parser.VarDeclarationStmt) (parser.Value, error) {
 	var (
 		err error
 		value parser.Value = nil;
 	);
 	if stmt.Asset != nil {
-		value, err = stmt.Asset.Accept(in);
+		value, err = parser.Accept(stmt.Asset, in);
 		if err != nil {
 			return nil, err;
 		}
 	}
 	err = in.environment.declare(stmt.Name.Lexeme, value);
 	if err != nil {
-		return nil, in.generate_error("%s", err.Error());
+		return nil, in.generate_error(stmt.Name.Span(), "%s", err.Error());
 	}
 	return nil, nil;
 }
 
-func (in Interpreter) VisitFuncDeclarationStmt(stmt parser.FuncDeclarationStmt) (parser.Value, error) {
+func (in *Interpreter) VisitVarUnpack(stmt parser.VarUnpackStmt) (parser.Value, error) {
+	value, err := parser.Accept(stmt.Asset, in);
+	if err != nil {
+		return nil, err;
+	}
+	tup, ok := value.(Tuple);
+	if !ok {
+		return nil, in.generate_error(stmt.Asset.Span(), "cannot unpack non-tuple value into %d variables", len(stmt.Names));
+	}
+	if len(tup) != len(stmt.Names) {
+		return nil, in.generate_error(stmt.Asset.Span(), "cannot unpack tuple of %d values into %d variables", len(tup), len(stmt.Names));
+	}
+	for i, name := range stmt.Names {
+		if err := in.environment.declare(name.Lexeme, tup[i]); err != nil {
+			return nil, in.generate_error(name.Span(), "%s", err.Error());
+		}
+	}
+	return nil, nil;
+}
+
+func (in *Interpreter) VisitFuncDeclarationStmt(stmt parser.FuncDeclarationStmt) (parser.Value, error) {
 	err := in.environment.declare(stmt.Name.Lexeme, AMLFunc{
 		closure: in.environment,
 		internal: parser.Func(stmt),
 	});
 	if err != nil {
-		return nil, in.generate_error("%s", err.Error());
+		return nil, in.generate_error(stmt.Name.Span(), "%s", err.Error());
+	}
+	return nil, nil;
+}
+
+// conformance is checked here rather than on the first call of a missing method
+func (in *Interpreter) VisitClass(stmt parser.ClassStmt) (parser.Value, error) {
+	class := &Class{
+		name: stmt.Name.Lexeme,
+		methods: make(map[string]AMLFunc),
+		traits: make([]*Trait, 0, len(stmt.Traits)),
+	};
+	decls := make([]parser.TraitStmt, 0, len(stmt.Traits));
+	for _, name := range stmt.Traits {
+		val, err := in.VisitVariable(name);
+		if err != nil {
+			return nil, err;
+		}
+		trait, ok := val.(*Trait);
+		if !ok {
+			return nil, in.generate_error(name.Name.Span(), "'%s' is not a trait", name.Name.Lexeme);
+		}
+		class.traits = append(class.traits, trait);
+		decls = append(decls, trait.decl);
+	}
+	if problems := Conformance(stmt, decls); len(problems) != 0 {
+		return nil, in.generate_error(stmt.Name.Span(), "%s", problems[0]);
+	}
+	for _, trait := range class.traits {
+		for _, method := range trait.decl.Defaults {
+			if _, ok := class.methods[method.Name.Lexeme]; !ok {
+				class.methods[method.Name.Lexeme] = AMLFunc{
+					closure: trait.closure,
+					internal: method,
+				};
+			}
+		}
+	}
+	for _, method := range stmt.Methods {
+		class.methods[method.Name.Lexeme] = AMLFunc{
+			closure: in.environment,
+			internal: method,
+		};
+	}
+	if err := in.environment.declare(stmt.Name.Lexeme, class); err != nil {
+		return nil, in.generate_error(stmt.Name.Span(), "%s", err.Error());
+	}
+	return nil, nil;
+}
+
+func (in *Interpreter) VisitTrait(stmt parser.TraitStmt) (parser.Value, error) {
+	err := in.environment.declare(stmt.Name.Lexeme, &Trait{
+		decl: stmt,
+		closure: in.environment,
+	});
+	if err != nil {
+		return nil, in.generate_error(stmt.Name.Span(), "%s", err.Error());
 	}
 	return nil, nil;
 }
 
-func (in Interpreter) VisitPrint(stmt parser.PrintStmt) (parser.Value, error) {
+func (in *Interpreter) VisitPrint(stmt parser.PrintStmt) (parser.Value, error) {
 	builder := strings.Builder{};
 	for i, asset := range stmt.Assets {
-		val, err := asset.Accept(in);
+		val, err := parser.Accept(asset, in);
 		if err != nil {
 			return nil, err;
 		}
@@ -365,7 +623,7 @@ func (in Interpreter) VisitPrint(stmt parser.PrintStmt) (parser.Value, error) {
 	return nil, nil;
 }
 
-func (in Interpreter) VisitBlock(block parser.BlockStmt) (parser.Value, error) {
+func (in *Interpreter) VisitBlock(block parser.BlockStmt) (parser.Value, error) {
 	var (
 		val parser.Value = nil;
 		env = NewEnvironment(in.environment);
@@ -373,11 +631,11 @@ func (in Interpreter) VisitBlock(block parser.BlockStmt) (parser.Value, error) {
 	// create new environment
 	in.environment = env;
 	defer func () {
-		in.environment = in.environment.prev;
+		in.environment = env.prev;
 	}();
 	// execute all environment statements
 	for _, stmt := range block.Stmts {
-		sval, err := stmt.Accept(in);
+		sval, err := parser.AcceptStmt(stmt, in);
 		if err != nil {
 			return nil, err;
 		}
@@ -388,10 +646,10 @@ func (in Interpreter) VisitBlock(block parser.BlockStmt) (parser.Value, error) {
 	return val, nil;
 }
 
-func (in Interpreter) VisitConditional(stmt parser.ConditionalStmt) (parser.Value, error) {
+func (in *Interpreter) VisitConditional(stmt parser.ConditionalStmt) (parser.Value, error) {
 	for _, branch := range stmt.Branches {
 		if branch.Condition != nil {
-			val, err := branch.Condition.Accept(in);
+			val, err := parser.Accept(branch.Condition, in);
 			if err != nil {
 				return nil, err;
 			}
@@ -399,7 +657,7 @@ func (in Interpreter) VisitConditional(stmt parser.ConditionalStmt) (parser.Valu
 				continue;
 			}
 		}
-		_, err := branch.NDStmt.Accept(in);
+		_, err := parser.AcceptStmt(branch.NDStmt, in);
 		if err != nil {
 			return nil, err;
 		}
@@ -408,18 +666,18 @@ func (in Interpreter) VisitConditional(stmt parser.ConditionalStmt) (parser.Valu
 	return nil, nil;
 }
 
-func (in Interpreter) VisitWhile(stmt parser.WhileStmt) (parser.Value, error) {
+func (in *Interpreter) VisitWhile(stmt parser.WhileStmt) (parser.Value, error) {
 	var (
 		err error = nil;
 		val parser.Value = nil;
 	);
 loop:
-	cond, err := stmt.Cond.Accept(in)
+	cond, err := parser.Accept(stmt.Cond, in)
 	if err != nil {
 		return nil, err;
 	}
 	if in.extract_boolean(cond) {
-		val, err = stmt.NDStmt.Accept(in);
+		val, err = parser.AcceptStmt(stmt.NDStmt, in);
 		if err != nil {
 			if errors.Is(err, BreakError) {
 				goto exit_loop;
@@ -434,27 +692,27 @@ exit_loop:
 	return val, nil;
 }
 
-func (in Interpreter) VisitFor(stmt parser.ForStmt) (parser.Value, error) {
+func (in *Interpreter) VisitFor(stmt parser.ForStmt) (parser.Value, error) {
 	var (
 		err error = nil;
 		val parser.Value = nil;
 		cond parser.Value = true;
 	);
 	if stmt.Init != nil {
-		_, err = stmt.Init.Accept(in);
+		_, err = parser.AcceptStmt(stmt.Init, in);
 		if err != nil {
 			return nil, err;
 		}
 	}
 loop:
 	if stmt.Cond != nil {
-		cond, err = stmt.Cond.Accept(in)
+		cond, err = parser.Accept(stmt.Cond, in)
 		if err != nil {
 			return nil, err;
 		}
 	}
 	if in.extract_boolean(cond) {
-		val, err = stmt.NDStmt.Accept(in);
+		val, err = parser.AcceptStmt(stmt.NDStmt, in);
 		if err != nil {
 			if errors.Is(err, BreakError) {
 				goto exit_loop;
@@ -464,7 +722,7 @@ loop:
 			}
 		}
 		if stmt.Step != nil {
-			_, err = stmt.Step.Accept(in);
+			_, err = parser.Accept(stmt.Step, in);
 			if err != nil {
 				return nil, err;
 			}
@@ -475,20 +733,24 @@ exit_loop:
 	return val, nil;
 }
 
-func NewInterpreter() Interpreter {
+// the interpreter is passed around by pointer, boxing a copy of it
+// in every Accept would allocate once per node visited
+func NewInterpreter(filename string) *Interpreter {
 	global_env := NewEnvironment(nil);
 	for key, val := range GetStdFuncs() {
 		global_env.declare(key, val);
 	}
-	return Interpreter {
+	return &Interpreter {
+		filename: filename,
 		environment: global_env,
+		globals: global_env,
 	};
 }
 
-func (in Interpreter) Interpret(stmts []parser.Stmt) (parser.Value, error) {
+func (in *Interpreter) Interpret(stmts []parser.Stmt) (parser.Value, error) {
 	var val parser.Value;
 	for _, stmt := range stmts {
-		sval, err := stmt.Accept(in);
+		sval, err := parser.AcceptStmt(stmt, in);
 		if err != nil {
 			return nil, err;
 		}
@@ -0,0 +1,315 @@
+package interpreter_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	analyzer "aml/analyser"
+	"aml/interpreter"
+	"aml/lexer"
+	"aml/parser"
+)
+
+// a loop over resolved variables, every iteration visits a dozen nodes
+const loop_source = `
+var i = 0;
+var total = 0;
+while (i < 100000) {
+	total = total + i;
+	i = i + 1;
+}
+`;
+
+func parse(tb testing.TB, source string) []parser.Stmt {
+	stmts, errs := parser.NewStreamParser("bench.aml", lexer.NewScanner("bench.aml", source)).Parse();
+	if len(errs) != 0 {
+		tb.Fatal(errs[0]);
+	}
+	if errs := analyzer.NewResolver("bench.aml").Resolve(stmts); len(errs) != 0 {
+		tb.Fatal(errs[0]);
+	}
+	return stmts;
+}
+
+// an iteration allocates its block's environment (a struct and its map) and boxes the new
+// values of total and i. boxing the interpreter in every Accept adds one allocation per node
+func TestWhileLoopAllocs(t *testing.T) {
+	stmts := parse(t, loop_source);
+	allocs := testing.AllocsPerRun(5, func() {
+		interpreter.NewInterpreter("test.aml").Interpret(stmts);
+	});
+	if per_iteration := allocs / 100000; per_iteration > 4.5 {
+		t.Errorf("%.1f allocations per iteration, want at most 4", per_iteration);
+	}
+}
+
+// allocations per op stay at the environments and values the loop makes,
+// visiting a node must not allocate
+func BenchmarkWhileLoop(b *testing.B) {
+	stmts := parse(b, loop_source);
+	b.ReportAllocs();
+	for i := 0; i < b.N; i++ {
+		if _, err := interpreter.NewInterpreter("bench.aml").Interpret(stmts); err != nil {
+			b.Fatal(err);
+		}
+	}
+}
+
+// a loop a few scopes below the variables it uses, by name every lookup hashes the name
+// in each scope on the way up, a resolved one only in the scope the Resolver found
+const nested_source = `
+func run(step) {
+	var total = 0;
+	{ var a = 1; { var b = 2; { var c = 3; { var d = 4;
+		var i = 0;
+		while (i < 20000) {
+			total = total + step;
+			i = i + step;
+		}
+	} } } }
+	return total;
+}
+run(1);
+`;
+
+func BenchmarkLookups(b *testing.B) {
+	resolved := parse(b, nested_source);
+	by_name, errs := parser.NewStreamParser("bench.aml", lexer.NewScanner("bench.aml", nested_source)).Parse();
+	if len(errs) != 0 {
+		b.Fatal(errs[0]);
+	}
+	for _, bench := range []struct {
+		name string;
+		stmts []parser.Stmt;
+	}{ { "resolved", resolved }, { "by name", by_name } } {
+		b.Run(bench.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := interpreter.NewInterpreter("bench.aml").Interpret(bench.stmts); err != nil {
+					b.Fatal(err);
+				}
+			}
+		});
+	}
+}
+
+// the value of the last expression statement of each source, run one after the other like REPL lines
+func run(t *testing.T, sources ...string) (parser.Value, error) {
+	t.Helper();
+	in := interpreter.NewInterpreter("test.aml");
+	var (
+		val parser.Value
+		err error
+	);
+	for _, source := range sources {
+		if val, err = in.Interpret(parse(t, source)); err != nil {
+			return nil, err;
+		}
+	}
+	return val, nil;
+}
+
+const printable = `
+trait Printable {
+	to_string();
+	show() { return "<" + this.to_string() + ">"; }
+}
+`;
+
+func TestTraits(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+		want parser.Value;
+	}{
+		{ "required method", printable + `class Doc implements Printable { to_string() { return "doc"; } } Doc().to_string();`, "doc" },
+		{ "inherited default", printable + `class Doc implements Printable { to_string() { return "doc"; } } Doc().show();`, "<doc>" },
+		{
+			"overridden default", printable + `class Doc implements Printable { to_string() { return "doc"; } show() { return "!"; } } Doc().show();`,
+			"!",
+		},
+		{ "init and fields", `class P { init(x) { this.x = x; } get() { return this.x; } } var p = P(2); p.x = p.x + 1; p.get();`, float64(3) },
+		{ "fields shadow methods", `class P { f() { return 1; } } var p = P(); p.f = 2; p.f;`, float64(2) },
+		{ "optional property", `var p = null; p?.x;`, nil },
+		{ "implements", printable + `class Doc implements Printable { to_string() { return ""; } } implements(Doc(), Printable);`, true },
+		{ "implements a class", printable + `class Doc implements Printable { to_string() { return ""; } } implements(Doc, Printable);`, true },
+		// nominal: having the methods is not enough
+		{ "not declared", printable + `class Doc { to_string() { return ""; } } implements(Doc(), Printable);`, false },
+		{ "not an instance", printable + `implements(1, Printable);`, false },
+		{ "trait in a variable", printable + `var P = Printable; class Doc implements P { to_string() { return ""; } } implements(Doc(), Printable);`, true },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := run(t, test.source);
+			if err != nil {
+				t.Fatalf("unexpected error %v", err);
+			}
+			if got != test.want {
+				t.Errorf("got %v, want %v", got, test.want);
+			}
+		});
+	}
+}
+
+// traits declared by an earlier line are unknown to the Resolver, the class declaration itself fails
+func TestTraitConformance(t *testing.T) {
+	tests := []struct {
+		name string;
+		traits string;
+		class string;
+		want string;
+	}{
+		{ "missing method", printable, `class Doc implements Printable {}`, "class 'Doc' does not implement 'to_string' required by trait 'Printable'" },
+		{
+			"arity", printable, `class Doc implements Printable { to_string(x) { return x; } }`,
+			"'Doc.to_string' takes 1 parameters, trait 'Printable' requires 0",
+		},
+		{
+			"conflicting defaults", `trait A { f() { return 1; } } trait B { f() { return 2; } }`, `class C implements A, B {}`,
+			"class 'C' inherits 'f' from both 'A' and 'B', it must define its own",
+		},
+		{ "conflict resolved", `trait A { f() { return 1; } } trait B { f() { return 2; } }`, `class C implements A, B { f() { return 3; } }`, "" },
+		{ "not a trait", `var A = 1;`, `class C implements A {}`, "'A' is not a trait" },
+		{ "property of a number", `var A = 1;`, `A.x;`, "only instances have properties" },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := run(t, test.traits, test.class);
+			var diag *lexer.Diagnostic;
+			if test.want == "" {
+				if err != nil {
+					t.Fatalf("unexpected error %v", err);
+				}
+				return;
+			}
+			if !errors.As(err, &diag) || diag.Message != test.want {
+				t.Errorf("got %v, want %q", err, test.want);
+			}
+		});
+	}
+}
+
+// references are bound to the scope the Resolver found them in, or looked up as globals
+func TestResolvedLookups(t *testing.T) {
+	const parity = `
+	func even(n) { if (n == 0) return true; return odd(n - 1); }
+	func odd(n) { if (n == 0) return false; return even(n - 1); }`;
+	tests := []struct {
+		name string;
+		source string;
+		want parser.Value;
+	}{
+		{ "global mutual recursion", parity + ` even(4);`, true },
+		{ "local mutual recursion", `func outer() {` + parity + ` return even(4); } outer();`, true },
+		{ "local mutual recursion in a block", `var r; {` + parity + ` r = odd(3); } r;`, true },
+		{ "local function shadows a global", `func odd(n) { return "global"; } func outer() {` + parity + ` return even(3); } outer();`, false },
+		// only functions are known ahead of their declaration
+		{ "variable declared after the closure", `var x = "global"; var r; { func f() { return x; } r = f(); var x = "local"; } r;`, "global" },
+		{ "closure over a parameter", `func adder(a) { func add(b) { return a + b; } return add; } adder(1)(2);`, float64(3) },
+		{ "assignment to an outer variable", `var n = 0; func inc() { { n = n + 1; } } inc(); inc(); n;`, float64(2) },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := run(t, test.source);
+			if err != nil {
+				t.Fatalf("unexpected error %v", err);
+			}
+			if got != test.want {
+				t.Errorf("got %v, want %v", got, test.want);
+			}
+		});
+	}
+}
+
+const box = `class Box { init(v) { this.v = v; } get() { return this.v; } } var b = Box(1); var n = null;`;
+
+func TestNullOperators(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+		want parser.Value;
+	}{
+		{ "coalesce null", `null ?? 2;`, float64(2) },
+		{ "coalesce value", `1 ?? 2;`, float64(1) },
+		{ "coalesce false", `false ?? 2;`, false },
+		{ "coalesce skips the right operand", `var x = 1; x ?? (x = 2); x;`, float64(1) },
+		{ "optional property", box + `b?.v;`, float64(1) },
+		{ "optional property on null", box + `n?.v;`, nil },
+		// the rest of the chain is skipped, not evaluated on null
+		{ "short-circuited chain", box + `n?.v.w.get();`, nil },
+		{ "optional method call", box + `b?.get();`, float64(1) },
+		{ "optional index", `func pair() { return 1, 2; } var t = pair(); t?.[1];`, float64(2) },
+		{ "optional index on null", `var t = null; t?.[1];`, nil },
+		{ "optional call", `func f() { return 3; } f?.();`, float64(3) },
+		{ "optional call on null", `var f = null; f?.();`, nil },
+		{ "optional call skips its arguments", `var f = null; var x = 0; f?.(x = 1); x;`, float64(0) },
+		{ "chain then coalesce", box + `n?.v ?? 4;`, float64(4) },
+		{ "coalescing assignment", `var x; x ??= 5; x ??= 6; x;`, float64(5) },
+		{ "coalescing assignment to a property", box + `b.w ??= 3; b.w ??= 4; b.w;`, float64(3) },
+		{ "coalescing assignment keeps a property", box + `b.v ??= 3;`, float64(1) },
+		{ "coalescing assignment evaluates its object once", box + `var calls = 0; func f() { calls = calls + 1; return b; } f().w ??= 1; calls;`, float64(1) },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := run(t, test.source);
+			if err != nil {
+				t.Fatalf("unexpected error %v", err);
+			}
+			if got != test.want {
+				t.Errorf("got %v, want %v", got, test.want);
+			}
+		});
+	}
+}
+
+const divmod = `func divmod(a, b) { var q = 0; while (a >= b) { a = a - b; q = q + 1; } return q, a; }`;
+
+func TestTuples(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+		want string; // printed
+	}{
+		{ "returned", divmod + ` divmod(7, 2);`, "(3, 1)" },
+		{ "unpacked", divmod + ` var q, r = divmod(7, 2); q + r * 10;`, "13" },
+		{ "indexed", divmod + ` var t = divmod(7, 2); t[0];`, "3" },
+		{ "last element", divmod + ` divmod(7, 2)[1];`, "1" },
+		{ "nested", `func f() { return 1, "a"; } func g() { return f(), true; } g();`, "((1, a), true)" },
+		{ "equal", divmod + ` divmod(7, 2) == divmod(10, 3);`, "true" },
+		{ "not equal", divmod + ` divmod(7, 2) == divmod(9, 2);`, "false" },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := run(t, test.source);
+			if err != nil {
+				t.Fatalf("unexpected error %v", err);
+			}
+			if str := fmt.Sprint(got); str != test.want {
+				t.Errorf("got %s, want %s", str, test.want);
+			}
+		});
+	}
+}
+
+func TestTupleErrors(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+		want string;
+	}{
+		{ "unpack too many", divmod + ` var a, b, c = divmod(7, 2);`, "cannot unpack tuple of 2 values into 3 variables" },
+		{ "unpack a number", `var a, b = 1;`, "cannot unpack non-tuple value into 2 variables" },
+		{ "out of range", divmod + ` divmod(7, 2)[2];`, "tuple index 2 out of range [0, 2)" },
+		{ "fractional index", divmod + ` divmod(7, 2)[0.5];`, "tuple index must be an integer" },
+		{ "index a number", `var n = 1; n[0];`, "only tuples can be indexed" },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := run(t, test.source);
+			var diag *lexer.Diagnostic;
+			if !errors.As(err, &diag) || diag.Message != test.want {
+				t.Errorf("got %v, want %q", err, test.want);
+			}
+		});
+	}
+}
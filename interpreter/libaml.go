@@ -3,23 +3,36 @@ package interpreter
 import (
 	"aml/parser"
 	"bufio"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"strings"
 	"time"
 );
 
 type StdRead struct {};
 
+// shared by every call, a reader of its own would buffer the lines after the one it returns and lose them
+var stdin = bufio.NewReader(os.Stdin);
+
 func (StdRead) Arity() byte {
 	return 0;
 }
 
-func (StdRead) Execute(Interpreter, []parser.Value) (parser.Value, error) {
-	reader := bufio.NewReader(os.Stdin);
-	bytes, err := reader.ReadString('\n');
+// returns (line, ok), ok is false once stdin reached EOF
+// so that it can be told apart from an empty line
+func (StdRead) Execute(*Interpreter, []parser.Value) (parser.Value, error) {
+	line, err := stdin.ReadString('\n');
 	if err != nil {
-		return "", err;
+		if errors.Is(err, io.EOF) && len(line) == 0 {
+			return Tuple{ "", false }, nil;
+		}
+		if !errors.Is(err, io.EOF) {
+			return nil, err;
+		}
 	}
-	return string(bytes[0:len(bytes)-1]), nil;
+	return Tuple{ strings.TrimSuffix(line, "\n"), true }, nil;
 }
 
 func (StdRead) String() string {
@@ -32,7 +45,7 @@ func (StdTime) Arity() byte {
 	return 0;
 }
 
-func (StdTime) Execute(Interpreter, []parser.Value) (parser.Value, error) {
+func (StdTime) Execute(*Interpreter, []parser.Value) (parser.Value, error) {
 	return float64(time.Now().UnixNano()), nil;
 }
 
@@ -40,9 +53,34 @@ func (StdTime) String() string {
 	return "native: stdtime/0";
 }
 
+type StdImplements struct {};
+
+func (StdImplements) Arity() byte {
+	return 2;
+}
+
+// implements(value, trait) tells whether value is an instance of a class,
+// or a class, declared with "implements trait"
+func (StdImplements) Execute(_ *Interpreter, args []parser.Value) (parser.Value, error) {
+	trait, ok := args[1].(*Trait);
+	if !ok {
+		return nil, fmt.Errorf("implements expects a trait as its second argument, got %v", args[1]);
+	}
+	switch value := args[0].(type) {
+		case *Instance: return value.class.implements(trait), nil;
+		case *Class: return value.implements(trait), nil;
+	}
+	return false, nil;
+}
+
+func (StdImplements) String() string {
+	return "native: stdimplements/2";
+}
+
 func GetStdFuncs() map[string]parser.Value {
 	return map[string]parser.Value{
 		"read": StdRead{},
 		"time": StdTime{},
+		"implements": StdImplements{},
 	};
 }
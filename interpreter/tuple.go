@@ -0,0 +1,25 @@
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+
+	"aml/parser"
+);
+
+// immutable sequence of values, produced by `return a, b;`
+// and by natives that need to return more than one value
+type Tuple []parser.Value;
+
+func (tup Tuple) String() string {
+	builder := strings.Builder{};
+	builder.WriteString("(");
+	for i, val := range tup {
+		if i != 0 {
+			builder.WriteString(", ");
+		}
+		builder.WriteString(fmt.Sprint(val));
+	}
+	builder.WriteString(")");
+	return builder.String();
+}
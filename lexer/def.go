@@ -9,12 +9,55 @@ type Token struct {
 	Lexeme string
 	Literal any
 	Line uint
+	Column uint
+	Offset uint // in bytes
+	End Pos // right after the last rune of the lexeme
+	Doc string // `///` comment lines right above the token, without the slashes
+	Inserted bool // a ';' the scanner put at a line break, it is not in the source
+
+	// only kept by a scanner with KeepTrivia
+	Raw string // the source text when it differs from Lexeme, identifiers are normalized
+	Leading []Trivia // up to the token, starting at the first line break after the previous one
+	Trailing []Trivia // after the token, up to the next line break
+};
+
+// Text is the token as written in the source
+func (t Token) Text() string {
+	if t.Inserted {
+		return "";
+	}
+	if t.Raw != "" {
+		return t.Raw;
+	}
+	return t.Lexeme;
+}
+
+type TriviaKind uint;
+const (
+	WHITESPACE TriviaKind = iota
+	NEWLINE
+	COMMENT
+);
+
+// Trivia is source text that is not a token: whitespace, line breaks and comments
+type Trivia struct {
+	Kind TriviaKind
+	Text string
+	Span Span
 };
 
 func (t Token) String() string {
 	return fmt.Sprintf("%s %s %s", t.Type.ToString(), string(t.Lexeme), t.Literal);
 }
 
+func (t Token) Pos() Pos {
+	return Pos{ Offset: t.Offset, Line: t.Line, Column: t.Column };
+}
+
+func (t Token) Span() Span {
+	return Span{ Start: t.Pos(), End: t.End };
+}
+
 type TokenType uint;
 const (
 	// Single-character tokens.
@@ -22,6 +65,8 @@ const (
 	RIGHT_PAREN
 	LEFT_BRACE
 	RIGHT_BRACE
+	LEFT_BRACKET
+	RIGHT_BRACKET
 	COMMA
 	DOT
 	MINUS
@@ -31,6 +76,7 @@ const (
 	STAR
 	QUESTION
 	COLON
+	PIPE
 
 	// One or two character tokens.
 	BANG
@@ -41,6 +87,12 @@ const (
 	GREATER_EQUAL
 	LESS
 	LESS_EQUAL
+	QUESTION_QUESTION
+	QUESTION_DOT
+	PIPE_GREATER
+
+	// Three character tokens.
+	QUESTION_QUESTION_EQUAL
 
 	// Literals.
 	IDENTIFIER
@@ -63,6 +115,7 @@ const (
 	FUNC	
 	RETURN
 	CLASS
+	TRAIT
 	THIS
 	SUPER
 	PRINT
@@ -71,26 +124,31 @@ const (
 );
 
 // subject to change
-var keywords_map = map[string]TokenType {
-	"and": AND,
-	"class": CLASS,
-	"else": ELSE,
-	"func": FUNC,
-	"for": FOR,
-	"break": BREAK,
-	"continue": CONTINUE,
-	"if": IF,
-	"null": NULL,
-	"or": OR,
-	"return": RETURN,
-	"super": SUPER,
-	"print": PRINT,
-	"this": THIS,
-	"true": TRUE,
-	"false": FALSE,
-	"var": VAR,
-	"while": WHILE,
-};
+// a switch rather than a map, the compiler turns it into a search over the lengths and bytes
+func keyword(name string) (TokenType, bool) {
+	switch name {
+		case "and": return AND, true;
+		case "class": return CLASS, true;
+		case "else": return ELSE, true;
+		case "func": return FUNC, true;
+		case "for": return FOR, true;
+		case "break": return BREAK, true;
+		case "continue": return CONTINUE, true;
+		case "if": return IF, true;
+		case "null": return NULL, true;
+		case "or": return OR, true;
+		case "return": return RETURN, true;
+		case "super": return SUPER, true;
+		case "print": return PRINT, true;
+		case "this": return THIS, true;
+		case "trait": return TRAIT, true;
+		case "true": return TRUE, true;
+		case "false": return FALSE, true;
+		case "var": return VAR, true;
+		case "while": return WHILE, true;
+	}
+	return IDENTIFIER, false;
+}
 
 func (tt TokenType) ToString() string {
 	switch tt {
@@ -102,6 +160,10 @@ func (tt TokenType) ToString() string {
 		return "LEFT_BRACE"
 	case RIGHT_BRACE:
 		return "RIGHT_BRACE"
+	case LEFT_BRACKET:
+		return "LEFT_BRACKET"
+	case RIGHT_BRACKET:
+		return "RIGHT_BRACKET"
 	case COMMA:
 		return "COMMA"
 	case DOT:
@@ -120,6 +182,8 @@ func (tt TokenType) ToString() string {
 		return "QUESTION"
 	case COLON:
 		return "COLON"
+	case PIPE:
+		return "PIPE"
 	case BANG:
 		return "BANG"
 	case BANG_EQUAL:
@@ -136,6 +200,14 @@ func (tt TokenType) ToString() string {
 		return "LESS"
 	case LESS_EQUAL:
 		return "LESS_EQUAL"
+	case QUESTION_QUESTION:
+		return "QUESTION_QUESTION"
+	case QUESTION_DOT:
+		return "QUESTION_DOT"
+	case PIPE_GREATER:
+		return "PIPE_GREATER"
+	case QUESTION_QUESTION_EQUAL:
+		return "QUESTION_QUESTION_EQUAL"
 	case IDENTIFIER:
 		return "IDENTIFIER"
 	case STRING:
@@ -146,6 +218,8 @@ func (tt TokenType) ToString() string {
 		return "AND"
 	case CLASS:
 		return "CLASS"
+	case TRAIT:
+		return "TRAIT"
 	case ELSE:
 		return "ELSE"
 	case FALSE:
@@ -0,0 +1,68 @@
+package lexer
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+);
+
+// Diagnostic is an error or warning tied to a source range, every stage of the pipeline reports them
+type Diagnostic struct {
+	Kind string // "SYNTAX ERROR", "RUNTIME ERROR", ...
+	Filename string
+	Span Span
+	Message string
+	Incomplete bool // the source ended before what was being read did, more input may fix it
+};
+
+func (d *Diagnostic) Error() string {
+	if d.Span.IsZero() {
+		return fmt.Sprintf("%s in %s: %s", d.Kind, d.Filename, d.Message);
+	}
+	return fmt.Sprintf("%s at %s:%d:%d: %s", d.Kind, d.Filename, d.Span.Start.Line, d.Span.Start.Column, d.Message);
+}
+
+// Render shows the message followed by the offending source line with the span underlined:
+//
+//	SYNTAX ERROR at main.aml:1:9: unexpected character '@' (U+0040)
+//	 1 | var x = @;
+//	   |         ^
+//
+// a span over several lines is underlined up to the end of its first line
+func (d *Diagnostic) Render(source string) string {
+	lines := strings.Split(source, "\n");
+	if d.Span.IsZero() || int(d.Span.Start.Line) > len(lines) {
+		return d.Error();
+	}
+	line := []rune(strings.TrimSuffix(lines[d.Span.Start.Line-1], "\r"));
+	start := min(int(d.Span.Start.Column) - 1, len(line));
+	end := len(line);
+	if d.Span.End.Line == d.Span.Start.Line {
+		end = min(int(d.Span.End.Column) - 1, len(line));
+	}
+	width := max(end - start, 1);
+
+	gutter := fmt.Sprint(d.Span.Start.Line);
+	// keep tabs so that the caret lines up with the source
+	indent := strings.Builder{};
+	for _, r := range line[:start] {
+		if r == '\t' {
+			indent.WriteRune('\t');
+		} else {
+			indent.WriteRune(' ');
+		}
+	}
+	sb := strings.Builder{};
+	sb.WriteString(d.Error());
+	fmt.Fprintf(&sb, "\n %s | %s", gutter, string(line));
+	fmt.Fprintf(&sb, "\n %s | %s%s", strings.Repeat(" ", utf8.RuneCountInString(gutter)), indent.String(), strings.Repeat("^", width));
+	return sb.String();
+}
+
+// Render renders diagnostics and falls back to the plain message for any other error
+func Render(err error, source string) string {
+	if d, ok := err.(*Diagnostic); ok {
+		return d.Render(source);
+	}
+	return err.Error();
+}
@@ -0,0 +1,53 @@
+package lexer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func span(start_line uint, start_column uint, end_line uint, end_column uint) Span {
+	return Span{ Start: Pos{ Line: start_line, Column: start_column }, End: Pos{ Line: end_line, Column: end_column } };
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+		span Span;
+		want string; // the lines after the message
+	}{
+		{ "one character", "var x = @;", span(1, 9, 1, 10), " 1 | var x = @;\n   |         ^" },
+		// columns count runes, not bytes
+		{ "after multi-byte runes", "print größe + é;", span(1, 15, 1, 16), " 1 | print größe + é;\n   |               ^" },
+		{ "whole token", "print größe;", span(1, 7, 1, 12), " 1 | print größe;\n   |       ^^^^^" },
+		{ "tabs are kept", "\t\tif (x) y;", span(1, 3, 1, 5), " 1 | \t\tif (x) y;\n   | \t\t^^" },
+		{ "carriage return", "a\r\nb = @\r\n", span(2, 5, 2, 6), " 2 | b = @\n   |     ^" },
+		{ "several lines", "x = \"\"\"\nabc\n\"\"\"", span(1, 5, 3, 4), " 1 | x = \"\"\"\n   |     ^^^" },
+		{ "empty at the end of the line", "print 1 +", span(1, 10, 1, 10), " 1 | print 1 +\n   |          ^" },
+		{ "wide gutter", strings.Repeat("\n", 9) + "bad", span(10, 1, 10, 4), " 10 | bad\n    | ^^^" },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diag := &Diagnostic{ Kind: "SYNTAX ERROR", Filename: "test.aml", Span: test.span, Message: "m" };
+			want := diag.Error() + "\n" + test.want;
+			if got := Render(diag, test.source); got != want {
+				t.Errorf("got\n%s\nwant\n%s", got, want);
+			}
+		});
+	}
+}
+
+// without a position in the source there is nothing to underline
+func TestRenderWithoutSpan(t *testing.T) {
+	if got := Render(&Diagnostic{ Kind: "RUNTIME ERROR", Filename: "test.aml", Message: "m" }, "print 1;"); got != "RUNTIME ERROR in test.aml: m" {
+		t.Errorf("got %q", got);
+	}
+	past := &Diagnostic{ Kind: "SYNTAX ERROR", Filename: "test.aml", Span: span(3, 1, 3, 2), Message: "m" };
+	if got := Render(past, "print 1;"); got != "SYNTAX ERROR at test.aml:3:1: m" {
+		t.Errorf("got %q", got);
+	}
+	if got := Render(errors.New("plain"), "print 1;"); got != "plain" {
+		t.Errorf("got %q", got);
+	}
+}
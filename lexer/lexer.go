@@ -1,138 +1,680 @@
 package lexer 
 
 import (
+	"io"
 	"fmt"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 );
 
+// the scanner works on bytes and only decodes UTF-8 where a rune that is not ASCII may appear.
+// a string source is scanned in place and lexemes are substrings of it, a reader is read in chunks
+// of which only the part from the start of the current token on is kept.
+// indices (start, current) are byte offsets from the beginning of the source
 type Scanner struct {
 	filename string
-	source []rune 
-	tokens []Token
+	reader io.Reader // nil for a string source
+	chunk []byte
+	source string // what was read from the start of the current token on, source[0] is byte number base
+	base uint
+	done bool // the reader is exhausted
+	read_err error
+	tokens []Token // scanned, the ones before head were already returned by Next
+	head int
 
 	start uint
 	current uint
 	line uint
+	column uint // of current, in runes
+
+	// position of the token being scanned
+	start_line uint
+	start_column uint
+
+	// `///` lines waiting for the token below them
+	doc []string
+	doc_line uint
+
+	warnings []error
+
+	// automatic semicolon insertion
+	last TokenType // of the last token
+	before_last TokenType
+	nesting []opening
+	header bool // the last token closed the header of an if, while, for or function
+	semicolon *Token // inserted at the last line break, added before the next token
+
+	keep_trivia bool
+	leading []Trivia // for the next token
+	trailing bool // trivia goes to the last token until the next line break
 };
 
 func NewScanner(filename string, source string) *Scanner {
 	return &Scanner {
 		filename: filename,
-		source: []rune(source),
-		tokens: make([]Token, 0),
+		source: source,
+		done: true,
+		tokens: make([]Token, 0, 16),
+		last: EOF,
+		before_last: EOF,
 		start: 0,
 		current: 0,
 		line: 1,
+		column: 1,
 	};
 }
 
+// NewReaderScanner scans reader as it goes, tokens are pulled one at a time with Next
+func NewReaderScanner(filename string, reader io.Reader) *Scanner {
+	s := NewScanner(filename, "");
+	s.reader = reader;
+	s.chunk = make([]byte, 4096);
+	s.done = false;
+	return s;
+}
+
+// atomic: reads until the i-th byte is available, reports whether there is one.
+// what comes before the current token is forgotten on the way
+func (s *Scanner) fill(i uint) bool {
+	for i - s.base >= uint(len(s.source)) && !s.done {
+		n, err := s.reader.Read(s.chunk);
+		if n > 0 {
+			s.source = s.source[s.start - s.base:] + string(s.chunk[:n]);
+			s.base = s.start;
+		}
+		if err != nil {
+			if err != io.EOF {
+				s.read_err = err;
+			}
+			s.done = true;
+		}
+	}
+	return i - s.base < uint(len(s.source));
+}
+
+// atomic: the rune at the i-th byte and its width, a byte that is not UTF-8 is utf8.RuneError of width 1
+func (s *Scanner) decode(i uint) (rune, uint) {
+	s.fill(i + utf8.UTFMax - 1);
+	if i - s.base >= uint(len(s.source)) {
+		return EOF_RUNE, 0;
+	}
+	if b := s.source[i - s.base]; b < utf8.RuneSelf {
+		return rune(b), 1;
+	}
+	r, width := utf8.DecodeRuneInString(s.source[i - s.base:]);
+	return r, uint(width);
+}
+
+// atomic: column of the i-th byte, which is on the current line
+func (s *Scanner) column_at(i uint) uint {
+	if i < s.current {
+		return s.column - uint(utf8.RuneCountInString(s.source[i - s.base : s.current - s.base]));
+	}
+	return s.column + uint(utf8.RuneCountInString(s.source[s.current - s.base : i - s.base]));
+}
+
+// atomic: back to the start of the token being scanned
+func (s *Scanner) rewind() {
+	s.current = s.start;
+	s.column = s.start_column;
+}
+
+// KeepTrivia makes every token keep the whitespace and comments around it,
+// so that the source can be printed back from the tokens as it was written
+func (s *Scanner) KeepTrivia() {
+	s.keep_trivia = true;
+}
+
+// atomic: the source from..to of the current token, shared with the source
+func (s *Scanner) text(from uint, to uint) string {
+	return s.source[from - s.base : to - s.base];
+}
+
+// atomic: the range of the token being scanned
+func (s *Scanner) span() Span {
+	return Span{
+		Start: Pos{ Offset: s.start, Line: s.start_line, Column: s.start_column },
+		End: Pos{ Offset: s.current, Line: s.line, Column: s.column },
+	};
+}
+
+// an open bracket, line breaks inside '(' and '[' do not end statements
+type opening struct {
+	tt TokenType
+	header bool // the '(' of an if, while, for or function header
+};
+
+// a line ending with one of these ends the statement, like in Go
+func ends_statement(tt TokenType) bool {
+	switch tt {
+		case IDENTIFIER, NUMBER, STRING, TRUE, FALSE, NULL, THIS, RIGHT_PAREN, RIGHT_BRACKET, RIGHT_BRACE, RETURN, BREAK, CONTINUE:
+			return true;
+	}
+	return false;
+}
+
+// a line starting with one of these cannot start a statement, it continues the line above
+func continues_statement(tt TokenType) bool {
+	switch tt {
+		case DOT, PLUS, SLASH, STAR, QUESTION, COLON, PIPE_GREATER,
+			BANG_EQUAL, EQUAL, EQUAL_EQUAL, GREATER, GREATER_EQUAL, LESS, LESS_EQUAL,
+			QUESTION_QUESTION, QUESTION_DOT, QUESTION_QUESTION_EQUAL, AND, OR:
+			return true;
+	}
+	return false;
+}
+
+// a line starting with one of these starts a statement, though it could also have continued the line above
+func ambiguous_continuation(tt TokenType) bool {
+	return tt == LEFT_PAREN || tt == LEFT_BRACKET || tt == MINUS;
+}
+
+// a line ending with one of these may go on with a call, an index or an operator
+func continuable(tt TokenType) bool {
+	switch tt {
+		case IDENTIFIER, NUMBER, STRING, TRUE, FALSE, NULL, THIS, RIGHT_PAREN, RIGHT_BRACKET:
+			return true;
+	}
+	return false;
+}
+
+func starts_expression(tt TokenType) bool {
+	switch tt {
+		case IDENTIFIER, NUMBER, STRING, TRUE, FALSE, NULL, THIS, SUPER, LEFT_PAREN, LEFT_BRACKET, MINUS, BANG:
+			return true;
+	}
+	return false;
+}
+
 // atomic
-func (s *Scanner) add_token_literal(tt TokenType, literal any) Token {
+func (s *Scanner) in_brackets() bool {
+	n := len(s.nesting);
+	return n != 0 && s.nesting[n-1].tt != LEFT_BRACE;
+}
+
+// atomic: '(' and '[' left open when their block ends are unbalanced, they are dropped
+// so that line breaks end statements again
+func (s *Scanner) close_brackets() {
+	for s.in_brackets() {
+		s.nesting = s.nesting[:len(s.nesting)-1];
+	}
+}
+
+// atomic: called at a line break. the body of `if (cond)` may be on the next line
+func (s *Scanner) insert_semicolon() {
+	if s.semicolon != nil || s.in_brackets() || s.header || !ends_statement(s.last) {
+		return;
+	}
+	pos := s.span().Start;
+	s.semicolon = &Token{
+		Type: SEMICOLON,
+		Lexeme: ";",
+		Line: pos.Line,
+		Column: pos.Column,
+		Offset: pos.Offset,
+		End: pos,
+		Inserted: true,
+	};
+}
+
+// atomic: settles the semicolon inserted before the token of type tt, like in Go it ends
+// the statement. `}` and `else` on separate lines still make up a single statement, and so
+// does a line starting with an operator that cannot start one. a new statement that could
+// also have gone on with the line above is warned about
+func (s *Scanner) flush_semicolon(tt TokenType) {
+	semicolon := s.semicolon;
+	s.semicolon = nil;
+	if semicolon == nil || tt == ELSE && s.last == RIGHT_BRACE || continues_statement(tt) {
+		return;
+	}
+	if s.last == RETURN && starts_expression(tt) {
+		s.warn("'return' ends at the line break, the line below is not returned: join the lines to return it");
+	} else if continuable(s.last) && ambiguous_continuation(tt) {
+		s.warn("'%s' starts a new statement: join the lines to continue the one above, or put ';' before it", s.text(s.start, s.current));
+	}
+	s.tokens = append(s.tokens, *semicolon);
+	s.before_last, s.last = s.last, SEMICOLON;
+	s.header = false;
+}
+
+// atomic: a warning about the current token
+func (s *Scanner) warn(format string, args ...any) {
+	s.warnings = append(s.warnings, &Diagnostic{
+		Kind: "SYNTAX WARNING",
+		Filename: s.filename,
+		Span: s.span(),
+		Message: fmt.Sprintf(format, args...),
+	});
+}
+
+// atomic
+func (s *Scanner) add_token_lexeme(tt TokenType, lexeme string, literal any) Token {
+	s.flush_semicolon(tt);
+	s.header = false;
+	switch tt {
+		case LEFT_PAREN, LEFT_BRACKET: {
+			header := tt == LEFT_PAREN && (s.last == IF || s.last == WHILE || s.last == FOR || s.before_last == FUNC && s.last == IDENTIFIER);
+			s.nesting = append(s.nesting, opening{ tt: tt, header: header });
+		}
+		case RIGHT_PAREN, RIGHT_BRACKET: {
+			if s.in_brackets() {
+				s.header = s.nesting[len(s.nesting)-1].header;
+				s.nesting = s.nesting[:len(s.nesting)-1];
+			}
+		}
+		// blocks are never inside brackets
+		case LEFT_BRACE: {
+			s.close_brackets();
+			s.nesting = append(s.nesting, opening{ tt: tt });
+		}
+		case RIGHT_BRACE: {
+			s.close_brackets();
+			if n := len(s.nesting); n > 0 {
+				s.nesting = s.nesting[:n-1];
+			}
+		}
+	}
+	s.before_last, s.last = s.last, tt;
+	span := s.span();
 	token := Token{
 		Type: tt,
-		Lexeme: string(s.source[s.start : s.current]),
+		Lexeme: lexeme,
 		Literal: literal,
-		Line: s.line,
+		Line: span.Start.Line,
+		Column: span.Start.Column,
+		Offset: span.Start.Offset,
+		End: span.End,
 	};
+	if len(s.doc) != 0 && s.doc_line + 1 == token.Line {
+		token.Doc = strings.Join(s.doc, "\n");
+	}
+	s.doc = nil;
+	if s.keep_trivia {
+		if raw := s.text(s.start, s.current); raw != lexeme {
+			token.Raw = raw;
+		}
+		token.Leading = s.leading;
+		s.leading = nil;
+		s.trailing = true;
+	}
 	s.tokens = append(s.tokens, token);
 	return token;
 }
 
+// molecular
+func (s *Scanner) add_token_literal(tt TokenType, literal any) Token {
+	return s.add_token_lexeme(tt, s.text(s.start, s.current), literal);
+}
+
 // molecular
 func (s *Scanner) add_token(tt TokenType) Token {
 	return s.add_token_literal(tt, nil);
 }
 
+// atomic: keeps the whitespace, line break or comment just scanned when trivia is kept
+func (s *Scanner) add_trivia(kind TriviaKind) {
+	if !s.keep_trivia {
+		return;
+	}
+	trivia := Trivia{ Kind: kind, Text: s.text(s.start, s.current), Span: s.span() };
+	list := &s.leading;
+	if s.trailing && kind != NEWLINE && s.queued() != 0 {
+		list = &s.tokens[len(s.tokens)-1].Trailing;
+	}
+	if kind == NEWLINE {
+		s.trailing = false;
+	}
+	// a run of blanks is a single piece
+	if n := len(*list); kind == WHITESPACE && n != 0 && (*list)[n-1].Kind == WHITESPACE {
+		(*list)[n-1].Text += trivia.Text;
+		(*list)[n-1].Span.End = trivia.Span.End;
+		return;
+	}
+	*list = append(*list, trivia);
+}
+
+// atomic: called after consuming a '\n'
+func (s *Scanner) newline() {
+	s.line++;
+	s.column = 1;
+}
+
+// atomic: tokens scanned but not returned by Next yet
+func (s *Scanner) queued() int {
+	return len(s.tokens) - s.head;
+}
+
 // atomic
 func (s *Scanner) eof() bool {
-	return s.current >= uint(len(s.source));
+	return !s.fill(s.current);
 }
 
-// atomic
-func (s *Scanner) generate_error(description string) error {
-	return fmt.Errorf("%s:%d:%d unexpected token\ndescription: %s", s.filename, s.line, s.current, description);
+// atomic: reports an error over span
+func (s *Scanner) generate_error(span Span, format string, args ...any) *Diagnostic {
+	return &Diagnostic{ Kind: "SYNTAX ERROR", Filename: s.filename, Span: span, Message: fmt.Sprintf(format, args...) };
+}
+
+// atomic: the byte at i when it does not start a valid UTF-8 sequence,
+// decoding reads it as a replacement rune
+func (s *Scanner) invalid_byte(i uint) (byte, bool) {
+	if r, width := s.decode(i); r != utf8.RuneError || width != 1 {
+		return 0, false;
+	}
+	return s.source[i - s.base], true;
+}
+
+// atomic: the span of the rune at the i-th byte, which is on the current line
+func (s *Scanner) rune_span(i uint) Span {
+	_, width := s.decode(i);
+	column := s.column_at(i);
+	return Span{
+		Start: Pos{ Offset: i, Line: s.line, Column: column },
+		End: Pos{ Offset: i + width, Line: s.line, Column: column + 1 },
+	};
 }
 
 // atomic: lookahead with one character
 func (s *Scanner) peek_rune() rune {
-	if s.eof() {
+	r, _ := s.decode(s.current);
+	return r;
+}
+
+// atomic: lookahead with two characters
+func (s *Scanner) peek_next_rune() rune {
+	_, width := s.decode(s.current);
+	if width == 0 {
 		return EOF_RUNE;
 	}
-	return s.source[s.current];
+	r, _ := s.decode(s.current + width);
+	return r;
 }
 
 // atomic
 func (s *Scanner) consume_rune() rune {
-	if s.eof() {
+	r, width := s.decode(s.current);
+	if width == 0 {
 		return EOF_RUNE;
 	}
-	r := s.source[s.current];
-	s.current++;
+	s.current += width;
+	s.column++;
 	return r;
 }
 
 // molecular
 func (s *Scanner) expect_rune(r rune) bool {
 	if s.peek_rune() == r {
-		s.current++;
+		s.consume_rune();
 		return true
 	}
 	return false
 }
 
-func (s *Scanner) consume_string() (string, error) {
-	var r rune;
-	for r = s.consume_rune(); !(r == '"' || r == EOF_RUNE); r = s.consume_rune() {
-		// TODO: handle invalid string characters
-		if (r == '\n') {
-			s.line++;
+// atomic: whether the source continues with str, which is ASCII
+func (s *Scanner) peek_string(str string) bool {
+	s.fill(s.current + uint(len(str)) - 1);
+	return strings.HasPrefix(s.source[s.current - s.base:], str);
+}
+
+// molecular: called after the opening delimiter of a string, which is as long as closing.
+// returns what is between the delimiters as written, line breaks included
+func (s *Scanner) consume_string(closing string, what string) (string, error) {
+	content := s.current;
+	for !s.eof() {
+		if s.peek_string(closing) {
+			text := s.text(content, s.current);
+			s.current += uint(len(closing));
+			s.column += uint(len(closing));
+			return text, nil;
+		}
+		at := s.current;
+		if r := s.consume_rune(); r == '\n' {
+			s.newline();
+		} else if r == utf8.RuneError {
+			if b, invalid := s.invalid_byte(at); invalid {
+				return "", s.generate_error(s.rune_span(at), "invalid UTF-8 byte 0x%02X in %s", b, what);
+			}
 		}
 	}
-	if (r == EOF_RUNE) {
-		return "", s.generate_error("unterminated string");
+	// point at the opening delimiter, the rest of the file is the string
+	span := s.span();
+	width := uint(len(closing));
+	span.End = Pos{ Offset: span.Start.Offset + width, Line: span.Start.Line, Column: span.Start.Column + width };
+	err := s.generate_error(span, "unterminated %s", what);
+	err.Incomplete = true;
+	return "", err;
+}
+
+// molecular: called after "/*", block comments nest
+func (s *Scanner) consume_block_comment() error {
+	for depth := 1; depth > 0; {
+		if s.eof() {
+			span := s.span();
+			span.End = Pos{ Offset: span.Start.Offset + 2, Line: span.Start.Line, Column: span.Start.Column + 2 };
+			err := s.generate_error(span, "unterminated block comment");
+			err.Incomplete = true;
+			return err;
+		}
+		r := s.consume_rune();
+		if r == '\n' {
+			s.newline();
+		} else if r == '/' && s.expect_rune('*') {
+			depth++;
+		} else if r == '*' && s.expect_rune('/') {
+			depth--;
+		}
 	}
-	return string(s.source[s.start:s.current]), nil
+	return nil;
 }
 
+// atomic: a doc comment only documents the token on the next line,
+// consecutive lines make up a single comment
+func (s *Scanner) add_doc(line string) {
+	if len(s.doc) != 0 && s.doc_line + 1 != s.start_line {
+		s.doc = nil;
+	}
+	s.doc = append(s.doc, strings.TrimPrefix(strings.TrimRight(line, "\r"), " "));
+	s.doc_line = s.start_line;
+}
+
+// atomic: the base of a number starting with '0' and prefix
+func number_base(prefix rune) (int, bool) {
+	switch prefix {
+		case 'x', 'X': return 16, true;
+		case 'o', 'O': return 8, true;
+		case 'b', 'B': return 2, true;
+	}
+	return 10, false;
+}
+
+var number_names = map[int]string{ 2: "binary", 8: "octal", 10: "number", 16: "hexadecimal" };
+
+// atomic
+func is_digit(r rune, base int) bool {
+	switch base {
+		case 2: return r == '0' || r == '1';
+		case 8: return '0' <= r && r <= '7';
+		case 16: return IsNum(r) || 'a' <= r && r <= 'f' || 'A' <= r && r <= 'F';
+	}
+	return IsNum(r);
+}
+
+// molecular: a run of digits where '_' may only sit between two of them,
+// or right after a base prefix. the digits are returned without the underscores
+func (s *Scanner) consume_digits(base int, after_prefix bool) (string, error) {
+	digits := strings.Builder{};
+	after_digit := after_prefix;
+	for r := s.peek_rune(); r == '_' || is_digit(r, base); r = s.peek_rune() {
+		if r == '_' {
+			if !after_digit || !is_digit(s.peek_next_rune(), base) {
+				return "", s.generate_error(s.rune_span(s.current), "'_' must separate digits");
+			}
+			after_digit = false;
+		} else {
+			digits.WriteRune(r);
+			after_digit = true;
+		}
+		s.consume_rune();
+	}
+	return digits.String(), nil;
+}
+
+// atomic: `0b102` or `12px` are typos rather than a number followed by an identifier
+func (s *Scanner) check_number_end(base int) error {
+	if r := s.peek_rune(); IsAlphaNum(r) {
+		if IsNum(r) {
+			return s.generate_error(s.rune_span(s.current), "invalid digit '%c' in %s literal", r, number_names[base]);
+		}
+		return s.generate_error(s.rune_span(s.current), "invalid character '%c' in %s literal", r, number_names[base]);
+	}
+	return nil;
+}
+
+// molecular: 0x, 0o and 0b prefixed integers
+func (s *Scanner) consume_based_number(base int) (float64, error) {
+	s.consume_rune();
+	s.consume_rune();
+	digits, err := s.consume_digits(base, true);
+	if err != nil {
+		return 0, err;
+	}
+	if digits == "" {
+		return 0, s.generate_error(s.span(), "%s literal '%s' has no digits", number_names[base], s.text(s.start, s.current));
+	}
+	if err := s.check_number_end(base); err != nil {
+		return 0, err;
+	}
+	num, err := strconv.ParseUint(digits, base, 64);
+	if err != nil {
+		return 0, s.generate_error(s.span(), "number '%s' is out of range", s.text(s.start, s.current));
+	}
+	return float64(num), nil;
+}
+
+// cellular: 12, 1_000, 1.5, .5, 1e9, 2.5E-3 and the prefixed integers.
+// a '.' only belongs to the number when a digit follows, `1.` is the number 1 and a DOT
 func (s *Scanner) consume_number() (float64, error) {
-	for r := s.peek_rune(); IsNum(r) && r != EOF_RUNE; r = s.peek_rune() {
+	if s.peek_rune() == '0' {
+		if base, ok := number_base(s.peek_next_rune()); ok {
+			return s.consume_based_number(base);
+		}
+	}
+	literal := strings.Builder{};
+	digits, err := s.consume_digits(10, false);
+	if err != nil {
+		return 0, err;
+	}
+	literal.WriteString(digits);
+	if s.peek_rune() == '.' && s.peek_next_rune() == '_' {
+		return 0, s.generate_error(s.rune_span(s.current + 1), "'_' must separate digits");
+	}
+	if s.peek_rune() == '.' && IsNum(s.peek_next_rune()) {
 		s.consume_rune();
+		digits, err := s.consume_digits(10, false);
+		if err != nil {
+			return 0, err;
+		}
+		literal.WriteString("." + digits);
 	}
-	if s.expect_rune('.') {
-		for r := s.peek_rune(); IsNum(r) && r != EOF_RUNE; r = s.peek_rune() {
-			s.consume_rune();
+	if r := s.peek_rune(); r == 'e' || r == 'E' {
+		exponent := s.current;
+		s.consume_rune();
+		sign := "";
+		if r := s.peek_rune(); r == '+' || r == '-' {
+			sign = string(s.consume_rune());
+		}
+		if s.peek_rune() == '_' {
+			return 0, s.generate_error(s.rune_span(s.current), "'_' must separate digits");
 		}
+		if !IsNum(s.peek_rune()) {
+			span := s.span();
+			span.Start = s.rune_span(exponent).Start;
+			return 0, s.generate_error(span, "exponent '%s' has no digits", s.text(exponent, s.current));
+		}
+		digits, err := s.consume_digits(10, false);
+		if err != nil {
+			return 0, err;
+		}
+		literal.WriteString("e" + sign + digits);
+	}
+	if err := s.check_number_end(10); err != nil {
+		return 0, err;
 	}
-	num, err := strconv.ParseFloat(string(s.source[s.start:s.current]), 64);
+	num, err := strconv.ParseFloat(literal.String(), 64);
 	if err != nil {
-		return 0, s.generate_error(err.Error());
+		return 0, s.generate_error(s.span(), "number '%s' is out of range", s.text(s.start, s.current));
 	}
 	return num, nil
 }
 
+// identifiers are compared in NFC, names mixing look-alike scripts are only warned about
 func (s *Scanner) consume_identifier() (string, error) {
+	ascii := true;
 	for r := s.peek_rune(); IsAlphaNum(r) && r != EOF_RUNE; r = s.peek_rune() {
+		ascii = ascii && r < utf8.RuneSelf;
 		s.consume_rune();
 	}
-	return string(s.source[s.start:s.current]), nil
+	if ascii {
+		return s.text(s.start, s.current), nil;
+	}
+	name := NormalizeIdentifier(s.text(s.start, s.current));
+	if scripts, mixed := mixed_script(name); mixed {
+		s.warnings = append(s.warnings, &Diagnostic{
+			Kind: "CONFUSABLE WARNING",
+			Filename: s.filename,
+			Span: s.span(),
+			Message: fmt.Sprintf("identifier '%s' mixes %s scripts", name, join_scripts(scripts)),
+		});
+	}
+	return name, nil
 }
 
 // cellular
 func (s *Scanner) scan_curr() error {
 	s.start = s.current;
+	s.start_line = s.line;
+	s.start_column = s.column;
 	char := s.consume_rune();
 	switch char {
 		case '(': { s.add_token(LEFT_PAREN); break; } 
 		case ')': { s.add_token(RIGHT_PAREN); break; }
 		case '{': { s.add_token(LEFT_BRACE); break; }
 		case '}': { s.add_token(RIGHT_BRACE); break; }
+		case '[': { s.add_token(LEFT_BRACKET); break; }
+		case ']': { s.add_token(RIGHT_BRACKET); break; }
 		case ',': { s.add_token(COMMA); break; }
-		case '.': { s.add_token(DOT); break; }
+		case '.': {
+			if IsNum(s.peek_rune()) {
+				s.rewind();
+				num, err := s.consume_number();
+				if err != nil {
+					return err;
+				}
+				s.add_token_literal(NUMBER, num);
+				break;
+			}
+			s.add_token(DOT);
+			break;
+		}
 		case '-': { s.add_token(MINUS); break; }
 		case '+': { s.add_token(PLUS); break; }
 		case ';': { s.add_token(SEMICOLON); break; }
 		case '*': { s.add_token(STAR); break; }
-		case '?': { s.add_token(QUESTION); break; }
+		case '?': {
+			tt := QUESTION;
+			if s.expect_rune('?') {
+				tt = QUESTION_QUESTION;
+				if s.expect_rune('=') {
+					tt = QUESTION_QUESTION_EQUAL;
+				}
+			} else if s.peek_rune() == '.' && !IsNum(s.peek_next_rune()) {
+				// `a ? .5 : b` is still a ternary
+				s.consume_rune();
+				tt = QUESTION_DOT;
+			}
+			s.add_token(tt);
+			break;
+		}
 		case ':': { s.add_token(COLON); break; }
 		case '!': {
 			tt := BANG;
@@ -166,28 +708,70 @@ func (s *Scanner) scan_curr() error {
 			s.add_token(tt) 
 			break;
 		}
+		case '|': {
+			tt := PIPE;
+			if s.expect_rune('>') {
+				tt = PIPE_GREATER;
+			}
+			s.add_token(tt);
+			break;
+		}
 		case '/': {
 			if s.expect_rune('/') {
+				// "////" and more is a plain comment
+				doc := s.expect_rune('/') && s.peek_rune() != '/';
 				// ignore all of the following text
 				for r := s.peek_rune(); !(r == '\n' || s.eof()); r = s.peek_rune() {
 					s.consume_rune();
 				}
+				if doc {
+					s.add_doc(s.text(s.start+3, s.current));
+				}
+				s.add_trivia(COMMENT);
+			} else if s.expect_rune('*') {
+				if err := s.consume_block_comment(); err != nil {
+					return err;
+				}
+				s.add_trivia(COMMENT);
 			} else {
 				s.add_token(SLASH);
 			}
 			break;
 		}
-		case ' ':
-		case '\t':
-		case '\r': {
+		case ' ', '\t', '\r': {
+			for r := s.peek_rune(); r == ' ' || r == '\t' || r == '\r'; r = s.peek_rune() {
+				s.consume_rune();
+			}
+			s.add_trivia(WHITESPACE);
 			break;
 		}
 		case '\n': {
-			s.line++;
+			s.insert_semicolon();
+			s.newline();
+			s.add_trivia(NEWLINE);
 			break;
 		}
 		case '"': {
-			literal ,err := s.consume_string()
+			if s.peek_rune() == '"' && s.peek_next_rune() == '"' {
+				s.consume_rune();
+				s.consume_rune();
+				text, err := s.consume_string(`"""`, "multi-line string");
+				if err != nil {
+					return err;
+				}
+				s.add_token_literal(STRING, dedent(text));
+				break;
+			}
+			literal, err := s.consume_string(`"`, "string");
+			if err != nil {
+				return err;
+			}
+			s.add_token_literal(STRING, literal);
+			break;
+		}
+		case '`': {
+			// raw strings are taken as is
+			literal, err := s.consume_string("`", "raw string");
 			if err != nil {
 				return err;
 			}
@@ -196,37 +780,89 @@ func (s *Scanner) scan_curr() error {
 		}
 		default: {
 			if IsNum(char) {
-				s.current--;
+				s.rewind();
 				num, err := s.consume_number();
 				if err != nil {
 					return err;
 				}
 				s.add_token_literal(NUMBER, num);
 			} else if IsAlpha(char) {
-				s.current--;
+				s.rewind();
 				literal, err := s.consume_identifier();
 				if err != nil {
 					return err;
 				}
 				tt := IDENTIFIER;
-				if keyword, pres := keywords_map[literal]; pres {
-					tt = keyword;
+				if kw, pres := keyword(literal); pres {
+					tt = kw;
 				}
-				s.add_token_literal(tt, literal);
+				s.add_token_lexeme(tt, literal, literal);
+			} else if b, invalid := s.invalid_byte(s.start); invalid {
+				return s.generate_error(s.span(), "invalid UTF-8 byte 0x%02X", b);
 			} else {
-				return s.generate_error(fmt.Sprintf("NOTE: learn the fucking language idiot, got %v", char));
+				return s.generate_error(s.span(), "unexpected character '%c' (U+%04X)", char, char);
 			}
 		}
 	}
 	return nil;
 }
 
-// organelle
-func (s *Scanner) Scan() ([]Token, error) {
-	for !s.eof() {
+// organelle: the next token, an EOF token once the source is exhausted.
+// after an error the scanner resumes past whatever was wrong
+func (s *Scanner) Next() (Token, error) {
+	// with trivia a token waits for the end of its line
+	for s.queued() == 0 || s.keep_trivia && s.trailing && s.queued() == 1 && !s.eof() {
+		if s.eof() {
+			// the end of the source is a line break too, the ';' and the EOF token are put there
+			s.start = s.current;
+			s.start_line = s.line;
+			s.start_column = s.column;
+			s.insert_semicolon();
+			if s.semicolon != nil {
+				s.flush_semicolon(EOF);
+				continue;
+			}
+			if s.read_err != nil {
+				err := s.read_err;
+				s.read_err = nil;
+				return Token{}, err;
+			}
+			span := s.span();
+			token := Token{ Type: EOF, Line: span.Start.Line, Column: span.Start.Column, Offset: span.Start.Offset, End: span.End, Leading: s.leading };
+			s.leading = nil;
+			return token, nil;
+		}
 		if err := s.scan_curr(); err != nil {
-			return nil, err
+			return Token{}, err;
+		}
+	}
+	token := s.tokens[s.head];
+	s.head++;
+	// the queue is empty again, its array is reused
+	if s.head == len(s.tokens) {
+		s.tokens = s.tokens[:0];
+		s.head = 0;
+	}
+	return token, nil;
+}
+
+// organelle: every token of the source, without the EOF token
+func (s *Scanner) Scan() ([]Token, error) {
+	// about one token every 4 bytes in the examples
+	tokens := make([]Token, 0, len(s.source) / 4);
+	for {
+		token, err := s.Next();
+		if err != nil {
+			return nil, err;
 		}
+		if token.Type == EOF {
+			return tokens, nil;
+		}
+		tokens = append(tokens, token);
 	}
-	return s.tokens, nil;
+}
+
+// Warnings returns what was found suspicious but did not stop the scan
+func (s *Scanner) Warnings() []error {
+	return s.warnings;
 }
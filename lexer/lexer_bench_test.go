@@ -0,0 +1,85 @@
+package lexer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// a large script made of every kind of token, comments and multi-line strings included
+func generate_source(functions int) string {
+	sb := strings.Builder{};
+	sb.WriteString("/// generated\nvar total = 0;\n");
+	for i := 0; i < functions; i++ {
+		fmt.Fprintf(&sb, "/// computes the value number %d\n", i);
+		fmt.Fprintf(&sb, "func compute_%d(a: number, b: number): number {\n", i);
+		fmt.Fprintf(&sb, "\tvar x = a * %d.5 + b / 0x%X - 1_000; // mixed literals\n", i, i);
+		sb.WriteString("\tif (x >= 10 and b != null) {\n\t\treturn x ?? 0\n\t} else {\n\t\tx = x - 1e3;\n\t}\n");
+		sb.WriteString("\t/* block /* nested */ comment */\n");
+		fmt.Fprintf(&sb, "\tvar name = \"compute_%d\";\n", i);
+		sb.WriteString("\tvar doc = \"\"\"\n\t\tindented\n\t\ttext\n\t\t\"\"\";\n");
+		sb.WriteString("\tfor (var j = 0; j < 3; j = j + 1) { total = total + j; }\n");
+		sb.WriteString("\treturn x |> floor;\n}\n");
+		fmt.Fprintf(&sb, "print compute_%d(%d, 2), `raw\\string`;\n", i, i);
+	}
+	return sb.String();
+}
+
+var bench_source = generate_source(5000);
+
+func BenchmarkScan(b *testing.B) {
+	b.SetBytes(int64(len(bench_source)));
+	b.ReportAllocs();
+	for i := 0; i < b.N; i++ {
+		if _, err := NewScanner("bench.aml", bench_source).Scan(); err != nil {
+			b.Fatal(err);
+		}
+	}
+}
+
+// Next without keeping the tokens, the way the parser reads them
+func BenchmarkNext(b *testing.B) {
+	b.SetBytes(int64(len(bench_source)));
+	b.ReportAllocs();
+	for i := 0; i < b.N; i++ {
+		s := NewScanner("bench.aml", bench_source);
+		for {
+			token, err := s.Next();
+			if err != nil {
+				b.Fatal(err);
+			}
+			if token.Type == EOF {
+				break;
+			}
+		}
+	}
+}
+
+func BenchmarkReaderScanner(b *testing.B) {
+	b.SetBytes(int64(len(bench_source)));
+	b.ReportAllocs();
+	for i := 0; i < b.N; i++ {
+		s := NewReaderScanner("bench.aml", strings.NewReader(bench_source));
+		for {
+			token, err := s.Next();
+			if err != nil {
+				b.Fatal(err);
+			}
+			if token.Type == EOF {
+				break;
+			}
+		}
+	}
+}
+
+func BenchmarkScanTrivia(b *testing.B) {
+	b.SetBytes(int64(len(bench_source)));
+	b.ReportAllocs();
+	for i := 0; i < b.N; i++ {
+		s := NewScanner("bench.aml", bench_source);
+		s.KeepTrivia();
+		if _, err := s.Scan(); err != nil {
+			b.Fatal(err);
+		}
+	}
+}
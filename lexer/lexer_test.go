@@ -0,0 +1,431 @@
+package lexer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// the lexemes of source separated by spaces, inserted semicolons are written `⏎`
+func lexemes(t *testing.T, source string) (string, []string) {
+	t.Helper();
+	s := NewScanner("test.aml", source);
+	tokens, err := s.Scan();
+	if err != nil {
+		t.Fatalf("scanning %q: %v", source, err);
+	}
+	strs := make([]string, len(tokens));
+	for i, token := range tokens {
+		if token.Inserted {
+			strs[i] = "⏎";
+		} else {
+			strs[i] = token.Lexeme;
+		}
+	}
+	warnings := make([]string, len(s.Warnings()));
+	for i, warning := range s.Warnings() {
+		var diag *Diagnostic;
+		if errors.As(warning, &diag) {
+			warnings[i] = diag.Message;
+		}
+	}
+	return strings.Join(strs, " "), warnings;
+}
+
+func TestSemicolonInsertion(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+		want string;
+		warning string; // the start of the only warning, if any
+	}{
+		{ "identifier", "a = b\nc = d\n", "a = b ⏎ c = d ⏎", "" },
+		{ "this", "a = this\nc = d\n", "a = this ⏎ c = d ⏎", "" },
+		{ "explicit", "a = b;\nc = d;\n", "a = b ; c = d ;", "" },
+		{ "end of file", "print a", "print a ⏎", "" },
+		{ "keywords", "while (x) {\nbreak\ncontinue\n}\n", "while ( x ) { break ⏎ continue ⏎ } ⏎", "" },
+		{ "header", "if (x)\nprint y\n", "if ( x ) print y ⏎", "" },
+		{ "function header", "func f(a)\n{\n}\n", "func f ( a ) { } ⏎", "" },
+		{ "else", "if (x) {\n}\nelse {\n}\n", "if ( x ) { } else { } ⏎", "" },
+		{ "binary operator", "a = b\n+ c\n", "a = b + c ⏎", "" },
+		{ "inside parentheses", "f(a,\nb)\n", "f ( a , b ) ⏎", "" },
+		{ "operator at the end", "a = b +\nc\n", "a = b + c ⏎", "" },
+
+		// a line that could also continue the one above starts a new statement, and is warned about
+		{ "minus", "var x = 5\n-1\nprint x\n", "var x = 5 ⏎ - 1 ⏎ print x ⏎", "'-' starts a new statement" },
+		{ "grouping", "var b = a\n(b)\n", "var b = a ⏎ ( b ) ⏎", "'(' starts a new statement" },
+		{ "index", "print a\n[0]\n", "print a ⏎ [ 0 ] ⏎", "'[' starts a new statement" },
+		{ "return", "return\n5\n", "return ⏎ 5 ⏎", "'return' ends at the line break" },
+		{ "return at the end of a block", "{ return\nx }", "{ return ⏎ x } ⏎", "'return' ends at the line break" },
+		// ';' at the end of the second line does not join them either
+		{ "minus with ';'", "var b = a\n  - 1;\n", "var b = a ⏎ - 1 ;", "'-' starts a new statement" },
+		{ "call with ';'", "var b = f\n  (1);\n", "var b = f ⏎ ( 1 ) ;", "'(' starts a new statement" },
+		{ "return with ';'", "return\n  42;\n", "return ⏎ 42 ;", "'return' ends at the line break" },
+
+		// nothing to continue
+		{ "explicit ';'", "var b = a;\n(f)()\n", "var b = a ; ( f ) ( ) ⏎", "" },
+		{ "lone return", "return\nprint x\n", "return ⏎ print x ⏎", "" },
+		{ "return before '}'", "{\nreturn\n}\n", "{ return ⏎ } ⏎", "" },
+		{ "after a block", "{\n}\n(f)()\n", "{ } ⏎ ( f ) ( ) ⏎", "" },
+		{ "after break", "while (x) {\nbreak\n-1\n}\n", "while ( x ) { break ⏎ - 1 ⏎ } ⏎", "" },
+
+		// an unbalanced bracket only lasts until the end of its block
+		{ "unclosed parenthesis", "{\nf(a\n}\nb = c\nd = e\n", "{ f ( a } ⏎ b = c ⏎ d = e ⏎", "" },
+		{ "stray parenthesis", "{\na = b)\n}\nc = d\n", "{ a = b ) ⏎ } ⏎ c = d ⏎", "" },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, warnings := lexemes(t, test.source);
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want);
+			}
+			if test.warning == "" && len(warnings) != 0 {
+				t.Errorf("unexpected warnings %q", warnings);
+			}
+			if test.warning != "" && (len(warnings) != 1 || !strings.HasPrefix(warnings[0], test.warning)) {
+				t.Errorf("got warnings %q, want %q", warnings, test.warning);
+			}
+		});
+	}
+}
+
+func TestNumberLiterals(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+		value float64; // of the first token
+		want string; // the lexemes, or the message of the error
+	}{
+		{ "integer", "12", 12, "12 ⏎" },
+		{ "fraction", "1.5", 1.5, "1.5 ⏎" },
+		{ "leading dot", ".5", 0.5, ".5 ⏎" },
+		{ "trailing dot", "1.", 1, "1 ." },
+		{ "method on a number", "1.abs", 1, "1 . abs ⏎" },
+		{ "exponent", "1e9", 1e9, "1e9 ⏎" },
+		{ "signed exponent", "2.5E-3", 2.5e-3, "2.5E-3 ⏎" },
+		{ "separators", "1_000_000", 1000000, "1_000_000 ⏎" },
+		{ "separators in the fraction", "1_0.2_5e1_0", 10.25e10, "1_0.2_5e1_0 ⏎" },
+		{ "hexadecimal", "0xFf", 255, "0xFf ⏎" },
+		{ "octal", "0o17", 15, "0o17 ⏎" },
+		{ "binary", "0b1_01", 5, "0b1_01 ⏎" },
+		{ "separator after a prefix", "0x_ff", 255, "0x_ff ⏎" },
+		{ "leading zero", "007", 7, "007 ⏎" },
+
+		{ "exponent without digits", "1e", 0, "exponent 'e' has no digits" },
+		{ "signed exponent without digits", "1e+", 0, "exponent 'e+' has no digits" },
+		{ "prefix without digits", "0x", 0, "hexadecimal literal '0x' has no digits" },
+		{ "binary without digits", "0b_", 0, "'_' must separate digits" },
+		{ "trailing separator", "1_", 0, "'_' must separate digits" },
+		{ "double separator", "1__0", 0, "'_' must separate digits" },
+		{ "separator before the dot", "1_.5", 0, "'_' must separate digits" },
+		{ "separator after the dot", "1._5", 0, "'_' must separate digits" },
+		{ "separator before the exponent", "1_e5", 0, "'_' must separate digits" },
+		{ "separator after the exponent", "1e_5", 0, "'_' must separate digits" },
+		{ "binary digit", "0b102", 0, "invalid digit '2' in binary literal" },
+		{ "octal digit", "0o78", 0, "invalid digit '8' in octal literal" },
+		{ "prefix before an invalid digit", "0o8", 0, "octal literal '0o' has no digits" },
+		{ "unit", "12px", 0, "invalid character 'p' in number literal" },
+		{ "out of range", "0x1_0000_0000_0000_0000", 0, "number '0x1_0000_0000_0000_0000' is out of range" },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tokens, err := NewScanner("test.aml", test.source).Scan();
+			if err != nil {
+				var diag *Diagnostic;
+				if !errors.As(err, &diag) || diag.Message != test.want {
+					t.Errorf("got %v, want %q", err, test.want);
+				}
+				return;
+			}
+			if got, _ := lexemes(t, test.source); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want);
+			}
+			if tokens[0].Type != NUMBER || tokens[0].Literal != test.value {
+				t.Errorf("got %s %v, want the number %v", tokens[0].Type.ToString(), tokens[0].Literal, test.value);
+			}
+		});
+	}
+}
+
+// identifiers are XID_Start XID_Continue*, with '_' allowed anywhere
+func TestIdentifiers(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+		want string; // the lexemes, or the message and position of the error
+	}{
+		{ "latin with diacritics", "größe = 2", "größe = 2 ⏎" },
+		{ "cjk", "日本語かな = 1", "日本語かな = 1 ⏎" },
+		{ "greek", "αβγ = 1", "αβγ = 1 ⏎" },
+		{ "letter number", "Ⅻ = 1", "Ⅻ = 1 ⏎" },
+		{ "other id start", "℘ = 1", "℘ = 1 ⏎" },
+		{ "underscore and digits", "_x1 = 2", "_x1 = 2 ⏎" },
+		{ "combining mark continues", "x\u0301 = 1", "x\u0301 = 1 ⏎" },
+		{ "other digits continue", "ŝ١ = 1", "ŝ١ = 1 ⏎" },
+		{ "other id continue", "ab·c", "ab·c ⏎" },
+
+		{ "combining mark cannot start", "\u0300a", "1:1 unexpected character '\u0300' (U+0300)" },
+		{ "pattern syntax", "a→b", "1:2 unexpected character '→' (U+2192)" },
+		{ "digit cannot start", "١a", "1:1 unexpected character '١' (U+0661)" },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewScanner("test.aml", test.source).Scan(); err != nil {
+				var diag *Diagnostic;
+				if !errors.As(err, &diag) || fmt.Sprintf("%d:%d %s", diag.Span.Start.Line, diag.Span.Start.Column, diag.Message) != test.want {
+					t.Errorf("got %v, want %q", err, test.want);
+				}
+				return;
+			}
+			if got, _ := lexemes(t, test.source); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want);
+			}
+		});
+	}
+}
+
+// a combining accent and a precomposed letter spell the same identifier
+func TestIdentifierNFC(t *testing.T) {
+	tokens, err := NewScanner("test.aml", "cafe\u0301 = caf\u00e9").Scan();
+	if err != nil {
+		t.Fatal(err);
+	}
+	if tokens[0].Lexeme != tokens[2].Lexeme || tokens[0].Lexeme != "caf\u00e9" {
+		t.Errorf("got %q and %q, want both %q", tokens[0].Lexeme, tokens[2].Lexeme, "caf\u00e9");
+	}
+	// the '=' after the decomposed name is one column further, a column is a rune of the source
+	if tokens[1].Column != 7 {
+		t.Errorf("'=' at column %d, want 7", tokens[1].Column);
+	}
+}
+
+func TestMixedScripts(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+		want string; // the warning, if any
+	}{
+		{ "cyrillic a among latin", "pаypal = 1", "identifier 'pаypal' mixes Cyrillic and Latin scripts" },
+		{ "greek and latin", "ωa = 1", "identifier 'ωa' mixes Greek and Latin scripts" },
+		{ "latin", "größe = 1", "" },
+		{ "cyrillic", "аб = 1", "" },
+		{ "han and kana", "日本語かな = 1", "" },
+		{ "digits and underscores", "_а_1 = 1", "" },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, warnings := lexemes(t, test.source);
+			if got := strings.Join(warnings, "\n"); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want);
+			}
+		});
+	}
+}
+
+// the error points at the byte, its column counts the runes before it on its line
+func TestInvalidUTF8(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+		want string;
+	}{
+		{ "between tokens", "a = 1 + \xff", "1:9-1:10 invalid UTF-8 byte 0xFF" },
+		{ "after multi-byte runes", "x\nyé\xfez", "2:3-2:4 invalid UTF-8 byte 0xFE" },
+		{ "in a string", "print \"ab\xffc\"", "1:10-1:11 invalid UTF-8 byte 0xFF in string" },
+		{ "truncated rune in a raw string", "`r\xc3`", "1:3-1:4 invalid UTF-8 byte 0xC3 in raw string" },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewScanner("test.aml", test.source).Scan();
+			var diag *Diagnostic;
+			if !errors.As(err, &diag) {
+				t.Fatalf("got %v, want %q", err, test.want);
+			}
+			span := diag.Span;
+			got := fmt.Sprintf("%d:%d-%d:%d %s", span.Start.Line, span.Start.Column, span.End.Line, span.End.Column, diag.Message);
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want);
+			}
+		});
+	}
+}
+
+func TestStrings(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+		want string; // the value of the first token, or the message of the error
+	}{
+		{ "raw keeps backslashes", "`C:\\new\\table`", "C:\\new\\table" },
+		{ "raw spans lines", "`a\nb`", "a\nb" },
+		{ "empty raw", "``", "" },
+		{ "quotes in a multi-line string", `"""x "quoted" y"""`, `x "quoted" y` },
+		{ "dedented", "\"\"\"\n    a\n      b\n    \"\"\"", "a\n  b" },
+		{ "tabs", "\"\"\"\n\ta\n\t\tb\n\"\"\"", "a\n\tb" },
+		{ "blank lines do not count", "\"\"\"\n\ta\n\n\tb\n\"\"\"", "a\n\nb" },
+		{ "text after the opening quotes", "\"\"\"a\n  b\"\"\"", "a\n  b" },
+		{ "unterminated raw", "`open", "unterminated raw string" },
+		{ "unterminated multi-line", "\"\"\"\nopen", "unterminated multi-line string" },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tokens, err := NewScanner("test.aml", test.source).Scan();
+			if err != nil {
+				var diag *Diagnostic;
+				if !errors.As(err, &diag) || diag.Message != test.want {
+					t.Errorf("got %v, want %q", err, test.want);
+				}
+				return;
+			}
+			if tokens[0].Type != STRING || tokens[0].Literal != test.want {
+				t.Errorf("got %v %q, want the string %q", tokens[0].Type, tokens[0].Literal, test.want);
+			}
+		});
+	}
+}
+
+// positions after a string that spans lines count from its last line
+func TestPositionsAfterMultilineString(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+		want string; // line:column-line:column of each token
+	}{
+		{ "raw", "`a\nb` x", "1:1-2:3 2:4-2:5 2:5-2:5" },
+		{ "same line", "\"\"\"a\n  b\"\"\" y", "1:1-2:7 2:8-2:9 2:9-2:9" },
+		{ "next line", "\"\"\"\n    a\n    \"\"\"\nx", "1:1-3:8 3:8-3:8 4:1-4:2 4:2-4:2" },
+		{ "end of the source", "\"\"\"\n\ta\n\"\"\"", "1:1-3:4 3:4-3:4" },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tokens, err := NewScanner("test.aml", test.source).Scan();
+			if err != nil {
+				t.Fatal(err);
+			}
+			spans := make([]string, len(tokens));
+			for i, token := range tokens {
+				span := token.Span();
+				spans[i] = fmt.Sprintf("%d:%d-%d:%d", span.Start.Line, span.Start.Column, span.End.Line, span.End.Column);
+			}
+			if got := strings.Join(spans, " "); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want);
+			}
+		});
+	}
+}
+
+// a reader returning one byte at a time splits every token, rune and comment across chunks
+func TestReaderScanner(t *testing.T) {
+	const source = "/// doc\nfunc größe(a) {\n\treturn `raw\nstring` + \"\"\"\n\t\tmulti\n\t\"\"\" /* a\n comment */ + 1_000.5e-1\n}\nprint größe(\"日本\")\n";
+	want, err := NewScanner("test.aml", source).Scan();
+	if err != nil {
+		t.Fatal(err);
+	}
+	got, err := NewReaderScanner("test.aml", iotest.OneByteReader(strings.NewReader(source))).Scan();
+	if err != nil {
+		t.Fatal(err);
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d tokens, want %d", len(got), len(want));
+	}
+	for i := range want {
+		if got[i].Type != want[i].Type || got[i].Lexeme != want[i].Lexeme || got[i].Literal != want[i].Literal ||
+			got[i].Span() != want[i].Span() || got[i].Doc != want[i].Doc || got[i].Inserted != want[i].Inserted {
+			t.Errorf("token %d: got %+v, want %+v", i, got[i], want[i]);
+		}
+	}
+}
+
+// the tokens read before the error are returned, then the error
+func TestReaderScannerError(t *testing.T) {
+	failure := errors.New("disk on fire");
+	s := NewReaderScanner("test.aml", io.MultiReader(strings.NewReader("print 1\n"), iotest.ErrReader(failure)));
+	var lexemes []string;
+	for {
+		token, err := s.Next();
+		if err != nil {
+			if !errors.Is(err, failure) {
+				t.Errorf("got %v, want %v", err, failure);
+			}
+			break;
+		}
+		if token.Type == EOF {
+			t.Fatal("got EOF, want the read error");
+		}
+		lexemes = append(lexemes, token.Lexeme);
+	}
+	if got := strings.Join(lexemes, " "); got != "print 1 ;" {
+		t.Errorf("got %q before the error, want %q", got, "print 1 ;");
+	}
+}
+
+func TestBlockComments(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+		want string; // the lexemes, or the position and message of the error
+	}{
+		{ "inline", "a /* b */ c", "a c ⏎" },
+		{ "nested", "a /* b /* c */ d */ e", "a e ⏎" },
+		{ "deeply nested", "/* /* /* */ */ */ x", "x ⏎" },
+		// a line break inside a comment does not end the statement
+		{ "over lines", "a = b /* c\nd */ + e", "a = b + e ⏎" },
+		{ "closing alone", "a */ b", "a * / b ⏎" },
+		{ "unterminated", "a /* b", "1:3-1:5 unterminated block comment" },
+		{ "unterminated inner", "/* a /* b */\nc", "1:1-1:3 unterminated block comment" },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewScanner("test.aml", test.source).Scan(); err != nil {
+				var diag *Diagnostic;
+				if !errors.As(err, &diag) || !diag.Incomplete {
+					t.Fatalf("got %v, want an incomplete input", err);
+				}
+				span := diag.Span;
+				if got := fmt.Sprintf("%d:%d-%d:%d %s", span.Start.Line, span.Start.Column, span.End.Line, span.End.Column, diag.Message); got != test.want {
+					t.Errorf("got %q, want %q", got, test.want);
+				}
+				return;
+			}
+			if got, _ := lexemes(t, test.source); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want);
+			}
+		});
+	}
+}
+
+// `///` lines right above a token document it
+func TestDocComments(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+		want string; // the doc of the last token
+	}{
+		{ "one line", "/// adds\nfunc", "adds" },
+		{ "consecutive lines", "/// adds\n/// two numbers\nfunc", "adds\ntwo numbers" },
+		{ "indented", "\t/// adds\n\tfunc", "adds" },
+		{ "only the space after the slashes is dropped", "///   adds\nfunc", "  adds" },
+		{ "blank line in between", "/// adds\n\nfunc", "" },
+		{ "gap between comments", "/// old\n\n/// adds\nfunc", "adds" },
+		{ "plain comment", "// adds\nfunc", "" },
+		{ "same line", "/// adds\nx func", "" },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tokens, err := NewScanner("test.aml", test.source).Scan();
+			if err != nil {
+				t.Fatal(err);
+			}
+			last := tokens[len(tokens)-1];
+			if last.Inserted {
+				last = tokens[len(tokens)-2];
+			}
+			if last.Doc != test.want {
+				t.Errorf("got %q, want %q", last.Doc, test.want);
+			}
+		});
+	}
+}
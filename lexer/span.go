@@ -0,0 +1,50 @@
+package lexer
+
+import "fmt";
+
+// Pos is a point in the source, Offset counts bytes while Column counts runes from 1
+type Pos struct {
+	Offset uint
+	Line uint
+	Column uint
+};
+
+func (pos Pos) Before(other Pos) bool {
+	return pos.Offset < other.Offset;
+}
+
+func (pos Pos) String() string {
+	return fmt.Sprintf("%d:%d", pos.Line, pos.Column);
+}
+
+// Span is the source range [Start, End) of a token or a node,
+// the zero Span belongs to nodes that do not come from the source
+type Span struct {
+	Start Pos
+	End Pos
+};
+
+func (span Span) IsZero() bool {
+	return span.Start.Line == 0;
+}
+
+func (span Span) String() string {
+	return span.Start.String();
+}
+
+// Cover returns the smallest span containing every non zero span
+func Cover(spans ...Span) Span {
+	covered := Span{};
+	for _, span := range spans {
+		if span.IsZero() {
+			continue;
+		}
+		if covered.IsZero() || span.Start.Before(covered.Start) {
+			covered.Start = span.Start;
+		}
+		if covered.IsZero() || covered.End.Before(span.End) {
+			covered.End = span.End;
+		}
+	}
+	return covered;
+}
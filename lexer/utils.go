@@ -1,8 +1,23 @@
 package lexer
 
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+);
+
+// identifiers follow the Unicode XID_Start/XID_Continue properties (UAX #31),
+// derived here from the general categories as the unicode package has no XID tables,
+// with the underscore allowed anywhere
 func IsAlpha(val rune) bool {
-	return 'a' <= val && val <= 'z' || 
-	       'A' <= val && val <= 'Z' || val == '_';
+	if val < 0x80 {
+		return 'a' <= val && val <= 'z' ||
+		       'A' <= val && val <= 'Z' || val == '_';
+	}
+	return (unicode.IsLetter(val) || unicode.Is(unicode.Nl, val) || unicode.Is(unicode.Other_ID_Start, val)) &&
+		!unicode.Is(unicode.Pattern_Syntax, val) && !unicode.Is(unicode.Pattern_White_Space, val);
 }
 
 func IsNum(val rune) bool {
@@ -10,7 +25,118 @@ func IsNum(val rune) bool {
 }
 
 func IsAlphaNum(val rune) bool {
-	return IsAlpha(val) || IsNum(val);
+	if val < 0x80 {
+		return IsAlpha(val) || IsNum(val);
+	}
+	return IsAlpha(val) || unicode.In(val, unicode.Mn, unicode.Mc, unicode.Nd, unicode.Pc, unicode.Other_ID_Continue) &&
+		!unicode.Is(unicode.Pattern_Syntax, val) && !unicode.Is(unicode.Pattern_White_Space, val);
+}
+
+// NormalizeIdentifier puts name in NFC so that `café` spelled with a combining accent
+// and with a precomposed 'é' is the same identifier
+func NormalizeIdentifier(name string) string {
+	return norm.NFC.String(name);
+}
+
+// scripts that are legitimately written together
+var script_families = map[string]string{
+	"Han": "CJK", "Hiragana": "CJK", "Katakana": "CJK", "Hangul": "CJK", "Bopomofo": "CJK",
+};
+
+// scripts_of returns the scripts of the letters in name, in order of appearance.
+// digits, underscores and combining marks belong to every script and are left out
+func scripts_of(name string) []string {
+	scripts := make([]string, 0, 1);
+	for _, r := range name {
+		if r < 0x80 && IsAlpha(r) && r != '_' {
+			if !contains(scripts, "Latin") {
+				scripts = append(scripts, "Latin");
+			}
+			continue;
+		}
+		if !IsAlpha(r) || r == '_' || unicode.Is(unicode.Common, r) || unicode.Is(unicode.Inherited, r) {
+			continue;
+		}
+		for script, table := range unicode.Scripts {
+			if unicode.Is(table, r) {
+				if !contains(scripts, script) {
+					scripts = append(scripts, script);
+				}
+				break;
+			}
+		}
+	}
+	return scripts;
+}
+
+func contains(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true;
+		}
+	}
+	return false;
+}
+
+// mixed_script reports the scripts of name when it mixes scripts that are not written together,
+// like a Cyrillic 'а' in an otherwise Latin name, which looks the same as another identifier
+func mixed_script(name string) ([]string, bool) {
+	scripts := scripts_of(name);
+	families := make(map[string]bool);
+	for _, script := range scripts {
+		if family, ok := script_families[script]; ok {
+			script = family;
+		}
+		families[script] = true;
+	}
+	if len(families) < 2 {
+		return nil, false;
+	}
+	sort.Strings(scripts);
+	return scripts, true;
+}
+
+func join_scripts(scripts []string) string {
+	if len(scripts) < 2 {
+		return strings.Join(scripts, "");
+	}
+	return strings.Join(scripts[:len(scripts)-1], ", ") + " and " + scripts[len(scripts)-1];
+}
+
+// dedent lays out a multi-line string the way it reads in the source: the line break after
+// the opening quotes and the line of the closing ones, when they are alone on it, are dropped,
+// then the indentation common to every line that is not blank is removed
+func dedent(text string) string {
+	lines := strings.Split(text, "\n");
+	if len(lines) > 1 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:];
+	}
+	if len(lines) > 1 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1];
+	}
+	indent := "";
+	first := true;
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue;
+		}
+		line_indent := line[:len(line) - len(strings.TrimLeft(line, " \t"))];
+		if first {
+			indent, first = line_indent, false;
+			continue;
+		}
+		for !strings.HasPrefix(line_indent, indent) {
+			indent = indent[:len(indent)-1];
+		}
+	}
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			lines[i] = "";
+		} else {
+			lines[i] = strings.TrimPrefix(line, indent);
+		}
+	}
+	return strings.Join(lines, "\n");
 }
 
 func Normalize(val int) float64 {
@@ -5,75 +5,393 @@ import (
 	"fmt"
 	"flag"
 	"bufio"
+	"strings"
+	"strconv"
+	"encoding/json"
 	"runtime/pprof"
 
 	"aml/lexer"
 	"aml/parser"
+	"aml/analyser"
+	"aml/symbols"
+	"aml/optimizer"
 	"aml/interpreter"
 )
 
-func evalAML(interpreter *interpreter.Interpreter, filename string, content string, use_pp bool) parser.Value {
+type options struct {
+	use_pp bool; // print the parsed AST
+	use_opt_pp bool; // print the optimized AST
+}
+
+func prettyPrint(stmts []parser.Stmt) {
+	for _, stmt := range stmts {
+		pp := parser.PrettyPrinter{};
+		pp.Print(stmt);
+	}
+}
+
+// the warnings are returned apart as where they go depends on the command
+func parseAML(filename string, content string) ([]parser.Stmt, []error, []error) {
 	s := lexer.NewScanner(filename, content);
-	tokens, err := s.Scan();
-	if err != nil {
-		fmt.Println(err);
+	p := parser.NewStreamParser(filename, s);
+	stmts, errs := p.Parse();
+	return stmts, errs, s.Warnings();
+}
+
+// reports whether code only failed to parse because it stopped early, like an unclosed brace
+func incomplete(code string) bool {
+	_, errs, _ := parseAML("REPL", code);
+	for _, err := range errs {
+		if d, ok := err.(*lexer.Diagnostic); !ok || !d.Incomplete {
+			return false;
+		}
+	}
+	return len(errs) != 0;
+}
+
+// prints every error with the source line it points at and reports whether there were any
+func reportErrors(errs []error, source string) bool {
+	for _, err := range errs {
+		fmt.Println(lexer.Render(err, source));
+	}
+	return len(errs) != 0;
+}
+
+func evalAML(interpreter *interpreter.Interpreter, filename string, content string, opts options) parser.Value {
+	stmts, errs, warnings := parseAML(filename, content);
+	reportErrors(warnings, content);
+	if reportErrors(errs, content) {
 		return nil;
 	}
-	// for _, token := range tokens {
-	// 	fmt.Println(token);
-	// }
-	p := parser.NewParser(filename, tokens);
-	stmts, err := p.Parse();
-	if err != nil {
-		fmt.Println(err);
+	if reportErrors(analyzer.NewResolver(filename).Resolve(stmts), content) {
 		return nil;
 	}
-	if use_pp {
-		for _, stmt := range stmts {
-			pp := parser.PrettyPrinter{};
-		 	pp.Print(stmt);
-		}
+	if reportErrors(analyzer.NewChecker(filename).Check(stmts), content) {
+		return nil;
+	}
+	// warnings never stop execution, argument counts only fail `aml check`
+	cg := analyzer.NewCallGraph(filename);
+	cg.Warn();
+	reportErrors(cg.Build(stmts), content);
+	reportErrors(analyzer.NewNullChecker(filename).Check(stmts), content);
+	if opts.use_pp {
+		prettyPrint(stmts);
+	}
+	stmts = optimizer.NewOptimizer().Optimize(stmts);
+	if opts.use_opt_pp {
+		prettyPrint(stmts);
 	}
 	val, err := interpreter.Interpret(stmts);
 	if err != nil {
-		fmt.Println(err);
+		fmt.Println(lexer.Render(err, content));
 		return nil;
 	}
 	return val;
 }
 
-func handleREPL(use_pp bool) {
+func handleREPL(opts options) {
 	reader := bufio.NewReader(os.Stdin);
-	i := interpreter.NewInterpreter(); 
+	i := interpreter.NewInterpreter("REPL");
+	code := "";
 	for {
-		fmt.Print(">> ");
-		code, err := reader.ReadString('\n');
+		if code == "" {
+			fmt.Print(">> ");
+		} else {
+			fmt.Print(".. ");
+		}
+		line, err := reader.ReadString('\n');
 		if err != nil {
 			fmt.Println(err);
 			fmt.Println("Terminating REPL Process...");
 			break;
 		}
-		val := evalAML(&i, "REPL", code, use_pp);
+		// an empty line gives up on the continuation and shows what is wrong
+		code += line;
+		if strings.TrimSpace(line) != "" && incomplete(code) {
+			continue;
+		}
+		val := evalAML(i, "REPL", code, opts);
+		code = "";
 		if val != nil {
 			fmt.Println(val);
 		}
 	}
 }
 
-func handleFile(filename string, use_pp bool) error {
+func handleFile(filename string, opts options) error {
 	bcode, err := os.ReadFile(filename);
 	if err != nil {
 		return err;
 	}
-	i := interpreter.NewInterpreter();
-	evalAML(&i, filename, string(bcode), use_pp);
+	i := interpreter.NewInterpreter(filename);
+	evalAML(i, filename, string(bcode), opts);
 	return nil;
 }
 
+// aml check <file_name>...: type and null checks without executing anything
+func handleCheck(filenames []string) bool {
+	ok := true;
+	for _, filename := range filenames {
+		bcode, err := os.ReadFile(filename);
+		if err != nil {
+			fmt.Println(err);
+			ok = false;
+			continue;
+		}
+		stmts, errs, warnings := parseAML(filename, string(bcode));
+		reportErrors(warnings, string(bcode));
+		if reportErrors(errs, string(bcode)) {
+			ok = false;
+			continue;
+		}
+		// like running the file, misplaced control flow and declarations come first
+		if reportErrors(analyzer.NewResolver(filename).Resolve(stmts), string(bcode)) {
+			ok = false;
+			continue;
+		}
+		if reportErrors(analyzer.NewChecker(filename).Check(stmts), string(bcode)) {
+			ok = false;
+		}
+		if reportErrors(analyzer.NewCallGraph(filename).Build(stmts), string(bcode)) {
+			ok = false;
+		}
+		reportErrors(analyzer.NewNullChecker(filename).Check(stmts), string(bcode));
+	}
+	return ok;
+}
+
+// aml callgraph <file_name>: prints the call graph in graphviz DOT format
+func handleCallGraph(args []string) bool {
+	filename := args[0];
+	bcode, err := os.ReadFile(filename);
+	if err != nil {
+		fmt.Println(err);
+		return false;
+	}
+	stmts, errs, warnings := parseAML(filename, string(bcode));
+	if reportErrors(errs, string(bcode)) {
+		return false;
+	}
+	cg := analyzer.NewCallGraph(filename);
+	errs = cg.Build(stmts);
+	for _, err := range append(warnings, errs...) {
+		fmt.Fprintln(os.Stderr, lexer.Render(err, string(bcode)));
+	}
+	fmt.Print(cg.DOT());
+	return len(errs) == 0;
+}
+
+// unified diff of two versions of a file with the same number of lines,
+// which is all a rename produces
+func unifiedDiff(filename string, old string, new string) string {
+	old_lines := diffLines(old);
+	new_lines := diffLines(new);
+	const context = 3;
+	var sb strings.Builder;
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", filename, filename);
+	for i := 0; i < len(old_lines); i++ {
+		if old_lines[i] == new_lines[i] {
+			continue;
+		}
+		// extend the hunk while the context of the next change would touch it
+		start, end := max(0, i - context), i;
+		for j := i; j < len(old_lines) && j <= end + 2 * context + 1; j++ {
+			if old_lines[j] != new_lines[j] {
+				end = j;
+			}
+		}
+		end = min(len(old_lines) - 1, end + context);
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", start + 1, end - start + 1, start + 1, end - start + 1);
+		for j := start; j <= end; {
+			if old_lines[j] == new_lines[j] {
+				writeDiffLine(&sb, " ", old_lines[j]);
+				j++;
+				continue;
+			}
+			// a run of changed lines is removed, then added back
+			run := j;
+			for run <= end && old_lines[run] != new_lines[run] {
+				run++;
+			}
+			for k := j; k < run; k++ {
+				writeDiffLine(&sb, "-", old_lines[k]);
+			}
+			for k := j; k < run; k++ {
+				writeDiffLine(&sb, "+", new_lines[k]);
+			}
+			j = run;
+		}
+		i = end;
+	}
+	return sb.String();
+}
+
+// the lines of text with their line breaks, without the empty line after the last break
+func diffLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n");
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1];
+	}
+	return lines;
+}
+
+func writeDiffLine(sb *strings.Builder, prefix string, line string) {
+	sb.WriteString(prefix);
+	sb.WriteString(line);
+	if !strings.HasSuffix(line, "\n") {
+		sb.WriteString("\n\\ No newline at end of file\n");
+	}
+}
+
+// <file_name>:<line>:<column>
+func parseTarget(target string) (symbols.Pos, error) {
+	parts := strings.Split(target, ":");
+	if len(parts) < 3 {
+		return symbols.Pos{}, fmt.Errorf("expected <file_name>:<line>:<column>, got '%s'", target);
+	}
+	line, lerr := strconv.ParseUint(parts[len(parts)-2], 10, 0);
+	column, cerr := strconv.ParseUint(parts[len(parts)-1], 10, 0);
+	if lerr != nil || cerr != nil {
+		return symbols.Pos{}, fmt.Errorf("expected <file_name>:<line>:<column>, got '%s'", target);
+	}
+	return symbols.Pos{
+		File: strings.Join(parts[:len(parts)-2], ":"),
+		Line: uint(line),
+		Column: uint(column),
+	}, nil;
+}
+
+// aml rename [-w] <file_name>:<line>:<column> <new_name>
+func handleRename(args []string) bool {
+	flags := flag.NewFlagSet("rename", flag.ExitOnError);
+	write := flags.Bool("w", false, "write the result to the file instead of printing a diff");
+	flags.Parse(args);
+	if flags.NArg() != 2 {
+		usage();
+		return false;
+	}
+	pos, err := parseTarget(flags.Arg(0));
+	if err != nil {
+		fmt.Println(err);
+		return false;
+	}
+	bcode, err := os.ReadFile(pos.File);
+	if err != nil {
+		fmt.Println(err);
+		return false;
+	}
+	stmts, errs, _ := parseAML(pos.File, string(bcode));
+	if reportErrors(errs, string(bcode)) {
+		return false;
+	}
+	idx := symbols.NewIndex();
+	idx.AddFile(pos.File, stmts);
+	edits, err := idx.Rename(pos, flags.Arg(1));
+	if err != nil {
+		fmt.Println(err);
+		return false;
+	}
+	renamed, err := symbols.ApplyEdits(string(bcode), edits);
+	if err != nil {
+		fmt.Println(err);
+		return false;
+	}
+	if *write {
+		if err := os.WriteFile(pos.File, []byte(renamed), 0644); err != nil {
+			fmt.Println(err);
+			return false;
+		}
+		return true;
+	}
+	fmt.Print(unifiedDiff(pos.File, string(bcode), renamed));
+	return true;
+}
+
+const lintConfigFile = ".amllint.json";
+
+// aml lint [-json] [-config <path>] <file_name>...
+func handleLint(args []string) bool {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError);
+	as_json := flags.Bool("json", false, "print diagnostics as JSON");
+	config_path := flags.String("config", "", "lint config file, defaults to " + lintConfigFile + " when present");
+	flags.Parse(args);
+
+	config := analyzer.LintConfig{};
+	if *config_path == "" {
+		if _, err := os.Stat(lintConfigFile); err == nil {
+			*config_path = lintConfigFile;
+		}
+	}
+	if *config_path != "" {
+		var err error;
+		config, err = analyzer.LoadLintConfig(*config_path);
+		if err != nil {
+			fmt.Println(err);
+			return false;
+		}
+	}
+
+	ok := true;
+	diagnostics := make([]analyzer.LintDiagnostic, 0);
+	for _, filename := range flags.Args() {
+		bcode, err := os.ReadFile(filename);
+		if err != nil {
+			fmt.Println(err);
+			ok = false;
+			continue;
+		}
+		stmts, errs, warnings := parseAML(filename, string(bcode));
+		for _, warning := range warnings {
+			fmt.Fprintln(os.Stderr, lexer.Render(warning, string(bcode)));
+		}
+		if reportErrors(errs, string(bcode)) {
+			ok = false;
+			continue;
+		}
+		diagnostics = append(diagnostics, analyzer.NewLinter(filename, string(bcode), config).Lint(stmts)...);
+	}
+	if *as_json {
+		bytes, _ := json.MarshalIndent(diagnostics, "", "  ");
+		fmt.Println(string(bytes));
+	} else {
+		for _, diag := range diagnostics {
+			fmt.Println(diag);
+		}
+	}
+	return ok && len(diagnostics) == 0;
+}
+
+func usage() {
+	fmt.Printf("usage: %s [-p] [-po] <file_name>\n", os.Args[0]);
+	fmt.Printf("       %s check <file_name>...\n", os.Args[0]);
+	fmt.Printf("       %s callgraph <file_name>\n", os.Args[0]);
+	fmt.Printf("       %s rename [-w] <file_name>:<line>:<column> <new_name>\n", os.Args[0]);
+	fmt.Printf("       %s lint [-json] [-config <path>] <file_name>...\n", os.Args[0]);
+}
+
 func main() {
 	repl := flag.Bool("repl", false, "use repl? else interpret file")
 	use_pp := flag.Bool("p", false, "Use PrettyPrinter to Print ASTs");
+	use_opt_pp := flag.Bool("po", false, "Use PrettyPrinter to Print optimized ASTs");
 	flag.Parse();
+	args := flag.Args();
+
+	if len(args) > 0 && (args[0] == "check" || args[0] == "lint" || args[0] == "callgraph" || args[0] == "rename") {
+		if len(args) < 2 {
+			usage();
+			os.Exit(2);
+		}
+		handler := handleCheck;
+		switch args[0] {
+			case "lint": handler = handleLint;
+			case "callgraph": handler = handleCallGraph;
+			case "rename": handler = handleRename;
+		}
+		if !handler(args[1:]) {
+			os.Exit(1);
+		}
+		return;
+	}
 
 	f, err := os.Create("cpu.prof");
 	if err != nil {
@@ -85,13 +403,13 @@ func main() {
 	defer pprof.StopCPUProfile()
 
 	if *repl {
-		handleREPL(*use_pp);
+		handleREPL(options{ use_pp: *use_pp, use_opt_pp: *use_opt_pp });
 	} else {
-		if len(os.Args) < 2 {
-			fmt.Printf("usage: %s [-p] <file_name>\n", os.Args[0]);
+		if len(args) < 1 {
+			usage();
 			return;
 		}
-		err := handleFile(os.Args[len(os.Args) - 1], *use_pp);
+		err := handleFile(args[len(args) - 1], options{ use_pp: *use_pp, use_opt_pp: *use_opt_pp });
 		if err != nil {
 			fmt.Println(err);
 		}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"aml/interpreter"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string;
+		old string;
+		new string;
+		want string;
+	}{
+		{
+			"unchanged", "a\nb\n", "a\nb\n",
+			"--- f.aml\n+++ f.aml\n",
+		},
+		{
+			"first line", "a\nb\nc\nd\ne\nf\n", "x\nb\nc\nd\ne\nf\n",
+			"--- f.aml\n+++ f.aml\n@@ -1,4 +1,4 @@\n-a\n+x\n b\n c\n d\n",
+		},
+		// the hunk stops at the last line, not at the empty string after its line break
+		{
+			"last line", "a\nb\nc\nd\ne\nf\n", "a\nb\nc\nd\ne\nx\n",
+			"--- f.aml\n+++ f.aml\n@@ -3,4 +3,4 @@\n c\n d\n e\n-f\n+x\n",
+		},
+		{
+			"no newline at the end", "a\nb", "a\nx",
+			"--- f.aml\n+++ f.aml\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+x\n\\ No newline at end of file\n",
+		},
+		{
+			"adjacent lines", "a\nb\nc\n", "x\ny\nc\n",
+			"--- f.aml\n+++ f.aml\n@@ -1,3 +1,3 @@\n-a\n-b\n+x\n+y\n c\n",
+		},
+		{
+			"close changes share a hunk", "a\nb\nc\nd\ne\nf\ng\nh\n", "x\nb\nc\nd\ne\nf\ng\ny\n",
+			"--- f.aml\n+++ f.aml\n@@ -1,8 +1,8 @@\n-a\n+x\n b\n c\n d\n e\n f\n g\n-h\n+y\n",
+		},
+		{
+			"distant changes", "a\n1\n2\n3\n4\n5\n6\n7\nb\n", "x\n1\n2\n3\n4\n5\n6\n7\ny\n",
+			"--- f.aml\n+++ f.aml\n@@ -1,4 +1,4 @@\n-a\n+x\n 1\n 2\n 3\n@@ -6,4 +6,4 @@\n 5\n 6\n 7\n-b\n+y\n",
+		},
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := unifiedDiff("f.aml", test.old, test.new); got != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want);
+			}
+		});
+	}
+}
+
+// the Checker and the CallGraph accept these, only the Resolver refuses them
+func TestCheckResolves(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+		want bool;
+	}{
+		{ "valid", "var a = 1; print a;", true },
+		{ "return at the top level", "return 1;", false },
+		{ "break outside a loop", "break;", false },
+		{ "own initializer", "{ var a = a; }", false },
+		{ "redeclared", "{ var a = 1; var a = 2; }", false },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "test.aml");
+			if err := os.WriteFile(filename, []byte(test.source), 0o644); err != nil {
+				t.Fatal(err);
+			}
+			if got := handleCheck([]string{ filename }); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want);
+			}
+		});
+	}
+}
+
+// a call with the wrong number of arguments in code that never runs
+const dead_mismatch = `func f(a) { return a; } var r = "skipped"; if (false) f(1, 2, 3); r = "ran"; r;`;
+
+func TestArityMismatchWarns(t *testing.T) {
+	if got := evalAML(interpreter.NewInterpreter("test.aml"), "test.aml", dead_mismatch, options{}); got != "ran" {
+		t.Errorf("running got %v, want ran", got);
+	}
+	filename := filepath.Join(t.TempDir(), "test.aml");
+	if err := os.WriteFile(filename, []byte(dead_mismatch), 0o644); err != nil {
+		t.Fatal(err);
+	}
+	if handleCheck([]string{ filename }) {
+		t.Error("check passed, want the mismatch to fail it");
+	}
+}
+
+// the REPL keeps reading lines while the code only failed because it stopped early
+func TestIncomplete(t *testing.T) {
+	tests := []struct {
+		name string;
+		code string;
+		want bool;
+	}{
+		{ "unclosed block", "{", true },
+		{ "function body", "func f() {\n", true },
+		{ "class body", "class C {", true },
+		{ "unclosed parenthesis", "print (1 +", true },
+		{ "argument list", "f(1,\n", true },
+		{ "operator at the end", "print 1 +", true },
+		{ "pipeline", "x |>", true },
+		{ "initializer", "var a =", true },
+		{ "if without a body", "if (x)", true },
+		{ "else without a body", "if (x) {} else", true },
+		{ "string", "print \"abc", true },
+		{ "raw string", "`abc", true },
+		{ "multi-line string", "\"\"\"\nabc", true },
+		{ "block comment", "/* comment", true },
+
+		{ "statement", "print 1;", false },
+		{ "statement ended by the line break", "print 1", false },
+		{ "syntax error", "print );", false },
+		// more lines would not fix the error
+		{ "syntax error in an unclosed block", "{ print );", false },
+		{ "stray brace", "}", false },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := incomplete(test.code); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want);
+			}
+		});
+	}
+}
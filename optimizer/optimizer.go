@@ -0,0 +1,379 @@
+package optimizer
+
+import (
+	"aml/lexer"
+	"aml/parser"
+)
+
+// Optimizer rewrites the AST before it is interpreted: it folds constant expressions,
+// picks the branch of constant conditions and drops code that can never run.
+// it has to preserve semantics exactly, so anything that would fail at runtime
+// (like `1 + "a"` or an operator applied to null) is left untouched.
+// every Visit method returns the rewritten node, a nil statement is dropped.
+type Optimizer struct {}
+
+func NewOptimizer() *Optimizer {
+	return &Optimizer{};
+}
+
+func (opt *Optimizer) expr(expr parser.Expr) parser.Expr {
+	if expr == nil {
+		return nil;
+	}
+	optimized, _ := parser.Accept(expr, opt);
+	return optimized;
+}
+
+// statements in a position that requires one (like a loop body) are never dropped
+func (opt *Optimizer) stmt(stmt parser.Stmt) parser.Stmt {
+	if stmt == nil {
+		return nil;
+	}
+	optimized, _ := parser.AcceptStmt(stmt, opt);
+	if optimized == nil {
+		return parser.BlockStmt{ Stmts: []parser.Stmt{} };
+	}
+	return optimized;
+}
+
+func (opt *Optimizer) stmts(stmts []parser.Stmt) []parser.Stmt {
+	optimized := make([]parser.Stmt, 0, len(stmts));
+	for _, stmt := range stmts {
+		val, _ := parser.AcceptStmt(stmt, opt);
+		if val == nil {
+			continue;
+		}
+		optimized = append(optimized, val);
+		// everything after a jump is unreachable
+		switch val.(type) {
+			case parser.ReturnStmt, parser.BreakStmt, parser.ContinueStmt: {
+				return optimized;
+			}
+		}
+	}
+	return optimized;
+}
+
+func literal(expr parser.Expr) (parser.Value, bool) {
+	lit, ok := expr.(parser.LiteralExpr);
+	if !ok {
+		return nil, false;
+	}
+	return lit.ValueLiteral, true;
+}
+
+// a folded literal spans the expression it replaces, runtime errors still point at the source
+func folded(val parser.Value, span lexer.Span) parser.LiteralExpr {
+	return parser.LiteralExpr{
+		ValueLiteral: val,
+		Token: lexer.Token{
+			Line: span.Start.Line,
+			Column: span.Start.Column,
+			Offset: span.Start.Offset,
+			End: span.End,
+		},
+	};
+}
+
+// mirrors Interpreter.extract_boolean
+func truthy(val parser.Value) bool {
+	return !(val == nil || val == false);
+}
+
+func fold_binary(operator lexer.TokenType, left parser.Value, right parser.Value) (parser.Value, bool) {
+	if lnum, ok := left.(float64); ok {
+		rnum, ok := right.(float64);
+		if !ok {
+			return nil, false;
+		}
+		switch operator {
+			case lexer.PLUS: return lnum + rnum, true;
+			case lexer.MINUS: return lnum - rnum, true;
+			case lexer.STAR: return lnum * rnum, true;
+			case lexer.SLASH: return lnum / rnum, true;
+			case lexer.GREATER: return lnum > rnum, true;
+			case lexer.GREATER_EQUAL: return lnum >= rnum, true;
+			case lexer.LESS: return lnum < rnum, true;
+			case lexer.LESS_EQUAL: return lnum <= rnum, true;
+			case lexer.EQUAL_EQUAL: return lnum == rnum, true;
+			case lexer.BANG_EQUAL: return lnum != rnum, true;
+		}
+		return nil, false;
+	}
+	if lstr, ok := left.(string); ok {
+		rstr, ok := right.(string);
+		if !ok {
+			return nil, false;
+		}
+		switch operator {
+			case lexer.PLUS: return lstr + rstr, true;
+			case lexer.EQUAL_EQUAL: return lstr == rstr, true;
+			case lexer.BANG_EQUAL: return lstr != rstr, true;
+		}
+		return nil, false;
+	}
+	if lbool, ok := left.(bool); ok {
+		rbool, ok := right.(bool);
+		if !ok {
+			return nil, false;
+		}
+		switch operator {
+			case lexer.EQUAL_EQUAL: return lbool == rbool, true;
+			case lexer.BANG_EQUAL: return lbool != rbool, true;
+		}
+	}
+	return nil, false;
+}
+
+// expressions
+func (opt *Optimizer) VisitBinary(expr parser.BinaryExpr) (parser.Expr, error) {
+	expr.LOperand = opt.expr(expr.LOperand);
+	expr.ROperand = opt.expr(expr.ROperand);
+	left, lok := literal(expr.LOperand);
+	right, rok := literal(expr.ROperand);
+	if lok && rok {
+		if val, ok := fold_binary(expr.Operator.Type, left, right); ok {
+			return folded(val, expr.Span()), nil;
+		}
+	}
+	return expr, nil;
+}
+
+func (opt *Optimizer) VisitUnary(expr parser.UnaryExpr) (parser.Expr, error) {
+	expr.Operand = opt.expr(expr.Operand);
+	val, ok := literal(expr.Operand);
+	if !ok || val == nil {
+		return expr, nil;
+	}
+	switch expr.Operator.Type {
+		case lexer.BANG: {
+			return folded(!truthy(val), expr.Span()), nil;
+		}
+		case lexer.MINUS: {
+			if num, ok := val.(float64); ok {
+				return folded(-num, expr.Span()), nil;
+			}
+		}
+	}
+	return expr, nil;
+}
+
+func (opt *Optimizer) VisitTernary(expr parser.TernaryExpr) (parser.Expr, error) {
+	expr.Cond = opt.expr(expr.Cond);
+	expr.Iftrue = opt.expr(expr.Iftrue);
+	expr.Iffalse = opt.expr(expr.Iffalse);
+	if cond, ok := literal(expr.Cond); ok {
+		if truthy(cond) {
+			return expr.Iftrue, nil;
+		}
+		return expr.Iffalse, nil;
+	}
+	return expr, nil;
+}
+
+func (opt *Optimizer) VisitGroup(expr parser.GroupingExpr) (parser.Expr, error) {
+	expr.InnerExpr = opt.expr(expr.InnerExpr);
+	if _, ok := literal(expr.InnerExpr); ok {
+		return expr.InnerExpr, nil;
+	}
+	return expr, nil;
+}
+
+func (opt *Optimizer) VisitLiteral(expr parser.LiteralExpr) (parser.Expr, error) {
+	return expr, nil;
+}
+
+func (opt *Optimizer) VisitVariable(expr parser.VariableExpr) (parser.Expr, error) {
+	return expr, nil;
+}
+
+func (opt *Optimizer) VisitAssign(expr parser.AssignExpr) (parser.Expr, error) {
+	expr.Asset = opt.expr(expr.Asset);
+	return expr, nil;
+}
+
+func (opt *Optimizer) VisitFuncCall(expr parser.FuncCall) (parser.Expr, error) {
+	expr.Callee = opt.expr(expr.Callee);
+	args := make([]parser.Expr, len(expr.Args));
+	for i, arg := range expr.Args {
+		args[i] = opt.expr(arg);
+	}
+	expr.Args = args;
+	return expr, nil;
+}
+
+func (opt *Optimizer) VisitCoalesce(expr parser.CoalesceExpr) (parser.Expr, error) {
+	expr.LOperand = opt.expr(expr.LOperand);
+	expr.ROperand = opt.expr(expr.ROperand);
+	if left, ok := literal(expr.LOperand); ok {
+		if left != nil {
+			return expr.LOperand, nil;
+		}
+		return expr.ROperand, nil;
+	}
+	return expr, nil;
+}
+
+func (opt *Optimizer) VisitOptionalChain(expr parser.OptionalChainExpr) (parser.Expr, error) {
+	expr.Chain = opt.expr(expr.Chain);
+	return expr, nil;
+}
+
+func (opt *Optimizer) VisitTuple(expr parser.TupleExpr) (parser.Expr, error) {
+	elements := make([]parser.Expr, len(expr.Elements));
+	for i, element := range expr.Elements {
+		elements[i] = opt.expr(element);
+	}
+	expr.Elements = elements;
+	return expr, nil;
+}
+
+func (opt *Optimizer) VisitIndex(expr parser.IndexExpr) (parser.Expr, error) {
+	expr.Object = opt.expr(expr.Object);
+	expr.Index = opt.expr(expr.Index);
+	return expr, nil;
+}
+
+func (opt *Optimizer) VisitGet(expr parser.GetExpr) (parser.Expr, error) {
+	expr.Object = opt.expr(expr.Object);
+	return expr, nil;
+}
+
+func (opt *Optimizer) VisitSet(expr parser.SetExpr) (parser.Expr, error) {
+	expr.Object = opt.expr(expr.Object);
+	expr.Asset = opt.expr(expr.Asset);
+	return expr, nil;
+}
+
+func (opt *Optimizer) VisitThis(expr parser.ThisExpr) (parser.Expr, error) {
+	return expr, nil;
+}
+
+// statements
+func (opt *Optimizer) VisitExpr(stmt parser.ExprStmt) (parser.Stmt, error) {
+	stmt.InnerExpr = opt.expr(stmt.InnerExpr);
+	return stmt, nil;
+}
+
+func (opt *Optimizer) VisitVariableDeclaration(stmt parser.VarDeclarationStmt) (parser.Stmt, error) {
+	stmt.Asset = opt.expr(stmt.Asset);
+	return stmt, nil;
+}
+
+func (opt *Optimizer) VisitVarUnpack(stmt parser.VarUnpackStmt) (parser.Stmt, error) {
+	stmt.Asset = opt.expr(stmt.Asset);
+	return stmt, nil;
+}
+
+func (opt *Optimizer) VisitFuncDeclarationStmt(stmt parser.FuncDeclarationStmt) (parser.Stmt, error) {
+	stmt.Body = opt.stmts(stmt.Body);
+	return stmt, nil;
+}
+
+func (opt *Optimizer) methods(methods []parser.Func) []parser.Func {
+	optimized := make([]parser.Func, len(methods));
+	for i, method := range methods {
+		method.Body = opt.stmts(method.Body);
+		optimized[i] = method;
+	}
+	return optimized;
+}
+
+func (opt *Optimizer) VisitClass(stmt parser.ClassStmt) (parser.Stmt, error) {
+	stmt.Methods = opt.methods(stmt.Methods);
+	return stmt, nil;
+}
+
+func (opt *Optimizer) VisitTrait(stmt parser.TraitStmt) (parser.Stmt, error) {
+	stmt.Defaults = opt.methods(stmt.Defaults);
+	return stmt, nil;
+}
+
+func (opt *Optimizer) VisitReturn(stmt parser.ReturnStmt) (parser.Stmt, error) {
+	stmt.Asset = opt.expr(stmt.Asset);
+	return stmt, nil;
+}
+
+func (opt *Optimizer) VisitBreak(stmt parser.BreakStmt) (parser.Stmt, error) {
+	return stmt, nil;
+}
+
+func (opt *Optimizer) VisitContinue(stmt parser.ContinueStmt) (parser.Stmt, error) {
+	return stmt, nil;
+}
+
+func (opt *Optimizer) VisitPrint(stmt parser.PrintStmt) (parser.Stmt, error) {
+	assets := make([]parser.Expr, len(stmt.Assets));
+	for i, asset := range stmt.Assets {
+		assets[i] = opt.expr(asset);
+	}
+	stmt.Assets = assets;
+	return stmt, nil;
+}
+
+func (opt *Optimizer) VisitBlock(stmt parser.BlockStmt) (parser.Stmt, error) {
+	stmt.Stmts = opt.stmts(stmt.Stmts);
+	if len(stmt.Stmts) == 0 {
+		return nil, nil;
+	}
+	return stmt, nil;
+}
+
+func (opt *Optimizer) VisitConditional(stmt parser.ConditionalStmt) (parser.Stmt, error) {
+	branches := make([]parser.ConditionalBranch, 0, len(stmt.Branches));
+	for _, branch := range stmt.Branches {
+		branch.Condition = opt.expr(branch.Condition);
+		branch.NDStmt = opt.stmt(branch.NDStmt);
+		cond, constant := literal(branch.Condition);
+		if constant && !truthy(cond) {
+			continue;
+		}
+		if constant {
+			// always taken, acts like an else and the remaining branches are dead
+			branch.Condition = nil;
+		}
+		branches = append(branches, branch);
+		if branch.Condition == nil {
+			break;
+		}
+	}
+	if len(branches) == 0 {
+		return nil, nil;
+	}
+	// its statement is already optimized
+	if branches[0].Condition == nil {
+		return branches[0].NDStmt, nil;
+	}
+	stmt.Branches = branches;
+	return stmt, nil;
+}
+
+func (opt *Optimizer) VisitWhile(stmt parser.WhileStmt) (parser.Stmt, error) {
+	stmt.Cond = opt.expr(stmt.Cond);
+	if cond, ok := literal(stmt.Cond); ok && !truthy(cond) {
+		return nil, nil;
+	}
+	stmt.NDStmt = opt.stmt(stmt.NDStmt);
+	return stmt, nil;
+}
+
+func (opt *Optimizer) VisitFor(stmt parser.ForStmt) (parser.Stmt, error) {
+	if stmt.Init != nil {
+		stmt.Init = opt.stmt(stmt.Init);
+	}
+	stmt.Cond = opt.expr(stmt.Cond);
+	if cond, ok := literal(stmt.Cond); ok && !truthy(cond) {
+		// the initializer still runs once
+		if stmt.Init == nil {
+			return nil, nil;
+		}
+		return stmt.Init, nil;
+	}
+	stmt.Step = opt.expr(stmt.Step);
+	stmt.NDStmt = opt.stmt(stmt.NDStmt);
+	return stmt, nil;
+}
+
+func (opt *Optimizer) Optimize(stmts []parser.Stmt) []parser.Stmt {
+	return opt.stmts(stmts);
+}
@@ -0,0 +1,80 @@
+package optimizer
+
+import (
+	"strings"
+	"testing"
+
+	"aml/lexer"
+	"aml/parser"
+)
+
+func parse(t *testing.T, source string) []parser.Stmt {
+	t.Helper();
+	stmts, errs := parser.NewStreamParser("test.aml", lexer.NewScanner("test.aml", source)).Parse();
+	if len(errs) != 0 {
+		t.Fatalf("parsing %q: %v", source, errs[0]);
+	}
+	return stmts;
+}
+
+// the trees of stmts, without their spans, so that an optimized tree compares equal to the source it should read as
+func tree(stmts []parser.Stmt) string {
+	sb := strings.Builder{};
+	for _, stmt := range stmts {
+		str, _ := parser.AcceptStmt(stmt, &parser.PrettyPrinter{});
+		sb.WriteString(str);
+	}
+	return sb.String();
+}
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+		want string; // parsed as is
+	}{
+		{ "arithmetic", "print 1 + 2 * 3;", "print 7;" },
+		{ "strings", `print "a" + "b";`, `print "ab";` },
+		{ "negation", "print -(1 + 1) + 5;", "print 3;" },
+		{ "not", "print !0;", "print false;" },
+		{ "ternary", "print 1 < 2 ? a : b;", "print a;" },
+		{ "coalesce", "print null ?? a;", "print a;" },
+
+		// the interpreter fails on these, folding would hide the error or change it
+		{ "number plus string", `print 1 + "a";`, `print 1 + "a";` },
+		{ "in a group", `print (1 + "a") + 2;`, `print (1 + "a") + 2;` },
+		{ "negated null", "print -null;", "print -null;" },
+		{ "negated string", `print -"a";`, `print -"a";` },
+		{ "variables", "print a + 1;", "print a + 1;" },
+
+		{ "if false", "if (false) print 1;", "" },
+		{ "if true", "if (1 < 2) print 1; else print 2;", "print 1;" },
+		{ "false then true", "if (false) print 1; else if (true) print 2; else print 3;", "print 2;" },
+		{ "true elif ends the chain", "if (x) print 1; else if (true) print 2; else print 3;", "if (x) print 1; else print 2;" },
+		{ "false elif is dropped", "if (x) print 1; else if (false) print 2; else print 3;", "if (x) print 1; else print 3;" },
+		{ "false first branch", "if (1 > 2) print 1; else if (x) print 2;", "if (x) print 2;" },
+		{ "all false", "if (false) print 1; else if (null) print 2;", "" },
+		{ "true around a dead branch", "if (true) if (false) print 1; else print 2;", "print 2;" },
+		{ "true around a true branch", "if (true) { if (1 < 2) print 1 + 1; }", "{ print 2; }" },
+
+		{ "while false", "while (false) print 1;", "" },
+		{ "for false keeps its initializer", "for (var i = 0; false; i = i + 1) print i;", "var i = 0;" },
+		{ "for false without initializer", "for (; false;) print 1;", "" },
+		{ "for true", "for (var i = 0; i < 2; i = i + 1) print 1 + 1;", "for (var i = 0; i < 2; i = i + 1) print 2;" },
+
+		{ "after return", "func f() { return 1; print 2; }", "func f() { return 1; }" },
+		{ "after return in a block", "func f() { { return 1; print 2; } print 3; }", "func f() { { return 1; } print 3; }" },
+		{ "after return in a branch", "func f(x) { if (x) return 1; print 2; }", "func f(x) { if (x) return 1; print 2; }" },
+		{ "after break", "while (x) { break; print 1; } print 2;", "while (x) { break; } print 2;" },
+		{ "after continue in a branch", "while (x) { if (y) { continue; print 1; } print 2; }", "while (x) { if (y) { continue; } print 2; }" },
+		{ "method", "class C { f() { return 1; print 2; } }", "class C { f() { return 1; } }" },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := tree(NewOptimizer().Optimize(parse(t, test.source)));
+			if want := tree(parse(t, test.want)); got != want {
+				t.Errorf("got\n%s\nwant\n%s", got, want);
+			}
+		});
+	}
+}
@@ -1,21 +1,34 @@
 package parser;
 
-import "aml/lexer";
-
-// TODO: add generic return value ASAP
-type ExprVisitor interface {
-	VisitTernary(TernaryExpr) (Value, error);
-	VisitBinary(BinaryExpr) (Value, error);
-	VisitUnary(UnaryExpr) (Value, error);
-	VisitLiteral(LiteralExpr) (Value, error);
-	VisitVariable(VariableExpr) (Value, error);
-	VisitGroup(GroupingExpr) (Value, error);
-	VisitAssign(AssignExpr) (Value, error);
-	VisitFuncCall(FuncCall) (Value, error);
+import (
+	"fmt"
+
+	"aml/lexer"
+);
+
+// ExprVisitor computes a T out of an expression: a printer returns strings,
+// the checker types and the interpreter values
+type ExprVisitor[T any] interface {
+	VisitTernary(TernaryExpr) (T, error);
+	VisitBinary(BinaryExpr) (T, error);
+	VisitUnary(UnaryExpr) (T, error);
+	VisitLiteral(LiteralExpr) (T, error);
+	VisitVariable(VariableExpr) (T, error);
+	VisitGroup(GroupingExpr) (T, error);
+	VisitAssign(AssignExpr) (T, error);
+	VisitFuncCall(FuncCall) (T, error);
+	VisitCoalesce(CoalesceExpr) (T, error);
+	VisitOptionalChain(OptionalChainExpr) (T, error);
+	VisitTuple(TupleExpr) (T, error);
+	VisitIndex(IndexExpr) (T, error);
+	VisitGet(GetExpr) (T, error);
+	VisitSet(SetExpr) (T, error);
+	VisitThis(ThisExpr) (T, error);
 }
 
 type Expr interface {
-	Accept(ExprVisitor) (Value, error);
+	Span() lexer.Span; // the full source range of the expression
+	expr(); // only the nodes of this file are expressions
 };
 
 type TernaryExpr struct {
@@ -37,54 +50,196 @@ type UnaryExpr struct {
 
 type LiteralExpr struct {
 	ValueLiteral Value;
+	Token lexer.Token; // the literal itself, spans the folded expression for optimized literals
+};
+
+// filled in place by the analyser's Resolver, the pointer is shared
+// between every copy of the node that references it
+type Resolution struct {
+	Resolved bool;
+	Depth int; // scopes between the reference and its declaration, -1 for globals
 };
 
 type VariableExpr struct {
 	Name lexer.Token;
+	Res *Resolution;
 };
 
 type GroupingExpr struct {
+	LeftParen lexer.Token
 	InnerExpr Expr
+	RightParen lexer.Token
 };
 
 type AssignExpr struct {
 	Name lexer.Token;
 	Asset Expr;
+	Res *Resolution;
 };
 
 type FuncCall struct {
 	Callee Expr;
 	Args[] Expr;
+	Optional bool; // called with "?.(", short-circuits on a null callee
+	Paren lexer.Token; // closing parenthesis, used for error reporting
+}
+
+// a ?? b, b is only evaluated when a is null
+type CoalesceExpr struct {
+	LOperand Expr
+	Operator lexer.Token
+	ROperand Expr
+};
+
+// a, b as in `return a, b;`
+type TupleExpr struct {
+	Elements []Expr;
+};
+
+type IndexExpr struct {
+	Object Expr;
+	Index Expr;
+	Bracket lexer.Token; // closing bracket, used for error reporting
+	Optional bool; // indexed with "?.[", short-circuits on a null object
+};
+
+// obj.name, a field of the instance or one of its methods bound to it
+type GetExpr struct {
+	Object Expr;
+	Name lexer.Token;
+	Optional bool; // read with "?.", short-circuits on a null object
+};
+
+// obj.name = value
+type SetExpr struct {
+	Object Expr;
+	Name lexer.Token;
+	Operator lexer.Token; // '=' or '??=', which only sets a property that is null or missing
+	Asset Expr;
+};
+
+// resolved like a variable declared in a scope around the methods of the class
+type ThisExpr struct {
+	Keyword lexer.Token;
+	Res *Resolution;
+};
+
+// wraps a call chain containing "?." so that a null link
+// short-circuits the whole chain to null
+type OptionalChainExpr struct {
+	Chain Expr;
+};
+
+// Accept dispatches expr to the method of visitor for its node
+func Accept[T any](expr Expr, visitor ExprVisitor[T]) (T, error) {
+	switch expr := expr.(type) {
+		case TernaryExpr: return visitor.VisitTernary(expr);
+		case BinaryExpr: return visitor.VisitBinary(expr);
+		case UnaryExpr: return visitor.VisitUnary(expr);
+		case LiteralExpr: return visitor.VisitLiteral(expr);
+		case VariableExpr: return visitor.VisitVariable(expr);
+		case GroupingExpr: return visitor.VisitGroup(expr);
+		case AssignExpr: return visitor.VisitAssign(expr);
+		case FuncCall: return visitor.VisitFuncCall(expr);
+		case CoalesceExpr: return visitor.VisitCoalesce(expr);
+		case OptionalChainExpr: return visitor.VisitOptionalChain(expr);
+		case TupleExpr: return visitor.VisitTuple(expr);
+		case IndexExpr: return visitor.VisitIndex(expr);
+		case GetExpr: return visitor.VisitGet(expr);
+		case SetExpr: return visitor.VisitSet(expr);
+		case ThisExpr: return visitor.VisitThis(expr);
+	}
+	panic(fmt.Sprintf("parser: unknown expression %T", expr));
+}
+
+func (TernaryExpr) expr() {}
+func (BinaryExpr) expr() {}
+func (UnaryExpr) expr() {}
+func (LiteralExpr) expr() {}
+func (VariableExpr) expr() {}
+func (GroupingExpr) expr() {}
+func (AssignExpr) expr() {}
+func (FuncCall) expr() {}
+func (CoalesceExpr) expr() {}
+func (OptionalChainExpr) expr() {}
+func (TupleExpr) expr() {}
+func (IndexExpr) expr() {}
+func (GetExpr) expr() {}
+func (SetExpr) expr() {}
+func (ThisExpr) expr() {}
+
+func span_of(expr Expr) lexer.Span {
+	if expr == nil {
+		return lexer.Span{};
+	}
+	return expr.Span();
+}
+
+func (ter TernaryExpr) Span() lexer.Span {
+	return lexer.Cover(span_of(ter.Cond), span_of(ter.Iffalse));
+}
+
+func (bin BinaryExpr) Span() lexer.Span {
+	return lexer.Cover(span_of(bin.LOperand), bin.Operator.Span(), span_of(bin.ROperand));
+}
+
+func (un UnaryExpr) Span() lexer.Span {
+	return lexer.Cover(un.Operator.Span(), span_of(un.Operand));
+}
+
+func (lit LiteralExpr) Span() lexer.Span {
+	return lit.Token.Span();
+}
+
+func (vari VariableExpr) Span() lexer.Span {
+	return vari.Name.Span();
+}
+
+func (grp GroupingExpr) Span() lexer.Span {
+	return lexer.Cover(grp.LeftParen.Span(), span_of(grp.InnerExpr), grp.RightParen.Span());
+}
+
+func (ass AssignExpr) Span() lexer.Span {
+	return lexer.Cover(ass.Name.Span(), span_of(ass.Asset));
 }
 
-func (ter TernaryExpr) Accept(vis ExprVisitor) (Value, error) {
-	return vis.VisitTernary(ter);
+// a pipeline puts its first argument before the callee
+func (call FuncCall) Span() lexer.Span {
+	spans := []lexer.Span{ span_of(call.Callee), call.Paren.Span() };
+	for _, arg := range call.Args {
+		spans = append(spans, span_of(arg));
+	}
+	return lexer.Cover(spans...);
 }
 
-func (bin BinaryExpr) Accept(vis ExprVisitor) (Value, error) {
-	return vis.VisitBinary(bin);
+func (co CoalesceExpr) Span() lexer.Span {
+	return lexer.Cover(span_of(co.LOperand), co.Operator.Span(), span_of(co.ROperand));
 }
 
-func (un UnaryExpr) Accept(vis ExprVisitor) (Value, error) {
-	return vis.VisitUnary(un);
+func (opt OptionalChainExpr) Span() lexer.Span {
+	return span_of(opt.Chain);
 }
 
-func (lit LiteralExpr) Accept(vis ExprVisitor) (Value, error) {
-	return vis.VisitLiteral(lit);
+func (tup TupleExpr) Span() lexer.Span {
+	spans := make([]lexer.Span, len(tup.Elements));
+	for i, element := range tup.Elements {
+		spans[i] = span_of(element);
+	}
+	return lexer.Cover(spans...);
 }
 
-func (vari VariableExpr) Accept(vis ExprVisitor) (Value, error) {
-	return vis.VisitVariable(vari);
+func (idx IndexExpr) Span() lexer.Span {
+	return lexer.Cover(span_of(idx.Object), span_of(idx.Index), idx.Bracket.Span());
 }
 
-func (grp GroupingExpr) Accept(vis ExprVisitor) (Value, error) {
-	return vis.VisitGroup(grp);
+func (get GetExpr) Span() lexer.Span {
+	return lexer.Cover(span_of(get.Object), get.Name.Span());
 }
 
-func (ass AssignExpr) Accept(vis ExprVisitor) (Value, error) {
-	return vis.VisitAssign(ass);
+func (set SetExpr) Span() lexer.Span {
+	return lexer.Cover(span_of(set.Object), set.Name.Span(), span_of(set.Asset));
 }
 
-func (call FuncCall) Accept(vis ExprVisitor) (Value, error) {
-	return vis.VisitFuncCall(call);
+func (this ThisExpr) Span() lexer.Span {
+	return this.Keyword.Span();
 }
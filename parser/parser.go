@@ -1,8 +1,9 @@
-// in case of entering panic mode (to resume parsing other tokens)
-
-// TODO: Add error productions to handle each binary operator appearing without a left-hand operand.
-// aka: detect a binary operator appearing at the beginning of an expression.
-// Report that as an error, but also parse and discard a right-hand operand with the appropriate precedence.
+// syntax errors do not stop the parser: it records them, enters panic mode and synchronizes
+// at the next statement boundary (see synchronize) so that every error is reported in one pass.
+// a binary operator without its left operand (`* 3`) is an error production, it is reported
+// and its right operand is parsed with the operator's precedence and kept in its place.
+// tokens come either from a slice or from a TokenStream read as the parser goes, a lexical
+// error ends the stream and whatever the parser reports after it is left out.
 package parser
 
 import (
@@ -12,10 +13,22 @@ import (
 
 type Value = any;
 
+// the result of visitors that only walk the tree for what they record on the way
+type None = struct{};
+
+// TokenStream yields tokens one at a time and an EOF token at the end, lexer.Scanner is one
+type TokenStream interface {
+	Next() (lexer.Token, error);
+}
+
 type Parser struct {
 	current int;
 	filename string;
-	tokens []lexer.Token;
+	tokens []lexer.Token; // with a stream only the tokens of the statement being parsed
+	stream TokenStream; // nil once exhausted
+	scan_failed bool;
+	errors []error;
+	depth int; // enclosing blocks, their '}' ends panic mode
 };
 
 func NewParser(filename string, tokens []lexer.Token) *Parser {
@@ -23,11 +36,50 @@ func NewParser(filename string, tokens []lexer.Token) *Parser {
 		filename: filename,
 		tokens: tokens,
 		current: 0,
+		errors: make([]error, 0),
 	};
 }
 
+func NewStreamParser(filename string, stream TokenStream) *Parser {
+	return &Parser {
+		filename: filename,
+		tokens: make([]lexer.Token, 0),
+		stream: stream,
+		current: 0,
+		errors: make([]error, 0),
+	};
+}
+
+// reads from the stream until the i-th token is available, reports whether there is one
+func (p *Parser) fill(i int) bool {
+	for i >= len(p.tokens) && p.stream != nil {
+		token, err := p.stream.Next();
+		if err != nil {
+			p.errors = append(p.errors, err);
+			p.scan_failed = true;
+			p.stream = nil;
+			break;
+		}
+		if token.Type == lexer.EOF {
+			p.stream = nil;
+			break;
+		}
+		p.tokens = append(p.tokens, token);
+	}
+	return i < len(p.tokens);
+}
+
+// forgets the tokens of the statements already parsed, but the last one which prev may still need
+func (p *Parser) drop() {
+	if p.stream == nil || p.current < 2 {
+		return;
+	}
+	p.tokens = append(p.tokens[:0], p.tokens[p.current-1:]...);
+	p.current = 1;
+}
+
 func (p *Parser) eof(offset uint) bool {
-	return p.current + int(offset) >= len(p.tokens);
+	return !p.fill(p.current + int(offset));
 }
 
 func (p *Parser) prev() lexer.Token {
@@ -63,16 +115,56 @@ func (p *Parser) expect_serie(tokens *[]lexer.Token, tts ...lexer.TokenType) boo
 	return true;
 }
 
+// panic mode: skips tokens until the start of the next statement,
+// which follows a ';' or starts with a keyword, or until the '}' of the enclosing block
+func (p *Parser) synchronize() {
+	for !p.eof(0) {
+		switch p.tokens[p.current].Type {
+			case lexer.VAR, lexer.FUNC, lexer.CLASS, lexer.TRAIT, lexer.IF, lexer.WHILE, lexer.FOR, lexer.RETURN, lexer.BREAK, lexer.CONTINUE, lexer.PRINT: {
+				return;
+			}
+			case lexer.RIGHT_BRACE: {
+				if p.depth > 0 {
+					return;
+				}
+			}
+		}
+		p.current++;
+		if p.prev().Type == lexer.SEMICOLON {
+			return;
+		}
+	}
+}
+
+// records err and resumes parsing at the next statement, start is where the failed statement began
+func (p *Parser) recover_from(err error, start int) {
+	// the statement only failed because the lexical error cut it short
+	if !p.scan_failed {
+		p.errors = append(p.errors, err);
+	}
+	if p.current == start && !p.eof(0) {
+		p.current++;
+	}
+	p.synchronize();
+}
+
 // block -> "{" declarativestmt "}"
 func (p *Parser) consume_block() ([]Stmt, error) {
+	p.depth++;
+	defer func() { p.depth--; }();
 	stmts := make([]Stmt, 0);
 	for !p.expect(lexer.RIGHT_BRACE) {
 		if p.eof(0) {
 			return nil, p.generate_expect_error("} at the end of the block");
 		}
+		if p.expect(lexer.SEMICOLON) {
+			continue;
+		}
+		start := p.current;
 		stmt, err := p.declarative_statement();
 		if err != nil {
-			return nil, err;
+			p.recover_from(err, start);
+			continue;
 		}
 		stmts = append(stmts, stmt);
 	}
@@ -81,6 +173,7 @@ func (p *Parser) consume_block() ([]Stmt, error) {
 
 // condstmt -> "if" expr stmt ("else" condstmt | stmt)?
 func (p *Parser) consume_if(branches *[]ConditionalBranch) error {
+	keyword := p.prev();
 	if !p.expect(lexer.LEFT_PAREN) {
 		return p.generate_expect_error("( in if condition");
 	}
@@ -96,10 +189,12 @@ func (p *Parser) consume_if(branches *[]ConditionalBranch) error {
 		return err;
 	}
 	*branches = append(*branches, ConditionalBranch{
+		Keyword: keyword,
 		Condition: cond,
 		NDStmt: ndstmt,
 	});
 	if p.expect(lexer.ELSE) {
+		keyword := p.prev();
 		if p.expect(lexer.IF) {
 			return p.consume_if(branches);
 		}
@@ -108,6 +203,7 @@ func (p *Parser) consume_if(branches *[]ConditionalBranch) error {
 			return err;
 		}
 		*branches = append(*branches, ConditionalBranch{
+			Keyword: keyword,
 			Condition: nil,
 			NDStmt: ndstmt,
 		});
@@ -115,50 +211,329 @@ func (p *Parser) consume_if(branches *[]ConditionalBranch) error {
 	return nil;
 }
 
-// func -> IDENTIFIER "(" params? ")" block
+// func -> IDENTIFIER signature block
 func (p *Parser) consume_func() (*Func, error) {
+	keyword := p.prev();
 	if !p.expect(lexer.IDENTIFIER) {
 		return nil, p.generate_expect_error("IDENTIFIER in function signature");
 	}
-	name := p.prev();
+	fn := &Func{
+		Doc: keyword.Doc,
+		Keyword: keyword,
+		Name: p.prev(),
+	};
+	if err := p.consume_signature(fn); err != nil {
+		return nil, err;
+	}
+	if !p.expect(lexer.LEFT_BRACE) {
+		return nil, p.generate_expect_error("'{' to start function body")
+	}
+	if err := p.consume_func_body(fn); err != nil {
+		return nil, err;
+	}
+	return fn, nil;
+}
+
+// signature -> "(" params? ")" (":" type)?
+func (p *Parser) consume_signature(fn *Func) error {
 	if !p.expect(lexer.LEFT_PAREN) {
-		return nil, p.generate_expect_error("'(' in function signature");
+		return p.generate_expect_error("'(' in function signature");
 	}
-	params := make([]lexer.Token, 0);
+	fn.Params = make([]lexer.Token, 0);
+	fn.ParamTypes = make([]TypeExpr, 0);
 	if !p.expect(lexer.RIGHT_PAREN) {
-		if err := p.consume_func_params(&params); err != nil {
-			return nil, err;
+		if err := p.consume_func_params(&fn.Params, &fn.ParamTypes); err != nil {
+			return err;
 		}
 		if !p.expect(lexer.RIGHT_PAREN) {
-			return nil, p.generate_expect_error("')' in function signature");
+			return p.generate_expect_error("')' in function signature");
 		}
 	}
-	if !p.expect(lexer.LEFT_BRACE) {
-		return nil, p.generate_expect_error("'{' to start function body")
+	return_type, err := p.consume_annotation();
+	if err != nil {
+		return err;
 	}
+	fn.ReturnType = return_type;
+	return nil;
+}
+
+// the block of fn, its '{' already consumed
+func (p *Parser) consume_func_body(fn *Func) error {
+	fn.LeftBrace = p.prev();
 	body, err := p.consume_block();
+	if err != nil {
+		return err;
+	}
+	fn.Body = body;
+	fn.RightBrace = p.prev();
+	return nil;
+}
+
+// classdecl -> IDENTIFIER ("implements" IDENTIFIER ("," IDENTIFIER)*)? "{" method* "}"
+// "implements" is only a keyword here, it remains the name of the native predicate
+func (p *Parser) consume_class() (Stmt, error) {
+	keyword := p.prev();
+	if !p.expect(lexer.IDENTIFIER) {
+		return nil, p.generate_expect_error("IDENTIFIER in class declaration");
+	}
+	class := ClassStmt{
+		Doc: keyword.Doc,
+		Keyword: keyword,
+		Name: p.prev(),
+		Traits: make([]VariableExpr, 0),
+	};
+	if !p.eof(0) && p.tokens[p.current].Type == lexer.IDENTIFIER && p.tokens[p.current].Lexeme == "implements" {
+		p.current++;
+		for {
+			if !p.expect(lexer.IDENTIFIER) {
+				return nil, p.generate_expect_error("trait name after 'implements'");
+			}
+			class.Traits = append(class.Traits, VariableExpr{
+				Name: p.prev(),
+				Res: &Resolution{},
+			});
+			if !p.expect(lexer.COMMA) {
+				break;
+			}
+		}
+	}
+	if !p.expect(lexer.LEFT_BRACE) {
+		return nil, p.generate_expect_error("'{' to start class body");
+	}
+	class.LeftBrace = p.prev();
+	methods, _, err := p.consume_methods(false);
 	if err != nil {
 		return nil, err;
 	}
-	return &Func{
+	class.Methods = methods;
+	class.RightBrace = p.prev();
+	return class, nil;
+}
+
+// traitdecl -> IDENTIFIER "{" (IDENTIFIER signature ";" | method)* "}"
+func (p *Parser) consume_trait() (Stmt, error) {
+	keyword := p.prev();
+	if !p.expect(lexer.IDENTIFIER) {
+		return nil, p.generate_expect_error("IDENTIFIER in trait declaration");
+	}
+	name := p.prev();
+	if !p.expect(lexer.LEFT_BRACE) {
+		return nil, p.generate_expect_error("'{' to start trait body");
+	}
+	left_brace := p.prev();
+	defaults, required, err := p.consume_methods(true);
+	if err != nil {
+		return nil, err;
+	}
+	return TraitStmt{
+		Doc: keyword.Doc,
+		Keyword: keyword,
 		Name: name,
-		Params: params,
-		Body: body,
+		LeftBrace: left_brace,
+		Required: required,
+		Defaults: defaults,
+		RightBrace: p.prev(),
 	}, nil;
 }
 
-// params -> IDENTIFIER | (IDENTIFIER "," params)
-func (p *Parser) consume_func_params(params *[]lexer.Token) error {
+// method -> IDENTIFIER signature block
+// up to the '}' of the class or trait body, only traits have methods without a body
+func (p *Parser) consume_methods(trait bool) ([]Func, []MethodSig, error) {
+	methods := make([]Func, 0);
+	required := make([]MethodSig, 0);
+	for !p.expect(lexer.RIGHT_BRACE) {
+		if p.eof(0) {
+			return nil, nil, p.generate_expect_error("'}' at the end of the body");
+		}
+		// mostly inserted after the '}' of a method
+		if p.expect(lexer.SEMICOLON) {
+			continue;
+		}
+		if !p.expect(lexer.IDENTIFIER) {
+			return nil, nil, p.generate_expect_error("method name");
+		}
+		fn := Func{
+			Doc: p.prev().Doc,
+			Name: p.prev(),
+		};
+		if err := p.consume_signature(&fn); err != nil {
+			return nil, nil, err;
+		}
+		if trait && p.expect(lexer.SEMICOLON) {
+			required = append(required, MethodSig{
+				Doc: fn.Doc,
+				Name: fn.Name,
+				Params: fn.Params,
+				ParamTypes: fn.ParamTypes,
+				ReturnType: fn.ReturnType,
+				Semicolon: p.prev(),
+			});
+			continue;
+		}
+		if !p.expect(lexer.LEFT_BRACE) {
+			if trait {
+				return nil, nil, p.generate_expect_error("';' or '{' after method signature");
+			}
+			return nil, nil, p.generate_expect_error("'{' to start method body");
+		}
+		if err := p.consume_func_body(&fn); err != nil {
+			return nil, nil, err;
+		}
+		methods = append(methods, fn);
+	}
+	return methods, required, nil;
+}
+
+// params -> param | (param "," params)
+// param -> IDENTIFIER (":" type)?
+func (p *Parser) consume_func_params(params *[]lexer.Token, types *[]TypeExpr) error {
 	if !p.expect(lexer.IDENTIFIER) {
 		return p.generate_expect_error("IDENTIFIER as a parameter")
 	}
 	*params = append(*params, p.prev());
+	typ, err := p.consume_annotation();
+	if err != nil {
+		return err;
+	}
+	*types = append(*types, typ);
+	if p.expect(lexer.COMMA) {
+		return p.consume_func_params(params, types);
+	}
+	return nil;
+}
+
+// annotation -> (":" type)?
+func (p *Parser) consume_annotation() (TypeExpr, error) {
+	if !p.expect(lexer.COLON) {
+		return nil, nil;
+	}
+	return p.consume_type();
+}
+
+// type -> typeprimary ("|" typeprimary)*
+func (p *Parser) consume_type() (TypeExpr, error) {
+	typ, err := p.consume_type_primary();
+	if err != nil {
+		return nil, err;
+	}
+	if !p.expect(lexer.PIPE) {
+		return typ, nil;
+	}
+	options := []TypeExpr{ typ };
+	for {
+		typ, err := p.consume_type_primary();
+		if err != nil {
+			return nil, err;
+		}
+		options = append(options, typ);
+		if !p.expect(lexer.PIPE) {
+			break;
+		}
+	}
+	return UnionType{
+		Options: options,
+	}, nil;
+}
+
+// typeprimary -> IDENTIFIER | "null"
+//              | "func" "(" (type ("," type)*)? ")" (":" type)?
+//              | "(" type ("," type)* ")"
+func (p *Parser) consume_type_primary() (TypeExpr, error) {
+	if p.expect(lexer.IDENTIFIER, lexer.NULL) {
+		return NamedType{
+			Name: p.prev(),
+		}, nil;
+	}
+	if p.expect(lexer.FUNC) {
+		if !p.expect(lexer.LEFT_PAREN) {
+			return nil, p.generate_expect_error("'(' in function type");
+		}
+		params := make([]TypeExpr, 0);
+		if !p.expect(lexer.RIGHT_PAREN) {
+			if err := p.consume_type_list(&params); err != nil {
+				return nil, err;
+			}
+			if !p.expect(lexer.RIGHT_PAREN) {
+				return nil, p.generate_expect_error("')' in function type");
+			}
+		}
+		ret, err := p.consume_annotation();
+		if err != nil {
+			return nil, err;
+		}
+		return FuncType{
+			Params: params,
+			Return: ret,
+		}, nil;
+	}
+	if p.expect(lexer.LEFT_PAREN) {
+		elements := make([]TypeExpr, 0);
+		if err := p.consume_type_list(&elements); err != nil {
+			return nil, err;
+		}
+		if !p.expect(lexer.RIGHT_PAREN) {
+			return nil, p.generate_expect_error("')' in type");
+		}
+		if len(elements) == 1 {
+			return elements[0], nil;
+		}
+		return TupleType{
+			Elements: elements,
+		}, nil;
+	}
+	return nil, p.generate_expect_error("type name");
+}
+
+// types -> type | (type "," types)
+func (p *Parser) consume_type_list(types *[]TypeExpr) error {
+	typ, err := p.consume_type();
+	if err != nil {
+		return err;
+	}
+	*types = append(*types, typ);
 	if p.expect(lexer.COMMA) {
-		return p.consume_func_params(params);
+		return p.consume_type_list(types);
 	}
 	return nil;
 }
 
+// unpack -> IDENTIFIER (":" type)? ("," IDENTIFIER (":" type)?)* "=" expression ";"
+func (p *Parser) consume_var_unpack(keyword lexer.Token, first lexer.Token, first_type TypeExpr) (Stmt, error) {
+	names := []lexer.Token{ first };
+	types := []TypeExpr{ first_type };
+	for {
+		if !p.expect(lexer.IDENTIFIER) {
+			return nil, p.generate_expect_error("IDENTIFIER in variable declartion");
+		}
+		names = append(names, p.prev());
+		typ, err := p.consume_annotation();
+		if err != nil {
+			return nil, err;
+		}
+		types = append(types, typ);
+		if !p.expect(lexer.COMMA) {
+			break;
+		}
+	}
+	if !p.expect(lexer.EQUAL) {
+		return nil, p.generate_expect_error("'=' to unpack into multiple variables");
+	}
+	asset, err := p.expression();
+	if err != nil {
+		return nil, err;
+	}
+	if !p.expect(lexer.SEMICOLON) {
+		return nil, p.generate_expect_error("';' at the end of the statement.");
+	}
+	return VarUnpackStmt{
+		Keyword: keyword,
+		Names: names,
+		Types: types,
+		Asset: asset,
+		Semicolon: p.prev(),
+	}, nil;
+}
+
 // args -> expression | (expression "," args)
 func (p *Parser) consume_func_args(params *[]Expr) error {
 	val, err := p.expression();
@@ -174,8 +549,10 @@ func (p *Parser) consume_func_args(params *[]Expr) error {
 
 // recursive decent start
 func (p *Parser) declarative_statement() (Stmt, error) {
-	// var -> "var" IDENTIFIER ("=" expression)?
+	// var -> "var" IDENTIFIER (":" type)? ("=" expression)?
+	//        | "var" IDENTIFIER (":" type)? ("," IDENTIFIER (":" type)?)+ "=" expression
 	if p.expect(lexer.VAR) {
+		keyword := p.prev();
 		var (
 			asset Expr = nil;
 			err error
@@ -184,6 +561,13 @@ func (p *Parser) declarative_statement() (Stmt, error) {
 			return nil, p.generate_expect_error("IDENTIFIER in variable declartion");
 		}
 		id := p.prev();
+		typ, err := p.consume_annotation();
+		if err != nil {
+			return nil, err;
+		}
+		if p.expect(lexer.COMMA) {
+			return p.consume_var_unpack(keyword, id, typ);
+		}
 		if p.expect(lexer.EQUAL) {
 			asset, err = p.expression();
 			if err != nil {
@@ -194,8 +578,12 @@ func (p *Parser) declarative_statement() (Stmt, error) {
 			return nil, p.generate_expect_error("';' at the end of the statement.");
 		}
 		return VarDeclarationStmt{
+			Doc: keyword.Doc,
+			Keyword: keyword,
 			Name: id,
+			Type: typ,
 			Asset: asset,
+			Semicolon: p.prev(),
 		}, nil;
 	}
 	// funcdecl -> "func" func
@@ -206,6 +594,14 @@ func (p *Parser) declarative_statement() (Stmt, error) {
 		}
 		return (*FuncDeclarationStmt)(fn), nil;
 	}
+	// classdecl -> "class" classdecl
+	if p.expect(lexer.CLASS) {
+		return p.consume_class();
+	}
+	// traitdecl -> "trait" traitdecl
+	if p.expect(lexer.TRAIT) {
+		return p.consume_trait();
+	}
 	return p.statement();
 }
 
@@ -221,6 +617,7 @@ func (p *Parser) statement() (Stmt, error) {
 	}
 	// whileloop -> "while" expression statement
 	if p.expect(lexer.WHILE) {
+		keyword := p.prev();
 		if !p.expect(lexer.LEFT_PAREN) {
 			return nil, p.generate_expect_error("( in while loop condition");
 		}
@@ -236,12 +633,14 @@ func (p *Parser) statement() (Stmt, error) {
 			return nil, err;
 		}
 		return WhileStmt{
+			Keyword: keyword,
 			Cond: cond,
 			NDStmt: ndstmt,
 		}, nil;
 	}
 	// forloop -> "for" "(" declarative_statement? ";" expession? ";" expression? ")" statement
 	if p.expect(lexer.FOR) {
+		keyword := p.prev();
 		var (
 			init Stmt = nil;
 			cond Expr = nil;
@@ -280,6 +679,7 @@ func (p *Parser) statement() (Stmt, error) {
 			return nil, err;
 		}
 		return ForStmt {
+			Keyword: keyword,
 			Init: init,
 			Cond: cond,
 			Step: step,
@@ -287,44 +687,68 @@ func (p *Parser) statement() (Stmt, error) {
 		}, nil;
 	}
 	if p.expect(lexer.LEFT_BRACE) {
+		left_brace := p.prev();
 		stmts, err := p.consume_block();
 		if err != nil {
 			return nil, err;
 		}
 		return BlockStmt{
+			LeftBrace: left_brace,
 			Stmts: stmts,
+			RightBrace: p.prev(),
 		}, nil;
 	}
-	// return -> "return" expression? ";"
+	// return -> "return" (expression ("," expression)*)? ";"
 	if p.expect(lexer.RETURN) {
+		keyword := p.prev();
 		var ( expr Expr = nil; err error = nil; )
 		if !p.expect(lexer.SEMICOLON) {
 			expr, err = p.expression();
 			if err != nil {
 				return nil, err;
 			}
+			if p.expect(lexer.COMMA) {
+				elements := []Expr{ expr };
+				if err := p.consume_func_args(&elements); err != nil {
+					return nil, err;
+				}
+				expr = TupleExpr{
+					Elements: elements,
+				};
+			}
 			if !p.expect(lexer.SEMICOLON) {
 				return nil, p.generate_expect_error("';' at the end of the return statement");
 			}
 		}
 		return ReturnStmt{
+			Keyword: keyword,
 			Asset: expr,
+			Semicolon: p.prev(),
 		}, nil;
 	}
 	if p.expect(lexer.BREAK) {
+		keyword := p.prev();
 		if !p.expect(lexer.SEMICOLON) {
 			return nil, p.generate_expect_error("';' at the end of 'break'");
 		}
-		return BreakStmt{}, nil;
+		return BreakStmt{
+			Keyword: keyword,
+			Semicolon: p.prev(),
+		}, nil;
 	}
 	if p.expect(lexer.CONTINUE) {
+		keyword := p.prev();
 		if !p.expect(lexer.SEMICOLON) {
 			return nil, p.generate_expect_error("';' at the end of 'continue'");
 		}
-		return ContinueStmt{}, nil;
+		return ContinueStmt{
+			Keyword: keyword,
+			Semicolon: p.prev(),
+		}, nil;
 	}
 	// printstmt -> "print" expression ("," expression)* ";"
 	if p.expect(lexer.PRINT) {
+		keyword := p.prev();
 		expr, err := p.expression();
 		if err != nil {
 			return nil, err;
@@ -342,7 +766,9 @@ func (p *Parser) statement() (Stmt, error) {
 			return nil, p.generate_expect_error("';' at the end of the statement.");
 		}
 		return PrintStmt{
+			Keyword: keyword,
 			Assets: assets,
+			Semicolon: p.prev(),
 		}, nil;
 	}
 	// exprstmt -> expression ";"
@@ -355,6 +781,7 @@ func (p *Parser) statement() (Stmt, error) {
 	}
 	return ExprStmt{
 		InnerExpr: expr,
+		Semicolon: p.prev(),
 	}, nil;
 }
 
@@ -384,7 +811,7 @@ func (p *Parser) expression() (Expr, error) {
 // 	return expr, nil;
 // }
 
-// assign -> IDENTIFIER "=" assign
+// assign -> IDENTIFIER ("=" | "??=") assign | (call ".")? IDENTIFIER ("=" | "??=") assign
 func (p *Parser) assign() (Expr, error) {
 	tokens := []lexer.Token{};
 	if p.expect_serie(&tokens, lexer.IDENTIFIER, lexer.EQUAL) {
@@ -395,20 +822,63 @@ func (p *Parser) assign() (Expr, error) {
 		return AssignExpr{
 			Name: tokens[0],
 			Asset: src,
+			Res: &Resolution{},
 		}, nil;
 	}
-	return p.ternary();
+	// a ??= b is lowered to a ?? (a = b)
+	if p.expect_serie(&tokens, lexer.IDENTIFIER, lexer.QUESTION_QUESTION_EQUAL) {
+		src, err := p.assign();
+		if err != nil {
+			return nil, err;
+		}
+		return CoalesceExpr{
+			LOperand: VariableExpr{
+				Name: tokens[0],
+				Res: &Resolution{},
+			},
+			Operator: tokens[1],
+			ROperand: AssignExpr{
+				Name: tokens[0],
+				Asset: src,
+				Res: &Resolution{},
+			},
+		}, nil;
+	}
+	expr, err := p.ternary();
+	if err != nil {
+		return nil, err;
+	}
+	// a property is not lowered like a variable, its object would be evaluated twice
+	if !p.expect(lexer.EQUAL, lexer.QUESTION_QUESTION_EQUAL) {
+		return expr, nil;
+	}
+	operator := p.prev();
+	src, err := p.assign();
+	if err != nil {
+		return nil, err;
+	}
+	if get, ok := expr.(GetExpr); ok {
+		return SetExpr{
+			Object: get.Object,
+			Name: get.Name,
+			Operator: operator,
+			Asset: src,
+		}, nil;
+	}
+	// the statement is still well formed, no need for panic mode
+	p.errors = append(p.errors, p.generate_error(lexer.Cover(span_of(expr), operator.Span()), "invalid assignment target"));
+	return src, nil;
 }
 
-// ternay -> equality "?" equality ":" ternary*;
+// ternay -> pipeline "?" pipeline ":" ternary*;
 // example: (a > b) ? a : b > a ? b : 0;
 func (p *Parser) ternary() (Expr, error) {
-	expr, err := p.equality();
+	expr, err := p.pipeline();
 	if err != nil {
 		return nil, err;
 	}
 	if p.expect(lexer.QUESTION) {
-		iftrue, err := p.equality();
+		iftrue, err := p.pipeline();
 		if err != nil {
 			return nil, err;
 		}
@@ -428,6 +898,80 @@ func (p *Parser) ternary() (Expr, error) {
 	return expr, nil;
 }
 
+// pipeline -> coalesce ("|>" coalesce)*
+// example: read() |> parse |> format(_, "x");
+func (p *Parser) pipeline() (Expr, error) {
+	expr, err := p.coalesce();
+	if err != nil {
+		return nil, err;
+	}
+	for p.expect(lexer.PIPE_GREATER) {
+		operator := p.prev();
+		right, err := p.coalesce();
+		if err != nil {
+			return nil, err;
+		}
+		expr, err = p.pipe_into(expr, operator, right);
+		if err != nil {
+			return nil, err;
+		}
+	}
+	return expr, nil;
+}
+
+// lowers `value |> target` into a plain FuncCall:
+//   x |> f        => f(x)
+//   x |> f(a)     => f(x, a)
+//   x |> f(a, _)  => f(a, x)
+func (p *Parser) pipe_into(value Expr, operator lexer.Token, target Expr) (Expr, error) {
+	call, ok := target.(FuncCall);
+	if !ok {
+		return FuncCall{
+			Callee: target,
+			Args: []Expr{ value },
+			Paren: operator,
+		}, nil;
+	}
+	args := make([]Expr, 0, len(call.Args) + 1);
+	placeholders := 0;
+	for _, arg := range call.Args {
+		if vari, ok := arg.(VariableExpr); ok && vari.Name.Lexeme == "_" {
+			placeholders++;
+			if placeholders > 1 {
+				return nil, p.generate_error(vari.Name.Span(), "a pipeline call takes at most one '_' placeholder");
+			}
+			arg = value;
+		}
+		args = append(args, arg);
+	}
+	if placeholders == 0 {
+		args = append([]Expr{ value }, args...);
+	}
+	call.Args = args;
+	return call, nil;
+}
+
+// coalesce -> equality ("??" equality)*
+func (p *Parser) coalesce() (Expr, error) {
+	expr, err := p.equality();
+	if err != nil {
+		return nil, err;
+	}
+	for p.expect(lexer.QUESTION_QUESTION) {
+		operator := p.prev();
+		right, err := p.equality();
+		if err != nil {
+			return nil, err;
+		}
+		expr = CoalesceExpr {
+			LOperand: expr,
+			Operator: operator,
+			ROperand: right,
+		};
+	}
+	return expr, nil;
+}
+
 // equality -> comparison (("!=" | "==") comparison)*
 func (p *Parser) equality() (Expr, error) {
 	expr, err := p.comparison();
@@ -528,14 +1072,44 @@ func (p *Parser) unary() (Expr, error) {
 	return p.call();
 }
 
-// call -> IDENTIFIER ( "(" funcparams ")" )+
+// call -> primary ( "?."? ( "(" funcparams ")" | "[" expression "]" | IDENTIFIER ) | "." IDENTIFIER )*
 func (p *Parser) call() (Expr, error) {
 	expr, err := p.primary();
 	if err != nil {
 		return nil, err;
 	}
+	optional_chain := false;
 	for ;; {
-		if p.expect(lexer.LEFT_PAREN) {
+		optional := p.expect(lexer.QUESTION_DOT);
+		if optional && !p.expect(lexer.LEFT_PAREN, lexer.LEFT_BRACKET, lexer.IDENTIFIER) {
+			return nil, p.generate_expect_error("'(', '[' or a property name after '?.'");
+		}
+		if (optional && p.prev().Type == lexer.IDENTIFIER) || (!optional && p.expect(lexer.DOT)) {
+			if !optional && !p.expect(lexer.IDENTIFIER) {
+				return nil, p.generate_expect_error("property name after '.'");
+			}
+			expr = GetExpr{
+				Object: expr,
+				Name: p.prev(),
+				Optional: optional,
+			};
+			optional_chain = optional_chain || optional;
+		} else if (optional && p.prev().Type == lexer.LEFT_BRACKET) || (!optional && p.expect(lexer.LEFT_BRACKET)) {
+			index, err := p.expression();
+			if err != nil {
+				return nil, err;
+			}
+			if !p.expect(lexer.RIGHT_BRACKET) {
+				return nil, p.generate_expect_error("']' after index");
+			}
+			expr = IndexExpr{
+				Object: expr,
+				Index: index,
+				Bracket: p.prev(),
+				Optional: optional,
+			};
+			optional_chain = optional_chain || optional;
+		} else if optional || p.expect(lexer.LEFT_PAREN) {
 			args := make([]Expr, 0);
 			if !p.expect(lexer.RIGHT_PAREN) {
 				if err := p.consume_func_args(&args); err != nil {
@@ -548,65 +1122,132 @@ func (p *Parser) call() (Expr, error) {
 			expr = FuncCall{
 				Callee: expr,
 				Args: args,
+				Optional: optional,
+				Paren: p.prev(),
 			};
+			optional_chain = optional_chain || optional;
 		} else {
 			break;
 		}
 	}
+	if optional_chain {
+		return OptionalChainExpr{
+			Chain: expr,
+		}, nil;
+	}
 	return expr, nil;
 }
 
-// primary -> IDENTIFIER | STRING | NUMBER | "true" | "false" | "null" | "(" expression ")"
+// primary -> IDENTIFIER | STRING | NUMBER | "true" | "false" | "null" | "this" | "(" expression ")"
 func (p *Parser) primary() (Expr, error) {
 	if p.expect(lexer.TRUE) {
 		return LiteralExpr{
 			ValueLiteral: true,
+			Token: p.prev(),
 		}, nil
 	} else if p.expect(lexer.FALSE) {
 		return LiteralExpr{
 			ValueLiteral: false,
+			Token: p.prev(),
 		}, nil
 	} else if p.expect(lexer.NULL) {
 		return LiteralExpr{
 			ValueLiteral: nil,
+			Token: p.prev(),
 		}, nil
 	} else if p.expect(lexer.STRING, lexer.NUMBER) {
 		return LiteralExpr {
 			ValueLiteral: p.prev().Literal,
+			Token: p.prev(),
 		}, nil
 	} else if p.expect(lexer.IDENTIFIER) {
 		return VariableExpr{
 			Name: p.prev(),
+			Res: &Resolution{},
+		}, nil;
+	} else if p.expect(lexer.THIS) {
+		return ThisExpr{
+			Keyword: p.prev(),
+			Res: &Resolution{},
 		}, nil;
 	} else if p.expect(lexer.LEFT_PAREN) {
+		left_paren := p.prev();
 		expr, err := p.expression();
 		if err != nil {
 			return nil, err;
 		}
 		if p.expect(lexer.RIGHT_PAREN) {
 			return GroupingExpr{
+				LeftParen: left_paren,
 				InnerExpr: expr,
+				RightParen: p.prev(),
 			}, nil;
 		}
 		return nil, p.generate_expect_error(")");
 	}
+	// error production: a binary operator without its left operand
+	if p.expect(lexer.STAR, lexer.SLASH, lexer.PLUS, lexer.LESS, lexer.GREATER, lexer.LESS_EQUAL, lexer.GREATER_EQUAL,
+		lexer.EQUAL_EQUAL, lexer.BANG_EQUAL, lexer.QUESTION_QUESTION, lexer.PIPE_GREATER) {
+		operator := p.prev();
+		right, err := p.right_operand(operator.Type);
+		if err != nil {
+			return nil, err;
+		}
+		p.errors = append(p.errors, p.generate_error(operator.Span(), "binary operator '%s' is missing its left operand", operator.Lexeme));
+		return right, nil;
+	}
 	return nil, p.generate_expect_error("valid token");
 }
+
+// parses what would be the right operand of operator
+func (p *Parser) right_operand(operator lexer.TokenType) (Expr, error) {
+	switch operator {
+		case lexer.STAR, lexer.SLASH: return p.unary();
+		case lexer.PLUS: return p.factor();
+		case lexer.LESS, lexer.GREATER, lexer.LESS_EQUAL, lexer.GREATER_EQUAL: return p.term();
+		case lexer.EQUAL_EQUAL, lexer.BANG_EQUAL: return p.comparison();
+		case lexer.QUESTION_QUESTION: return p.equality();
+	}
+	return p.coalesce();
+}
 // recursive decent end
 
+func (p *Parser) generate_error(span lexer.Span, format string, args ...any) *lexer.Diagnostic {
+	return &lexer.Diagnostic{ Kind: "SYNTAX ERROR", Filename: p.filename, Span: span, Message: fmt.Sprintf(format, args...) };
+}
+
+// reports the token that did not match, or the last one when the input ended early
 func (p *Parser) generate_expect_error(expected string) error {
-	tok := p.tokens[p.current-1];
-	return fmt.Errorf("ERROR at %s:%d: got %s, expected %s", p.filename, tok.Line, tok.Lexeme, expected);
+	if p.eof(0) {
+		tok := p.tokens[len(p.tokens)-1];
+		err := p.generate_error(tok.Span(), "got end of input after '%s', expected %s", tok.Lexeme, expected);
+		err.Incomplete = true;
+		return err;
+	}
+	tok := p.tokens[p.current];
+	if tok.Inserted {
+		return p.generate_error(tok.Span(), "got the end of the line, expected %s", expected);
+	}
+	return p.generate_error(tok.Span(), "got '%s', expected %s", tok.Lexeme, expected);
 }
 
-func (p *Parser) Parse() ([]Stmt, error) {
+// returns every statement that parsed and every syntax error,
+// the statements are only meant to be run when there are no errors
+func (p *Parser) Parse() ([]Stmt, []error) {
 	stmts := make([]Stmt, 0);
 	for !p.eof(0) {
+		p.drop();
+		// empty statements, mostly the ';' inserted after a '}' at the end of a line
+		if p.expect(lexer.SEMICOLON) {
+			continue;
+		}
+		start := p.current;
 		stmt, err := p.declarative_statement();
 		if err != nil {
-			return nil, err;
+			p.recover_from(err, start);
+			continue;
 		}
 		stmts = append(stmts, stmt);
 	}
-	return stmts, nil;
+	return stmts, p.errors;
 }
@@ -0,0 +1,300 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"aml/lexer"
+)
+
+func parse(t *testing.T, source string) ([]Stmt, []error) {
+	t.Helper();
+	return NewStreamParser("test.aml", lexer.NewScanner("test.aml", source)).Parse();
+}
+
+// the trees of the statements of source, spans are not printed so that
+// sugar compares equal to the code it stands for
+func tree(t *testing.T, source string) string {
+	t.Helper();
+	stmts, errs := parse(t, source);
+	if len(errs) != 0 {
+		t.Fatalf("parsing %q: %v", source, errs[0]);
+	}
+	sb := strings.Builder{};
+	for _, stmt := range stmts {
+		str, _ := AcceptStmt(stmt, &PrettyPrinter{});
+		sb.WriteString(str);
+	}
+	return sb.String();
+}
+
+// "line:column message" of each diagnostic
+func diagnostics(errs []error) []string {
+	strs := make([]string, len(errs));
+	for i, err := range errs {
+		var diag *lexer.Diagnostic;
+		if errors.As(err, &diag) {
+			strs[i] = fmt.Sprintf("%d:%d %s", diag.Span.Start.Line, diag.Span.Start.Column, diag.Message);
+		} else {
+			strs[i] = err.Error();
+		}
+	}
+	return strs;
+}
+
+func TestPipeline(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+		want string; // the call it is lowered into
+	}{
+		{ "bare callee", "x |> f;", "f(x);" },
+		{ "first argument", "x |> f(a);", "f(x, a);" },
+		{ "placeholder", "x |> f(a, _);", "f(a, x);" },
+		{ "chained", "x |> f |> g(1);", "g(f(x), 1);" },
+		{ "below coalesce", "x ?? y |> f;", "f(x ?? y);" },
+		{ "grouped callee", "x |> (h);", "(h)(x);" },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got, want := tree(t, test.source), tree(t, test.want); got != want {
+				t.Errorf("got\n%s\nwant\n%s", got, want);
+			}
+		});
+	}
+}
+
+func TestPipelinePlaceholders(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+		want []string;
+	}{
+		{ "two", "x |> f(_, _);", []string{ "1:11 a pipeline call takes at most one '_' placeholder" } },
+		{ "three, reported at the second", "x |> f(_, a, _, _);", []string{ "1:14 a pipeline call takes at most one '_' placeholder" } },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, errs := parse(t, test.source);
+			if got := diagnostics(errs); strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("got %q, want %q", got, test.want);
+			}
+		});
+	}
+}
+
+func TestCoalescingAssignment(t *testing.T) {
+	// a variable is lowered, a property keeps the operator so that its object is evaluated once
+	if got := tree(t, "x ??= 3;"); !strings.Contains(got, "(Coalesce)") || !strings.Contains(got, "(Assign)") {
+		t.Errorf("got\n%s\nwant x ?? (x = 3)", got);
+	}
+	if got := tree(t, "c.x ??= 3;"); !strings.Contains(got, "(Set)") || !strings.Contains(got, "Operator: [??=]") {
+		t.Errorf("got\n%s\nwant a '??=' Set", got);
+	}
+	_, errs := parse(t, "1 ??= 3;");
+	if got := diagnostics(errs); len(got) != 1 || got[0] != "1:1 invalid assignment target" {
+		t.Errorf("got %q, want an invalid assignment target", got);
+	}
+}
+
+// the parser synchronizes at the next statement after an error and goes on
+func TestSyntaxErrors(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+		want []string;
+	}{
+		{
+			"one per statement", "var = 1;\nprint 2;\nvar y = ;\nprint (3;\n",
+			[]string{ "1:5 got '=', expected IDENTIFIER in variable declartion", "3:9 got ';', expected valid token", "4:9 got ';', expected )" },
+		},
+		{
+			"function header and loop condition", "func f( {\n}\nprint 1\nwhile x {}\n",
+			[]string{ "1:9 got '{', expected IDENTIFIER as a parameter", "4:7 got 'x', expected ( in while loop condition" },
+		},
+		{
+			"inside a block and a stray brace", "{ var a = ; }\nprint 2;\n}\nprint 3;",
+			[]string{ "1:11 got ';', expected valid token", "3:1 got '}', expected valid token" },
+		},
+		{ "valid statements around", "print 1;\nvar = 2;\nprint 3;", []string{ "2:5 got '=', expected IDENTIFIER in variable declartion" } },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, errs := parse(t, test.source);
+			if got := diagnostics(errs); strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("got %q, want %q", got, test.want);
+			}
+		});
+	}
+}
+
+// a binary operator without its left operand is reported, the right operand is parsed
+// with the operator's precedence and stands in for the whole operation
+func TestMissingLeftOperand(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+		error string;
+		want string; // the source the tree reads as
+	}{
+		{ "star", "* 3;", "1:1 binary operator '*' is missing its left operand", "3;" },
+		{ "tighter operator after", "* 2 * 4;", "1:1 binary operator '*' is missing its left operand", "2 * 4;" },
+		{ "looser operator after", "* 2 + 4;", "1:1 binary operator '*' is missing its left operand", "2 + 4;" },
+		{ "plus", "+ 2 * 3;", "1:1 binary operator '+' is missing its left operand", "2 * 3;" },
+		{ "equality", "== 1 == 2;", "1:1 binary operator '==' is missing its left operand", "1 == 2;" },
+		{ "inside an operation", "print 1 + * 2;", "1:11 binary operator '*' is missing its left operand", "print 1 + 2;" },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stmts, errs := parse(t, test.source);
+			if got := diagnostics(errs); len(got) != 1 || got[0] != test.error {
+				t.Errorf("got %q, want %q", got, test.error);
+			}
+			sb := strings.Builder{};
+			for _, stmt := range stmts {
+				str, _ := AcceptStmt(stmt, &PrettyPrinter{});
+				sb.WriteString(str);
+			}
+			if got, want := sb.String(), tree(t, test.want); got != want {
+				t.Errorf("got\n%s\nwant\n%s", got, want);
+			}
+		});
+	}
+}
+
+// the `///` comment above a declaration is kept on its node
+func TestDocAttachment(t *testing.T) {
+	const source = `
+/// the answer
+var answer = 42;
+/// adds
+/// two numbers
+func add(a, b) { return a + b; }
+/// printable things
+trait Printable {
+	/// describes this
+	to_string();
+	/// prints the description
+	show() { print this.to_string(); }
+}
+/// a document
+class Doc implements Printable {
+	/// its title
+	to_string() { return "doc"; }
+}
+// not a doc
+var plain = 1;
+`;
+	stmts, errs := parse(t, source);
+	if len(errs) != 0 {
+		t.Fatal(errs[0]);
+	}
+	var docs []string;
+	for _, stmt := range stmts {
+		switch decl := stmt.(type) {
+			case VarDeclarationStmt: docs = append(docs, decl.Doc);
+			case *FuncDeclarationStmt: docs = append(docs, decl.Doc);
+			case TraitStmt: {
+				docs = append(docs, decl.Doc);
+				for _, sig := range decl.Required {
+					docs = append(docs, sig.Doc);
+				}
+				for _, method := range decl.Defaults {
+					docs = append(docs, method.Doc);
+				}
+			}
+			case ClassStmt: {
+				docs = append(docs, decl.Doc);
+				for _, method := range decl.Methods {
+					docs = append(docs, method.Doc);
+				}
+			}
+			default: t.Fatalf("unexpected statement %T", stmt);
+		}
+	}
+	want := []string{ "the answer", "adds\ntwo numbers", "printable things", "describes this", "prints the description", "a document", "its title", "" };
+	if strings.Join(docs, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want %q", docs, want);
+	}
+}
+
+// the source a span covers
+func covered(source string, span lexer.Span) string {
+	return source[span.Start.Offset:span.End.Offset];
+}
+
+// a composite node spans from its first token to its last, whatever their kind
+func TestExprSpans(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+		want string;
+	}{
+		{ "binary", "a + b * c;", "a + b * c" },
+		{ "grouping", "(a + b) * c;", "(a + b) * c" },
+		{ "ternary", "a ? b : c;", "a ? b : c" },
+		{ "unary", "-(a);", "-(a)" },
+		{ "call", "f(a, g(b));", "f(a, g(b))" },
+		{ "call without arguments", "f();", "f()" },
+		{ "pipeline", "x |> f(a);", "x |> f(a)" },
+		{ "optional chain", "a?.b.c;", "a?.b.c" },
+		{ "optional call", "a?.(1);", "a?.(1)" },
+		{ "index", "t[1 + 2];", "t[1 + 2]" },
+		{ "property", "a.b.c;", "a.b.c" },
+		{ "set", "a.b = 1 + 2;", "a.b = 1 + 2" },
+		{ "assign", "x = y + 1;", "x = y + 1" },
+		{ "coalesce", "a ?? b;", "a ?? b" },
+		{ "coalescing assignment", "x ??= 3;", "x ??= 3" },
+		{ "over lines", "f(a,\n  b);", "f(a,\n  b)" },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stmts, errs := parse(t, test.source);
+			if len(errs) != 0 {
+				t.Fatal(errs[0]);
+			}
+			stmt, ok := stmts[0].(ExprStmt);
+			if !ok {
+				t.Fatalf("got %T, want an expression statement", stmts[0]);
+			}
+			if got := covered(test.source, stmt.InnerExpr.Span()); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want);
+			}
+		});
+	}
+}
+
+func TestStmtSpans(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+		want string;
+	}{
+		{ "expression", "a + b;", "a + b;" },
+		// an inserted ';' takes no room
+		{ "expression ended by the line break", "a + b\nc;", "a + b" },
+		{ "variable", "var x = 1 + 2;", "var x = 1 + 2;" },
+		{ "unpacking", "var a, b = f();", "var a, b = f();" },
+		{ "function", "func f(a) { return a; } x;", "func f(a) { return a; }" },
+		{ "block", "{ a; b; } x;", "{ a; b; }" },
+		{ "if chain", "if (a) { b; } else if (c) d; else e; x;", "if (a) { b; } else if (c) d; else e;" },
+		{ "while", "while (a) { b; } x;", "while (a) { b; }" },
+		{ "for", "for (var i = 0; i < 2; i = i + 1) print i; x;", "for (var i = 0; i < 2; i = i + 1) print i;" },
+		{ "class", "class C { f() { return 1; } } x;", "class C { f() { return 1; } }" },
+		{ "trait", "trait T { f(); } x;", "trait T { f(); }" },
+		{ "print", "print a, b;", "print a, b;" },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stmts, errs := parse(t, test.source);
+			if len(errs) != 0 {
+				t.Fatal(errs[0]);
+			}
+			if got := covered(test.source, stmts[0].Span()); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want);
+			}
+		});
+	}
+}
@@ -3,12 +3,13 @@ package parser
 import (
 	"aml/lexer"
 	"fmt"
+	"strconv"
 	"strings"
 )
 
+// PrettyPrinter returns the tree of a node as indented text
 type PrettyPrinter struct {
 	tabs int;
-	builder strings.Builder;
 }
 
 func (p *PrettyPrinter) tab() {
@@ -19,233 +20,356 @@ func (p *PrettyPrinter) untab() {
 	p.tabs--;
 }
 
-func (p *PrettyPrinter) append_raw(strs ...string) {
-	p.builder.WriteString(strings.Join(strs, ""));
+func (p *PrettyPrinter) indent(strs ...string) string {
+	return strings.Repeat("  ", p.tabs) + strings.Join(strs, "");
 }
 
-func (p *PrettyPrinter) append(strs ...string) {
-	p.builder.WriteString(strings.Repeat("  ", p.tabs));
-	p.builder.WriteString(strings.Join(strs, ""));
+func (p *PrettyPrinter) line(strs ...string) string {
+	return p.indent(strs...) + "\n";
 }
 
-func (p *PrettyPrinter) appendln(strs ...string) {
-	strs = append(strs, "\n");
-	p.append(strs...);
+// the header of a node whose fields follow one tab deeper, until untab
+func (p *PrettyPrinter) open(header string) string {
+	str := p.line("(", header, ")");
+	p.tab();
+	return str;
 }
 
-func (p *PrettyPrinter) print_header(header string) {
-	p.appendln("(", header, ")");
+func (p *PrettyPrinter) def_value(name string, vals ...Value) string {
+	strs := make([]string, len(vals));
+	for i, val := range vals {
+		strs[i] = fmt.Sprint(val);
+	}
+	return p.line(name, ": [", strings.Join(strs, ", "), "]");
 }
 
-func (p *PrettyPrinter) print_def_value(name string, vals ...Value) {
-	p.append(name, ": [");
-	for i, val := range vals {
-		p.append_raw(fmt.Sprint(val));
-		if i + 1 != len(vals) {
-			p.append_raw(", ");
-		}
+// one value per line so that multi-line comments keep the tree readable
+func doc_lines(doc string) []Value {
+	lines := strings.Split(doc, "\n");
+	vals := make([]Value, len(lines));
+	for i, line := range lines {
+		vals[i] = line;
 	}
-	p.append_raw("]\n");
+	return vals;
 }
 
-func (p *PrettyPrinter) print_def_token(name string, toks ...lexer.Token) {
-	p.append(name, ": [");
+func (p *PrettyPrinter) def_token(name string, toks ...lexer.Token) string {
+	strs := make([]string, len(toks));
 	for i, tok := range toks {
-		p.append_raw(tok.Lexeme);
-		if i + 1 != len(toks) {
-			p.append_raw(", ");
+		strs[i] = tok.Lexeme;
+	}
+	return p.line(name, ": [", strings.Join(strs, ", "), "]");
+}
+
+func (p *PrettyPrinter) def_type(name string, types ...TypeExpr) string {
+	strs := make([]string, len(types));
+	for i, typ := range types {
+		if typ == nil {
+			strs[i] = "_";
+		} else {
+			strs[i] = typ.String();
 		}
 	}
-	p.append_raw("]\n");
+	return p.line(name, ": [", strings.Join(strs, ", "), "]");
 }
 
-func (p *PrettyPrinter) print_def_expr(name string, exprs ...Expr) {
-	p.append(name, ":");
+func (p *PrettyPrinter) def_expr(name string, exprs ...Expr) string {
+	sb := strings.Builder{};
+	sb.WriteString(p.indent(name, ":"));
 	p.tab();
 		for _, expr := range exprs {
-			p.append("\n");
-			expr.Accept(p);
+			sb.WriteString(p.indent("\n"));
+			if expr == nil {
+				sb.WriteString(p.line("(null)"));
+				continue;
+			}
+			str, _ := Accept(expr, p);
+			sb.WriteString(str);
 		}
 	p.untab();
+	return sb.String();
 }
 
-func (p *PrettyPrinter) print_def_stmt(name string, stmts ...Stmt) {
-	p.append(name, ":");
+func (p *PrettyPrinter) def_stmt(name string, stmts ...Stmt) string {
+	sb := strings.Builder{};
+	sb.WriteString(p.indent(name, ":"));
 	p.tab();
 		for _, stmt := range stmts {
-			p.append("\n");
-			stmt.Accept(p);
+			sb.WriteString(p.indent("\n"));
+			str, _ := AcceptStmt(stmt, p);
+			sb.WriteString(str);
 		}
 	p.untab();
+	return sb.String();
 }
 
-func (p *PrettyPrinter) VisitTernary(ter TernaryExpr) (Value, error) {
-	p.print_header("Ternary");
-	p.tab();
-		p.print_def_expr("Cond", ter.Cond);
-		p.print_def_expr("IfTrue", ter.Iftrue);
-		p.print_def_expr("IfFalse", ter.Iffalse);
-	p.untab();
-	return nil, nil;
+func (p *PrettyPrinter) VisitTernary(ter TernaryExpr) (string, error) {
+	header := p.open("Ternary");
+	defer p.untab();
+	return header +
+		p.def_expr("Cond", ter.Cond) +
+		p.def_expr("IfTrue", ter.Iftrue) +
+		p.def_expr("IfFalse", ter.Iffalse), nil;
 }
 
-func (p *PrettyPrinter) VisitBinary(bin BinaryExpr) (Value, error) {
-	p.print_header("Binary");
-	p.tab();
-		p.print_def_expr("LOperand", bin.LOperand);
-		p.print_def_token("Operator", bin.Operator);
-		p.print_def_expr("ROperand", bin.ROperand);
-	p.untab();
-	return nil, nil;
+func (p *PrettyPrinter) VisitBinary(bin BinaryExpr) (string, error) {
+	header := p.open("Binary");
+	defer p.untab();
+	return header +
+		p.def_expr("LOperand", bin.LOperand) +
+		p.def_token("Operator", bin.Operator) +
+		p.def_expr("ROperand", bin.ROperand), nil;
 }
 
-func (p *PrettyPrinter) VisitUnary(un UnaryExpr) (Value, error) {
-	p.print_header("Unary");
-	p.tab();
-		p.print_def_expr("Operand", un.Operand);
-		p.print_def_token("Operator", un.Operator);
-	p.untab();
-	return nil, nil;
+func (p *PrettyPrinter) VisitUnary(un UnaryExpr) (string, error) {
+	header := p.open("Unary");
+	defer p.untab();
+	return header +
+		p.def_expr("Operand", un.Operand) +
+		p.def_token("Operator", un.Operator), nil;
 }
 
-func (p *PrettyPrinter) VisitLiteral(lit LiteralExpr) (Value, error) {
-	p.print_header("Literal");
-	p.tab();
-		p.print_def_value("Value", lit.ValueLiteral);
-	p.untab();
-	return nil, nil;
+func (p *PrettyPrinter) VisitLiteral(lit LiteralExpr) (string, error) {
+	header := p.open("Literal");
+	defer p.untab();
+	if str, ok := lit.ValueLiteral.(string); ok {
+		return header + p.def_value("Value", strconv.Quote(str)), nil;
+	}
+	return header + p.def_value("Value", lit.ValueLiteral), nil;
 }
 
-func (p *PrettyPrinter) VisitVariable(vari VariableExpr) (Value, error) {
-	p.print_header("Variable");
-	p.tab();
-		p.print_def_token("Name", vari.Name);
-	p.untab();
-	return nil, nil;
+func (p *PrettyPrinter) VisitVariable(vari VariableExpr) (string, error) {
+	header := p.open("Variable");
+	defer p.untab();
+	return header + p.def_token("Name", vari.Name), nil;
 }
 
-func (p *PrettyPrinter) VisitGroup(grp GroupingExpr) (Value, error) {
-	p.print_header("Group");
-	p.tab();
-		p.print_def_expr("InnerExpr", grp.InnerExpr);
-	p.untab();
-	return nil, nil;
+func (p *PrettyPrinter) VisitGroup(grp GroupingExpr) (string, error) {
+	header := p.open("Group");
+	defer p.untab();
+	return header + p.def_expr("InnerExpr", grp.InnerExpr), nil;
 }
 
-func (p *PrettyPrinter) VisitAssign(ass AssignExpr) (Value, error) {
-	p.print_header("Assign");
-	p.tab();
-		p.print_def_token("Name", ass.Name);
-		p.print_def_expr("Name", ass.Asset);
-	p.untab();
-	return nil, nil;
+func (p *PrettyPrinter) VisitAssign(ass AssignExpr) (string, error) {
+	header := p.open("Assign");
+	defer p.untab();
+	return header +
+		p.def_token("Name", ass.Name) +
+		p.def_expr("Name", ass.Asset), nil;
 }
 
-func (p *PrettyPrinter) VisitFuncCall(fnc FuncCall) (Value, error) {
-	p.print_header("FunctionCall");
-	p.tab();
-		p.print_def_expr("Calle", fnc.Callee);
-		p.print_def_expr("Args", fnc.Args...);
-	p.untab();
-	return nil, nil;
+func (p *PrettyPrinter) VisitFuncCall(fnc FuncCall) (string, error) {
+	header := p.open("FunctionCall");
+	defer p.untab();
+	return header +
+		p.def_expr("Calle", fnc.Callee) +
+		p.def_value("Optional", fnc.Optional) +
+		p.def_expr("Args", fnc.Args...), nil;
 }
 
-func (p *PrettyPrinter) VisitExpr(stmt ExprStmt) (Value, error) {
-	stmt.InnerExpr.Accept(p);
-	return nil, nil;
+func (p *PrettyPrinter) VisitCoalesce(co CoalesceExpr) (string, error) {
+	header := p.open("Coalesce");
+	defer p.untab();
+	return header +
+		p.def_expr("LOperand", co.LOperand) +
+		p.def_token("Operator", co.Operator) +
+		p.def_expr("ROperand", co.ROperand), nil;
 }
 
-func (p *PrettyPrinter) VisitVariableDeclaration(vard VarDeclarationStmt) (Value, error) {
-	p.print_header("VariableDeclaration");
-	p.tab();
-		p.print_def_token("Name", vard.Name);
-		p.print_def_expr("Asset", vard.Asset);
-	p.untab();
-	return nil, nil;
+func (p *PrettyPrinter) VisitOptionalChain(opt OptionalChainExpr) (string, error) {
+	header := p.open("OptionalChain");
+	defer p.untab();
+	return header + p.def_expr("Chain", opt.Chain), nil;
 }
 
-func (p *PrettyPrinter) VisitFuncDeclarationStmt(fnd FuncDeclarationStmt) (Value, error) {
-	p.print_header("FunctionDeclaration");
-	p.tab();
-		p.print_def_token("Name", fnd.Name);
-		p.print_def_token("Params", fnd.Params...);
-		p.print_def_stmt("Body", fnd.Body...);
-	p.untab();
-	return nil, nil;
+func (p *PrettyPrinter) VisitTuple(tup TupleExpr) (string, error) {
+	header := p.open("Tuple");
+	defer p.untab();
+	return header + p.def_expr("Elements", tup.Elements...), nil;
 }
 
-func (p *PrettyPrinter) VisitReturn(ret ReturnStmt) (Value, error) {
-	p.print_header("ReturnStamement");
-	p.tab();
-		p.print_def_expr("Asset", ret.Asset);
-	p.untab();
-	return nil, nil;
+func (p *PrettyPrinter) VisitIndex(idx IndexExpr) (string, error) {
+	header := p.open("Index");
+	defer p.untab();
+	return header +
+		p.def_expr("Object", idx.Object) +
+		p.def_expr("Index", idx.Index) +
+		p.def_value("Optional", idx.Optional), nil;
 }
 
-func (p *PrettyPrinter) VisitPrint(prnt PrintStmt) (Value, error) {
-	p.print_header("PrintStatement");
-	p.tab();
-		p.print_def_expr("Asset", prnt.Assets...);
-	p.untab();
-	return nil, nil;
+func (p *PrettyPrinter) VisitGet(get GetExpr) (string, error) {
+	header := p.open("Get");
+	defer p.untab();
+	return header +
+		p.def_expr("Object", get.Object) +
+		p.def_token("Name", get.Name) +
+		p.def_value("Optional", get.Optional), nil;
 }
 
-func (p *PrettyPrinter) VisitBlock(blk BlockStmt) (Value, error) {
-	p.print_header("BlockStatement");
-	p.tab();
-		p.print_def_stmt("Body", blk.Stmts...);
-	p.untab();
-	return nil, nil;
+func (p *PrettyPrinter) VisitSet(set SetExpr) (string, error) {
+	header := p.open("Set");
+	defer p.untab();
+	return header +
+		p.def_expr("Object", set.Object) +
+		p.def_token("Name", set.Name) +
+		p.def_token("Operator", set.Operator) +
+		p.def_expr("Asset", set.Asset), nil;
 }
 
-func (p *PrettyPrinter) VisitBreak(BreakStmt) (Value, error) {
-	p.print_header("BreakStatement");
-	return nil, nil;
+func (p *PrettyPrinter) VisitThis(ThisExpr) (string, error) {
+	return p.line("(This)"), nil;
 }
 
-func (p *PrettyPrinter) VisitContinue(ContinueStmt) (Value, error) {
-	p.print_header("ContinueStatement");
-	return nil, nil;
+func (p *PrettyPrinter) VisitExpr(stmt ExprStmt) (string, error) {
+	return Accept(stmt.InnerExpr, p);
 }
 
-func (p *PrettyPrinter) VisitConditional(cond ConditionalStmt) (Value, error) {
-	p.print_header("ConditionalStatment");
-	p.tab();
-		for _, b := range cond.Branches {
-			p.print_def_expr("Cond", b.Condition);
-			p.print_def_stmt("Body", b.NDStmt);
-		}
-	p.untab();
-	return nil, nil;
+func (p *PrettyPrinter) VisitVariableDeclaration(vard VarDeclarationStmt) (string, error) {
+	str := p.open("VariableDeclaration");
+	defer p.untab();
+	if vard.Doc != "" {
+		str += p.def_value("Doc", doc_lines(vard.Doc)...);
+	}
+	str += p.def_token("Name", vard.Name);
+	if vard.Type != nil {
+		str += p.def_type("Type", vard.Type);
+	}
+	return str + p.def_expr("Asset", vard.Asset), nil;
+}
+
+func (p *PrettyPrinter) VisitVarUnpack(unp VarUnpackStmt) (string, error) {
+	header := p.open("VariableUnpack");
+	defer p.untab();
+	return header +
+		p.def_token("Names", unp.Names...) +
+		p.def_expr("Asset", unp.Asset), nil;
+}
+
+func (p *PrettyPrinter) VisitFuncDeclarationStmt(fnd FuncDeclarationStmt) (string, error) {
+	str := p.open("FunctionDeclaration");
+	defer p.untab();
+	if fnd.Doc != "" {
+		str += p.def_value("Doc", doc_lines(fnd.Doc)...);
+	}
+	str += p.def_token("Name", fnd.Name);
+	str += p.def_token("Params", fnd.Params...);
+	str += p.def_type("ParamTypes", fnd.ParamTypes...);
+	if fnd.ReturnType != nil {
+		str += p.def_type("ReturnType", fnd.ReturnType);
+	}
+	return str + p.def_stmt("Body", fnd.Body...), nil;
+}
+
+func (p *PrettyPrinter) VisitReturn(ret ReturnStmt) (string, error) {
+	header := p.open("ReturnStamement");
+	defer p.untab();
+	return header + p.def_expr("Asset", ret.Asset), nil;
 }
 
-func (p *PrettyPrinter) VisitWhile(whl WhileStmt) (Value, error) {
-	p.print_header("WhileStatement");
+func (p *PrettyPrinter) VisitPrint(prnt PrintStmt) (string, error) {
+	header := p.open("PrintStatement");
+	defer p.untab();
+	return header + p.def_expr("Asset", prnt.Assets...), nil;
+}
+
+func (p *PrettyPrinter) VisitBlock(blk BlockStmt) (string, error) {
+	header := p.open("BlockStatement");
+	defer p.untab();
+	return header + p.def_stmt("Body", blk.Stmts...), nil;
+}
+
+func (p *PrettyPrinter) VisitBreak(BreakStmt) (string, error) {
+	return p.line("(BreakStatement)"), nil;
+}
+
+func (p *PrettyPrinter) VisitContinue(ContinueStmt) (string, error) {
+	return p.line("(ContinueStatement)"), nil;
+}
+
+func (p *PrettyPrinter) VisitConditional(cond ConditionalStmt) (string, error) {
+	str := p.open("ConditionalStatment");
+	defer p.untab();
+	for _, b := range cond.Branches {
+		str += p.def_expr("Cond", b.Condition);
+		str += p.def_stmt("Body", b.NDStmt);
+	}
+	return str, nil;
+}
+
+func (p *PrettyPrinter) VisitWhile(whl WhileStmt) (string, error) {
+	header := p.open("WhileStatement");
+	defer p.untab();
+	return header +
+		p.def_expr("Cond", whl.Cond) +
+		p.def_stmt("Body", whl.NDStmt), nil;
+}
+
+func (p *PrettyPrinter) VisitFor(fors ForStmt) (string, error) {
+	str := p.open("ForStatement");
+	defer p.untab();
+	if fors.Init != nil {
+		str += p.def_stmt("Init", fors.Init);
+	}
+	if fors.Cond != nil {
+		str += p.def_expr("Cond", fors.Cond);
+	}
+	if fors.Step != nil {
+		str += p.def_expr("Step", fors.Step);
+	}
+	return str + p.def_stmt("Body", fors.NDStmt), nil;
+}
+
+// methods print as function declarations
+func (p *PrettyPrinter) def_methods(name string, methods []Func) string {
+	str := p.indent(name, ":\n");
 	p.tab();
-		p.print_def_expr("Cond", whl.Cond);
-		p.print_def_stmt("Body", whl.NDStmt);
+	for _, method := range methods {
+		fn, _ := p.VisitFuncDeclarationStmt(FuncDeclarationStmt(method));
+		str += fn;
+	}
 	p.untab();
-	return nil, nil;
+	return str;
+}
+
+func (p *PrettyPrinter) VisitClass(class ClassStmt) (string, error) {
+	str := p.open("ClassDeclaration");
+	defer p.untab();
+	if class.Doc != "" {
+		str += p.def_value("Doc", doc_lines(class.Doc)...);
+	}
+	str += p.def_token("Name", class.Name);
+	traits := make([]lexer.Token, len(class.Traits));
+	for i, trait := range class.Traits {
+		traits[i] = trait.Name;
+	}
+	str += p.def_token("Implements", traits...);
+	return str + p.def_methods("Methods", class.Methods), nil;
 }
 
-func (p *PrettyPrinter) VisitFor(fors ForStmt) (Value, error) {
-	p.print_header("ForStatement");
+func (p *PrettyPrinter) VisitTrait(trait TraitStmt) (string, error) {
+	str := p.open("TraitDeclaration");
+	defer p.untab();
+	if trait.Doc != "" {
+		str += p.def_value("Doc", doc_lines(trait.Doc)...);
+	}
+	str += p.def_token("Name", trait.Name);
+	str += p.indent("Required:\n");
 	p.tab();
-		if fors.Init != nil {
-			p.print_def_stmt("Init", fors.Init);
-		}
-		if fors.Cond != nil {
-			p.print_def_expr("Cond", fors.Cond);
+	for _, sig := range trait.Required {
+		str += p.open("MethodSignature");
+		str += p.def_token("Name", sig.Name);
+		str += p.def_token("Params", sig.Params...);
+		str += p.def_type("ParamTypes", sig.ParamTypes...);
+		if sig.ReturnType != nil {
+			str += p.def_type("ReturnType", sig.ReturnType);
 		}
-		if fors.Step != nil {
-			p.print_def_expr("Step", fors.Step);
-		}
-		p.print_def_stmt("Body", fors.NDStmt);
+		p.untab();
+	}
 	p.untab();
-	return nil, nil;
+	return str + p.def_methods("Defaults", trait.Defaults), nil;
 }
 
 func (p *PrettyPrinter) Print(stmt Stmt) {
-	stmt.Accept(p);
-	fmt.Print(p.builder.String());
+	str, _ := AcceptStmt(stmt, p);
+	fmt.Print(str);
 }
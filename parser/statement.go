@@ -1,60 +1,132 @@
 package parser
 
-import "aml/lexer"
-
-// TODO: add generic return value ASAP
-type StmtVisitor interface {
-	VisitExpr(ExprStmt) (Value, error);
-	VisitVariableDeclaration(VarDeclarationStmt) (Value, error);
-	VisitFuncDeclarationStmt(FuncDeclarationStmt) (Value, error);
-	VisitReturn(ReturnStmt) (Value, error);
-	VisitPrint(PrintStmt) (Value, error);
-	VisitBlock(BlockStmt) (Value, error);
-	VisitBreak(BreakStmt) (Value, error);
-	VisitContinue(ContinueStmt) (Value, error);
-	VisitConditional(ConditionalStmt) (Value, error);
-	VisitWhile(WhileStmt) (Value, error);
-	VisitFor(ForStmt) (Value, error);
+import (
+	"fmt"
+
+	"aml/lexer"
+)
+
+// StmtVisitor is the ExprVisitor of statements
+type StmtVisitor[T any] interface {
+	VisitExpr(ExprStmt) (T, error);
+	VisitVariableDeclaration(VarDeclarationStmt) (T, error);
+	VisitVarUnpack(VarUnpackStmt) (T, error);
+	VisitFuncDeclarationStmt(FuncDeclarationStmt) (T, error);
+	VisitReturn(ReturnStmt) (T, error);
+	VisitPrint(PrintStmt) (T, error);
+	VisitBlock(BlockStmt) (T, error);
+	VisitBreak(BreakStmt) (T, error);
+	VisitContinue(ContinueStmt) (T, error);
+	VisitConditional(ConditionalStmt) (T, error);
+	VisitWhile(WhileStmt) (T, error);
+	VisitFor(ForStmt) (T, error);
+	VisitClass(ClassStmt) (T, error);
+	VisitTrait(TraitStmt) (T, error);
 }
 
 type Stmt interface { 
-	Accept(StmtVisitor) (Value, error);
+	Span() lexer.Span; // the full source range of the statement, including its ';'
+	stmt(); // only the nodes of this file are statements
 }
 
 type ExprStmt struct {
 	InnerExpr Expr;
+	Semicolon lexer.Token;
 }
 
 type VarDeclarationStmt struct {
+	Doc string; // the `///` comment above the declaration
+	Keyword lexer.Token;
 	Name lexer.Token;
+	Type TypeExpr; // nil when not annotated
 	Asset Expr;
+	Semicolon lexer.Token;
+}
+
+// var a, b = tuple;
+type VarUnpackStmt struct {
+	Keyword lexer.Token;
+	Names []lexer.Token;
+	Types []TypeExpr; // one per name, nil when not annotated
+	Asset Expr;
+	Semicolon lexer.Token;
 }
 
 type Func struct {
+	Doc string; // the `///` comment above the declaration
+	Keyword lexer.Token;
 	Name lexer.Token;
 	Params []lexer.Token;
+	ParamTypes []TypeExpr; // one per param, nil when not annotated
+	ReturnType TypeExpr;
+	LeftBrace lexer.Token;
 	Body []Stmt;
+	RightBrace lexer.Token;
 }
 
 type FuncDeclarationStmt Func;
 
+// a method a trait requires from the classes implementing it, `to_string();`
+type MethodSig struct {
+	Doc string;
+	Name lexer.Token;
+	Params []lexer.Token;
+	ParamTypes []TypeExpr;
+	ReturnType TypeExpr;
+	Semicolon lexer.Token;
+}
+
+// class Doc implements Printable { ... }, calling the class makes an instance and runs its init method
+type ClassStmt struct {
+	Doc string;
+	Keyword lexer.Token;
+	Name lexer.Token;
+	Traits []VariableExpr; // the names after "implements"
+	LeftBrace lexer.Token;
+	Methods []Func; // without a keyword
+	RightBrace lexer.Token;
+}
+
+type TraitStmt struct {
+	Doc string;
+	Keyword lexer.Token;
+	Name lexer.Token;
+	LeftBrace lexer.Token;
+	Required []MethodSig;
+	Defaults []Func; // inherited by the classes that do not define them
+	RightBrace lexer.Token;
+}
+
 type ReturnStmt struct {
+	Keyword lexer.Token;
 	Asset Expr;
+	Semicolon lexer.Token;
 }
 
-type BreakStmt struct {}
+type BreakStmt struct {
+	Keyword lexer.Token;
+	Semicolon lexer.Token;
+}
 
-type ContinueStmt struct {}
+type ContinueStmt struct {
+	Keyword lexer.Token;
+	Semicolon lexer.Token;
+}
 
 type PrintStmt struct {
+	Keyword lexer.Token;
 	Assets []Expr;
+	Semicolon lexer.Token;
 }
 
 type BlockStmt struct {
+	LeftBrace lexer.Token;
 	Stmts []Stmt;
+	RightBrace lexer.Token;
 }
 
 type ConditionalBranch struct {
+	Keyword lexer.Token; // "if" or "else"
 	Condition Expr;
 	NDStmt Stmt; // non-declarative statement
 }
@@ -64,57 +136,124 @@ type ConditionalStmt struct {
 }
 
 type WhileStmt struct {
+	Keyword lexer.Token;
 	Cond Expr;
 	NDStmt Stmt;
 }
 
 type ForStmt struct {
+	Keyword lexer.Token;
 	Init Stmt;
 	Cond Expr;
 	Step Expr;
 	NDStmt Stmt;
 }
 
-func (stmt ExprStmt) Accept(vis StmtVisitor) (Value, error) {
-	return vis.VisitExpr(stmt);
+// AcceptStmt is Accept for statements
+func AcceptStmt[T any](stmt Stmt, visitor StmtVisitor[T]) (T, error) {
+	switch stmt := stmt.(type) {
+		case ExprStmt: return visitor.VisitExpr(stmt);
+		case VarDeclarationStmt: return visitor.VisitVariableDeclaration(stmt);
+		case VarUnpackStmt: return visitor.VisitVarUnpack(stmt);
+		case FuncDeclarationStmt: return visitor.VisitFuncDeclarationStmt(stmt);
+		case *FuncDeclarationStmt: return visitor.VisitFuncDeclarationStmt(*stmt); // as the parser makes them
+		case ReturnStmt: return visitor.VisitReturn(stmt);
+		case BreakStmt: return visitor.VisitBreak(stmt);
+		case ContinueStmt: return visitor.VisitContinue(stmt);
+		case PrintStmt: return visitor.VisitPrint(stmt);
+		case BlockStmt: return visitor.VisitBlock(stmt);
+		case ConditionalStmt: return visitor.VisitConditional(stmt);
+		case WhileStmt: return visitor.VisitWhile(stmt);
+		case ForStmt: return visitor.VisitFor(stmt);
+		case ClassStmt: return visitor.VisitClass(stmt);
+		case TraitStmt: return visitor.VisitTrait(stmt);
+	}
+	panic(fmt.Sprintf("parser: unknown statement %T", stmt));
+}
+
+func (ExprStmt) stmt() {}
+func (VarDeclarationStmt) stmt() {}
+func (VarUnpackStmt) stmt() {}
+func (FuncDeclarationStmt) stmt() {}
+func (ReturnStmt) stmt() {}
+func (BreakStmt) stmt() {}
+func (ContinueStmt) stmt() {}
+func (PrintStmt) stmt() {}
+func (BlockStmt) stmt() {}
+func (ConditionalStmt) stmt() {}
+func (WhileStmt) stmt() {}
+func (ForStmt) stmt() {}
+func (ClassStmt) stmt() {}
+func (TraitStmt) stmt() {}
+
+func span_of_stmt(stmt Stmt) lexer.Span {
+	if stmt == nil {
+		return lexer.Span{};
+	}
+	return stmt.Span();
+}
+
+func (stmt ExprStmt) Span() lexer.Span {
+	return lexer.Cover(span_of(stmt.InnerExpr), stmt.Semicolon.Span());
+}
+
+func (stmt VarDeclarationStmt) Span() lexer.Span {
+	return lexer.Cover(stmt.Keyword.Span(), stmt.Name.Span(), span_of(stmt.Asset), stmt.Semicolon.Span());
+}
+
+func (stmt VarUnpackStmt) Span() lexer.Span {
+	return lexer.Cover(stmt.Keyword.Span(), span_of(stmt.Asset), stmt.Semicolon.Span());
+}
+
+func (stmt FuncDeclarationStmt) Span() lexer.Span {
+	return lexer.Cover(stmt.Keyword.Span(), stmt.Name.Span(), stmt.RightBrace.Span());
 }
 
-func (stmt VarDeclarationStmt) Accept(vis StmtVisitor) (Value, error) {
-	return vis.VisitVariableDeclaration(stmt);
+func (stmt ReturnStmt) Span() lexer.Span {
+	return lexer.Cover(stmt.Keyword.Span(), span_of(stmt.Asset), stmt.Semicolon.Span());
 }
 
-func (stmt FuncDeclarationStmt) Accept(vis StmtVisitor) (Value, error) {
-	return vis.VisitFuncDeclarationStmt(stmt);
+func (stmt BreakStmt) Span() lexer.Span {
+	return lexer.Cover(stmt.Keyword.Span(), stmt.Semicolon.Span());
 }
 
-func (stmt ReturnStmt) Accept(in StmtVisitor) (Value, error) {
-	return in.VisitReturn(stmt);
+func (stmt ContinueStmt) Span() lexer.Span {
+	return lexer.Cover(stmt.Keyword.Span(), stmt.Semicolon.Span());
 }
 
-func (stmt BreakStmt) Accept(in StmtVisitor) (Value, error) {
-	return in.VisitBreak(stmt);
+func (stmt PrintStmt) Span() lexer.Span {
+	return lexer.Cover(stmt.Keyword.Span(), stmt.Semicolon.Span());
 }
 
-func (stmt ContinueStmt) Accept(in StmtVisitor) (Value, error) {
-	return in.VisitContinue(stmt);
+// optimized blocks may have no braces
+func (stmt BlockStmt) Span() lexer.Span {
+	spans := []lexer.Span{ stmt.LeftBrace.Span(), stmt.RightBrace.Span() };
+	for _, inner := range stmt.Stmts {
+		spans = append(spans, span_of_stmt(inner));
+	}
+	return lexer.Cover(spans...);
 }
 
-func (stmt PrintStmt) Accept(in StmtVisitor) (Value, error) {
-	return in.VisitPrint(stmt);
+func (stmt ConditionalStmt) Span() lexer.Span {
+	spans := make([]lexer.Span, 0, 2 * len(stmt.Branches));
+	for _, branch := range stmt.Branches {
+		spans = append(spans, branch.Keyword.Span(), span_of_stmt(branch.NDStmt));
+	}
+	return lexer.Cover(spans...);
 }
 
-func (stmt BlockStmt) Accept(in StmtVisitor) (Value, error) {
-	return in.VisitBlock(stmt);
+func (stmt WhileStmt) Span() lexer.Span {
+	return lexer.Cover(stmt.Keyword.Span(), span_of_stmt(stmt.NDStmt));
 }
 
-func (stmt ConditionalStmt) Accept(in StmtVisitor) (Value, error) {
-	return in.VisitConditional(stmt);
+func (stmt ForStmt) Span() lexer.Span {
+	return lexer.Cover(stmt.Keyword.Span(), span_of_stmt(stmt.NDStmt));
 }
 
-func (stmt WhileStmt) Accept(in StmtVisitor) (Value, error) {
-	return in.VisitWhile(stmt);
+func (stmt ClassStmt) Span() lexer.Span {
+	return lexer.Cover(stmt.Keyword.Span(), stmt.Name.Span(), stmt.RightBrace.Span());
 }
 
-func (stmt ForStmt) Accept(in StmtVisitor) (Value, error) {
-	return in.VisitFor(stmt);
+func (stmt TraitStmt) Span() lexer.Span {
+	return lexer.Cover(stmt.Keyword.Span(), stmt.Name.Span(), stmt.RightBrace.Span());
 }
@@ -0,0 +1,62 @@
+package parser
+
+import (
+	"strings"
+
+	"aml/lexer"
+);
+
+// optional type annotations, the interpreter ignores them
+// and only the analyser's Checker reads them
+type TypeExpr interface {
+	String() string;
+};
+
+// number, string, bool, null or any
+type NamedType struct {
+	Name lexer.Token;
+};
+
+// number | null
+type UnionType struct {
+	Options []TypeExpr;
+};
+
+// func(number, number): number
+type FuncType struct {
+	Params []TypeExpr;
+	Return TypeExpr; // nil when not annotated
+};
+
+// (number, number)
+type TupleType struct {
+	Elements []TypeExpr;
+};
+
+func join_types(types []TypeExpr, sep string) string {
+	strs := make([]string, len(types));
+	for i, typ := range types {
+		strs[i] = typ.String();
+	}
+	return strings.Join(strs, sep);
+}
+
+func (typ NamedType) String() string {
+	return typ.Name.Lexeme;
+}
+
+func (typ UnionType) String() string {
+	return join_types(typ.Options, " | ");
+}
+
+func (typ FuncType) String() string {
+	str := "func(" + join_types(typ.Params, ", ") + ")";
+	if typ.Return != nil {
+		str += ": " + typ.Return.String();
+	}
+	return str;
+}
+
+func (typ TupleType) String() string {
+	return "(" + join_types(typ.Elements, ", ") + ")";
+}
@@ -0,0 +1,130 @@
+package parser
+
+import (
+	"errors"
+	"testing"
+)
+
+var errForbidden = errors.New("forbidden variable");
+
+// the depth of an expression tree, a leaf is 1. fails on a variable named `forbidden`
+type depth struct{};
+
+func (d depth) of(exprs ...Expr) (int, error) {
+	deepest := 0;
+	for _, expr := range exprs {
+		if expr == nil {
+			continue;
+		}
+		n, err := Accept[int](expr, d);
+		if err != nil {
+			return 0, err;
+		}
+		deepest = max(deepest, n);
+	}
+	return deepest + 1, nil;
+}
+
+func (d depth) VisitTernary(expr TernaryExpr) (int, error) { return d.of(expr.Cond, expr.Iftrue, expr.Iffalse); }
+func (d depth) VisitBinary(expr BinaryExpr) (int, error) { return d.of(expr.LOperand, expr.ROperand); }
+func (d depth) VisitUnary(expr UnaryExpr) (int, error) { return d.of(expr.Operand); }
+func (d depth) VisitLiteral(LiteralExpr) (int, error) { return 1, nil; }
+func (d depth) VisitGroup(expr GroupingExpr) (int, error) { return d.of(expr.InnerExpr); }
+func (d depth) VisitAssign(expr AssignExpr) (int, error) { return d.of(expr.Asset); }
+func (d depth) VisitFuncCall(expr FuncCall) (int, error) { return d.of(append([]Expr{ expr.Callee }, expr.Args...)...); }
+func (d depth) VisitCoalesce(expr CoalesceExpr) (int, error) { return d.of(expr.LOperand, expr.ROperand); }
+func (d depth) VisitOptionalChain(expr OptionalChainExpr) (int, error) { return d.of(expr.Chain); }
+func (d depth) VisitTuple(expr TupleExpr) (int, error) { return d.of(expr.Elements...); }
+func (d depth) VisitIndex(expr IndexExpr) (int, error) { return d.of(expr.Object, expr.Index); }
+func (d depth) VisitGet(expr GetExpr) (int, error) { return d.of(expr.Object); }
+func (d depth) VisitSet(expr SetExpr) (int, error) { return d.of(expr.Object, expr.Asset); }
+func (d depth) VisitThis(ThisExpr) (int, error) { return 1, nil; }
+
+func (d depth) VisitVariable(expr VariableExpr) (int, error) {
+	if expr.Name.Lexeme == "forbidden" {
+		return 0, errForbidden;
+	}
+	return 1, nil;
+}
+
+func TestExprVisitorResult(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+		want int;
+		err error;
+	}{
+		{ "leaf", "a;", 1, nil },
+		{ "binary", "a + b * c;", 3, nil },
+		{ "call", "f(g(h(1)));", 4, nil },
+		{ "ternary in a group", "(a ? -b : c);", 4, nil },
+		{ "property assignment", "a.b.c = 1;", 3, nil },
+		{ "error from a leaf", "f(1, (forbidden));", 0, errForbidden },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stmts, errs := parse(t, test.source);
+			if len(errs) != 0 {
+				t.Fatal(errs[0]);
+			}
+			got, err := Accept[int](stmts[0].(ExprStmt).InnerExpr, depth{});
+			if !errors.Is(err, test.err) || got != test.want {
+				t.Errorf("got %d, %v, want %d, %v", got, err, test.want, test.err);
+			}
+		});
+	}
+}
+
+// the statements of a tree, nested ones included
+type count struct{};
+
+func (c count) of(stmts ...Stmt) (int, error) {
+	total := 1;
+	for _, stmt := range stmts {
+		if stmt == nil {
+			continue;
+		}
+		n, _ := AcceptStmt[int](stmt, c);
+		total += n;
+	}
+	return total, nil;
+}
+
+func (c count) VisitExpr(ExprStmt) (int, error) { return 1, nil; }
+func (c count) VisitVariableDeclaration(VarDeclarationStmt) (int, error) { return 1, nil; }
+func (c count) VisitVarUnpack(VarUnpackStmt) (int, error) { return 1, nil; }
+func (c count) VisitFuncDeclarationStmt(stmt FuncDeclarationStmt) (int, error) { return c.of(stmt.Body...); }
+func (c count) VisitReturn(ReturnStmt) (int, error) { return 1, nil; }
+func (c count) VisitPrint(PrintStmt) (int, error) { return 1, nil; }
+func (c count) VisitBlock(stmt BlockStmt) (int, error) { return c.of(stmt.Stmts...); }
+func (c count) VisitBreak(BreakStmt) (int, error) { return 1, nil; }
+func (c count) VisitContinue(ContinueStmt) (int, error) { return 1, nil; }
+func (c count) VisitWhile(stmt WhileStmt) (int, error) { return c.of(stmt.NDStmt); }
+func (c count) VisitFor(stmt ForStmt) (int, error) { return c.of(stmt.Init, stmt.NDStmt); }
+func (c count) VisitClass(ClassStmt) (int, error) { return 1, nil; }
+func (c count) VisitTrait(TraitStmt) (int, error) { return 1, nil; }
+
+func (c count) VisitConditional(stmt ConditionalStmt) (int, error) {
+	stmts := make([]Stmt, len(stmt.Branches));
+	for i, branch := range stmt.Branches {
+		stmts[i] = branch.NDStmt;
+	}
+	return c.of(stmts...);
+}
+
+// functions come out of the parser as pointers, AcceptStmt takes both forms
+func TestStmtVisitorResult(t *testing.T) {
+	stmts, errs := parse(t, "func f(a) { if (a) { print 1; } else return 2; while (a) a = a - 1; }");
+	if len(errs) != 0 {
+		t.Fatal(errs[0]);
+	}
+	if _, ok := stmts[0].(*FuncDeclarationStmt); !ok {
+		t.Fatalf("got %T, want *FuncDeclarationStmt", stmts[0]);
+	}
+	// the function, the if, its block, print, return, while and the assignment
+	for _, stmt := range []Stmt{ stmts[0], *stmts[0].(*FuncDeclarationStmt) } {
+		if got, _ := AcceptStmt[int](stmt, count{}); got != 7 {
+			t.Errorf("%T: got %d statements, want 7", stmt, got);
+		}
+	}
+}
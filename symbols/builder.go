@@ -0,0 +1,329 @@
+package symbols
+
+import (
+	"sort"
+
+	"aml/lexer"
+	"aml/parser"
+	"aml/interpreter"
+)
+
+type None = parser.None;
+
+func native_names() []string {
+	names := make([]string, 0);
+	for name := range interpreter.GetStdFuncs() {
+		names = append(names, name);
+	}
+	sort.Strings(names);
+	return names;
+}
+
+type pending_ref struct {
+	name lexer.Token;
+	write bool;
+}
+
+// builder walks a file once, binding references the way the Resolver does:
+// locals to the innermost declaration seen so far, anything else to a global
+// which is only looked up when the whole file is known.
+type builder struct {
+	idx *Index;
+	filename string;
+	scope *Scope;
+	globals []pending_ref;
+	refs map[Pos]*Reference; // `a ??= b` reads and writes the same token
+}
+
+func (b *builder) begin_scope(kind ScopeKind, start lexer.Token, end lexer.Token) {
+	sc := &Scope{
+		Kind: kind,
+		Parent: b.scope,
+		Start: TokenPos(b.filename, start),
+		End: TokenPos(b.filename, end),
+	};
+	b.scope.Children = append(b.scope.Children, sc);
+	b.scope = sc;
+}
+
+func (b *builder) end_scope() {
+	b.scope = b.scope.Parent;
+}
+
+func (b *builder) declare(name lexer.Token, kind Kind, doc string) {
+	sym := &Symbol{
+		Name: name.Lexeme,
+		Kind: kind,
+		Pos: TokenPos(b.filename, name),
+		Doc: doc,
+		Scope: b.scope,
+		Refs: make([]*Reference, 0),
+	};
+	b.scope.Symbols = append(b.scope.Symbols, sym);
+	b.idx.symbols = append(b.idx.symbols, sym);
+}
+
+func (b *builder) reference(name lexer.Token, write bool) {
+	for sc := b.scope; sc.Kind != GlobalScope; sc = sc.Parent {
+		for i := len(sc.Symbols) - 1; i >= 0; i-- {
+			if sc.Symbols[i].Name == name.Lexeme {
+				b.bind(sc.Symbols[i], name, write);
+				return;
+			}
+		}
+	}
+	b.globals = append(b.globals, pending_ref{ name: name, write: write });
+}
+
+func (b *builder) bind(sym *Symbol, name lexer.Token, write bool) {
+	pos := TokenPos(b.filename, name);
+	if ref, ok := b.refs[pos]; ok {
+		ref.Write = ref.Write || write;
+		return;
+	}
+	ref := &Reference{ Pos: pos, Symbol: sym, Write: write };
+	b.refs[pos] = ref;
+	sym.Refs = append(sym.Refs, ref);
+	b.idx.refs = append(b.idx.refs, ref);
+}
+
+// a global may be declared more than once, a use binds to the latest declaration
+// before it or to the first one when it is used before any
+func (b *builder) resolve_global(ref pending_ref) {
+	global := b.idx.files[b.filename];
+	pos := TokenPos(b.filename, ref.name);
+	var found *Symbol = nil;
+	for _, sym := range global.Symbols {
+		if sym.Name != ref.name.Lexeme {
+			continue;
+		}
+		if found == nil || !pos.Before(sym.Pos) {
+			found = sym;
+		}
+	}
+	if found == nil {
+		for _, sym := range b.idx.natives.Symbols {
+			if sym.Name == ref.name.Lexeme {
+				found = sym;
+			}
+		}
+	}
+	if found != nil {
+		b.bind(found, ref.name, ref.write);
+	}
+}
+
+func (b *builder) build(stmts []parser.Stmt) {
+	b.stmts(stmts);
+	for _, ref := range b.globals {
+		b.resolve_global(ref);
+	}
+	// globals were bound last, natives are only bound there so their references are already in order
+	for _, sym := range b.idx.symbols {
+		sort.Slice(sym.Refs, func(i, j int) bool { return sym.Refs[i].Pos.Before(sym.Refs[j].Pos); });
+	}
+}
+
+func (b *builder) stmts(stmts []parser.Stmt) {
+	for _, stmt := range stmts {
+		parser.AcceptStmt(stmt, b);
+	}
+}
+
+func (b *builder) expr(expr parser.Expr) {
+	if expr != nil {
+		parser.Accept(expr, b);
+	}
+}
+
+// statements
+func (b *builder) VisitExpr(stmt parser.ExprStmt) (None, error) {
+	b.expr(stmt.InnerExpr);
+	return None{}, nil;
+}
+
+func (b *builder) VisitVariableDeclaration(stmt parser.VarDeclarationStmt) (None, error) {
+	b.expr(stmt.Asset);
+	b.declare(stmt.Name, Variable, stmt.Doc);
+	return None{}, nil;
+}
+
+func (b *builder) VisitVarUnpack(stmt parser.VarUnpackStmt) (None, error) {
+	b.expr(stmt.Asset);
+	for _, name := range stmt.Names {
+		b.declare(name, Variable, "");
+	}
+	return None{}, nil;
+}
+
+func (b *builder) VisitFuncDeclarationStmt(stmt parser.FuncDeclarationStmt) (None, error) {
+	b.declare(stmt.Name, Function, stmt.Doc);
+	b.func_body(parser.Func(stmt));
+	return None{}, nil;
+}
+
+func (b *builder) func_body(fn parser.Func) {
+	b.begin_scope(FunctionScope, fn.Name, fn.RightBrace);
+	defer b.end_scope();
+	for _, param := range fn.Params {
+		b.declare(param, Parameter, "");
+	}
+	b.stmts(fn.Body);
+}
+
+// methods are properties of the instances, only their parameters and bodies are indexed
+func (b *builder) VisitClass(stmt parser.ClassStmt) (None, error) {
+	b.declare(stmt.Name, Class, stmt.Doc);
+	for _, trait := range stmt.Traits {
+		b.reference(trait.Name, false);
+	}
+	for _, method := range stmt.Methods {
+		b.func_body(method);
+	}
+	return None{}, nil;
+}
+
+func (b *builder) VisitTrait(stmt parser.TraitStmt) (None, error) {
+	b.declare(stmt.Name, Trait, stmt.Doc);
+	for _, method := range stmt.Defaults {
+		b.func_body(method);
+	}
+	return None{}, nil;
+}
+
+func (b *builder) VisitReturn(stmt parser.ReturnStmt) (None, error) {
+	b.expr(stmt.Asset);
+	return None{}, nil;
+}
+
+func (b *builder) VisitBreak(parser.BreakStmt) (None, error) {
+	return None{}, nil;
+}
+
+func (b *builder) VisitContinue(parser.ContinueStmt) (None, error) {
+	return None{}, nil;
+}
+
+func (b *builder) VisitPrint(stmt parser.PrintStmt) (None, error) {
+	for _, asset := range stmt.Assets {
+		b.expr(asset);
+	}
+	return None{}, nil;
+}
+
+func (b *builder) VisitBlock(stmt parser.BlockStmt) (None, error) {
+	b.begin_scope(BlockScope, stmt.LeftBrace, stmt.RightBrace);
+	defer b.end_scope();
+	b.stmts(stmt.Stmts);
+	return None{}, nil;
+}
+
+func (b *builder) VisitConditional(stmt parser.ConditionalStmt) (None, error) {
+	for _, branch := range stmt.Branches {
+		b.expr(branch.Condition);
+		parser.AcceptStmt(branch.NDStmt, b);
+	}
+	return None{}, nil;
+}
+
+func (b *builder) VisitWhile(stmt parser.WhileStmt) (None, error) {
+	b.expr(stmt.Cond);
+	parser.AcceptStmt(stmt.NDStmt, b);
+	return None{}, nil;
+}
+
+func (b *builder) VisitFor(stmt parser.ForStmt) (None, error) {
+	if stmt.Init != nil {
+		parser.AcceptStmt(stmt.Init, b);
+	}
+	b.expr(stmt.Cond);
+	b.expr(stmt.Step);
+	parser.AcceptStmt(stmt.NDStmt, b);
+	return None{}, nil;
+}
+
+// expressions
+func (b *builder) VisitVariable(expr parser.VariableExpr) (None, error) {
+	b.reference(expr.Name, false);
+	return None{}, nil;
+}
+
+func (b *builder) VisitAssign(expr parser.AssignExpr) (None, error) {
+	b.expr(expr.Asset);
+	b.reference(expr.Name, true);
+	return None{}, nil;
+}
+
+func (b *builder) VisitFuncCall(expr parser.FuncCall) (None, error) {
+	b.expr(expr.Callee);
+	for _, arg := range expr.Args {
+		b.expr(arg);
+	}
+	return None{}, nil;
+}
+
+func (b *builder) VisitLiteral(parser.LiteralExpr) (None, error) {
+	return None{}, nil;
+}
+
+func (b *builder) VisitUnary(expr parser.UnaryExpr) (None, error) {
+	b.expr(expr.Operand);
+	return None{}, nil;
+}
+
+func (b *builder) VisitBinary(expr parser.BinaryExpr) (None, error) {
+	b.expr(expr.LOperand);
+	b.expr(expr.ROperand);
+	return None{}, nil;
+}
+
+func (b *builder) VisitTernary(expr parser.TernaryExpr) (None, error) {
+	b.expr(expr.Cond);
+	b.expr(expr.Iftrue);
+	b.expr(expr.Iffalse);
+	return None{}, nil;
+}
+
+func (b *builder) VisitGroup(expr parser.GroupingExpr) (None, error) {
+	b.expr(expr.InnerExpr);
+	return None{}, nil;
+}
+
+func (b *builder) VisitCoalesce(expr parser.CoalesceExpr) (None, error) {
+	b.expr(expr.LOperand);
+	b.expr(expr.ROperand);
+	return None{}, nil;
+}
+
+func (b *builder) VisitOptionalChain(expr parser.OptionalChainExpr) (None, error) {
+	b.expr(expr.Chain);
+	return None{}, nil;
+}
+
+func (b *builder) VisitTuple(expr parser.TupleExpr) (None, error) {
+	for _, element := range expr.Elements {
+		b.expr(element);
+	}
+	return None{}, nil;
+}
+
+func (b *builder) VisitIndex(expr parser.IndexExpr) (None, error) {
+	b.expr(expr.Object);
+	b.expr(expr.Index);
+	return None{}, nil;
+}
+
+func (b *builder) VisitGet(expr parser.GetExpr) (None, error) {
+	b.expr(expr.Object);
+	return None{}, nil;
+}
+
+func (b *builder) VisitSet(expr parser.SetExpr) (None, error) {
+	b.expr(expr.Object);
+	b.expr(expr.Asset);
+	return None{}, nil;
+}
+
+func (b *builder) VisitThis(parser.ThisExpr) (None, error) {
+	return None{}, nil;
+}
@@ -0,0 +1,129 @@
+package symbols
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"aml/lexer"
+)
+
+type Edit struct {
+	Pos Pos;
+	Old string;
+	New string;
+}
+
+func is_identifier(name string) bool {
+	tokens, err := lexer.NewScanner("", name).Scan();
+	// the end of the name ends a statement, which inserts a ';' after it
+	return err == nil && len(tokens) == 2 && tokens[0].Type == lexer.IDENTIFIER && tokens[0].Lexeme == name && tokens[1].Inserted;
+}
+
+func name_of(sym *Symbol, renamed *Symbol, new_name string) string {
+	if sym == renamed {
+		return new_name;
+	}
+	return sym.Name;
+}
+
+// lookup_at binds name at pos the same way the builder does, as if renamed was already called new_name
+func (idx *Index) lookup_at(pos Pos, name string, renamed *Symbol, new_name string) *Symbol {
+	for sc := idx.files[pos.File].innermost(pos); sc != nil; sc = sc.Parent {
+		var found *Symbol = nil;
+		for _, sym := range sc.Symbols {
+			if name_of(sym, renamed, new_name) != name {
+				continue;
+			}
+			switch sc.Kind {
+				case GlobalScope: {
+					if found == nil || !pos.Before(sym.Pos) {
+						found = sym;
+					}
+				}
+				case NativeScope: {
+					found = sym;
+				}
+				default: {
+					if !pos.Before(sym.Pos) {
+						found = sym;
+					}
+				}
+			}
+		}
+		if found != nil {
+			return found;
+		}
+	}
+	return nil;
+}
+
+// Rename returns the edits renaming the symbol at pos and all of its references.
+// it refuses when new_name would change what any reference is bound to:
+// when one of the symbol's references would be captured by another new_name,
+// or when the renamed symbol would capture a reference to another new_name.
+func (idx *Index) Rename(pos Pos, new_name string) ([]Edit, error) {
+	sym := idx.FindDefinition(pos);
+	if sym == nil {
+		return nil, fmt.Errorf("no variable, parameter, function, class or trait at %s", pos);
+	}
+	if sym.Kind == Native {
+		return nil, fmt.Errorf("cannot rename native function '%s'", sym.Name);
+	}
+	new_name = lexer.NormalizeIdentifier(new_name);
+	if !is_identifier(new_name) {
+		return nil, fmt.Errorf("'%s' is not a valid identifier", new_name);
+	}
+	if new_name == sym.Name {
+		return []Edit{}, nil;
+	}
+	for _, other := range sym.Scope.Symbols {
+		if other != sym && other.Name == new_name {
+			return nil, fmt.Errorf("cannot rename '%s' to '%s': %s is declared in the same scope", sym.Name, new_name, other);
+		}
+	}
+	for _, ref := range sym.Refs {
+		if bound := idx.lookup_at(ref.Pos, new_name, sym, new_name); bound != sym {
+			return nil, fmt.Errorf("cannot rename '%s' to '%s': the reference at %s would be captured by %s", sym.Name, new_name, ref.Pos, bound);
+		}
+	}
+	for _, ref := range idx.refs {
+		if ref.Pos.File != sym.Pos.File || ref.Symbol.Name != new_name {
+			continue;
+		}
+		if bound := idx.lookup_at(ref.Pos, new_name, sym, new_name); bound == sym {
+			return nil, fmt.Errorf("cannot rename '%s' to '%s': it would capture the reference at %s to %s", sym.Name, new_name, ref.Pos, ref.Symbol);
+		}
+	}
+
+	edits := []Edit{ { Pos: sym.Pos, Old: sym.Name, New: new_name } };
+	for _, ref := range sym.Refs {
+		edits = append(edits, Edit{ Pos: ref.Pos, Old: sym.Name, New: new_name });
+	}
+	return edits, nil;
+}
+
+// ApplyEdits replaces the text of every edit in source, everything else is kept as is.
+// names are compared in NFC as the source may spell them in another normal form
+func ApplyEdits(source string, edits []Edit) (string, error) {
+	lines := strings.SplitAfter(source, "\n");
+	sorted := append([]Edit{}, edits...);
+	// right to left so that earlier columns stay valid
+	sort.Slice(sorted, func(i, j int) bool { return sorted[j].Pos.Before(sorted[i].Pos); });
+	for _, edit := range sorted {
+		if edit.Pos.Line == 0 || int(edit.Pos.Line) > len(lines) {
+			return "", fmt.Errorf("edit out of range at %s", edit.Pos);
+		}
+		line := []rune(lines[edit.Pos.Line-1]);
+		start := int(edit.Pos.Column) - 1;
+		end := start;
+		for end >= 0 && end < len(line) && lexer.IsAlphaNum(line[end]) {
+			end++;
+		}
+		if start < 0 || lexer.NormalizeIdentifier(string(line[start:end])) != edit.Old {
+			return "", fmt.Errorf("expected '%s' at %s", edit.Old, edit.Pos);
+		}
+		lines[edit.Pos.Line-1] = string(line[:start]) + edit.New + string(line[end:]);
+	}
+	return strings.Join(lines, ""), nil;
+}
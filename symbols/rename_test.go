@@ -0,0 +1,112 @@
+package symbols
+
+import (
+	"strings"
+	"testing"
+
+	"aml/lexer"
+	"aml/parser"
+)
+
+// renames the symbol at line:column of source to new_name, returns the renamed source
+func rename(t *testing.T, source string, line uint, column uint, new_name string) (string, error) {
+	t.Helper();
+	stmts, errs := parser.NewStreamParser("test.aml", lexer.NewScanner("test.aml", source)).Parse();
+	if len(errs) != 0 {
+		t.Fatalf("parsing %q: %v", source, errs[0]);
+	}
+	idx := NewIndex();
+	idx.AddFile("test.aml", stmts);
+	edits, err := idx.Rename(Pos{ File: "test.aml", Line: line, Column: column }, new_name);
+	if err != nil {
+		return "", err;
+	}
+	return ApplyEdits(source, edits);
+}
+
+func TestRename(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+		line, column uint;
+		new_name string;
+		want string;
+	}{
+		{
+			"global", "var a = 1;\nprint a + a;\n", 1, 5, "count",
+			"var count = 1;\nprint count + count;\n",
+		},
+		{
+			"from a reference", "var a = 1;\nprint a;\n", 2, 7, "b",
+			"var b = 1;\nprint b;\n",
+		},
+		{
+			"shadowed name is left alone", "var a = 1;\n{\n\tvar a = 2;\n\tprint a;\n}\nprint a;\n", 1, 5, "outer",
+			"var outer = 1;\n{\n\tvar a = 2;\n\tprint a;\n}\nprint outer;\n",
+		},
+		{
+			"parameter", "func f(x) {\n\treturn x * 2;\n}\nvar x = 3;\n", 1, 8, "n",
+			"func f(n) {\n\treturn n * 2;\n}\nvar x = 3;\n",
+		},
+		{
+			"recursive function", "func fib(n) {\n\treturn n < 2 ? n : fib(n - 1) + fib(n - 2);\n}\nprint fib(10);\n", 1, 6, "fibonacci",
+			"func fibonacci(n) {\n\treturn n < 2 ? n : fibonacci(n - 1) + fibonacci(n - 2);\n}\nprint fibonacci(10);\n",
+		},
+		{
+			"trait", "trait P { f(); }\nclass C implements P { f() { return 1; } }\nprint implements(C(), P);\n", 1, 7, "Q",
+			"trait Q { f(); }\nclass C implements Q { f() { return 1; } }\nprint implements(C(), Q);\n",
+		},
+		{
+			"same name", "var a = 1;\n", 1, 5, "a",
+			"var a = 1;\n",
+		},
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := rename(t, test.source, test.line, test.column, test.new_name);
+			if err != nil {
+				t.Fatalf("unexpected error %v", err);
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want);
+			}
+		});
+	}
+}
+
+// renames that would change what a reference is bound to are refused
+func TestRenameRefused(t *testing.T) {
+	tests := []struct {
+		name string;
+		source string;
+		line, column uint;
+		new_name string;
+		want string; // the start of the error
+	}{
+		{ "same scope", "var a = 1;\nvar b = 2;\n", 1, 5, "b", "cannot rename 'a' to 'b': " },
+		{
+			"reference captured by an inner declaration", "var a = 1;\n{\n\tvar b = 2;\n\tprint a;\n}\n", 1, 5, "b",
+			"cannot rename 'a' to 'b': the reference at ",
+		},
+		{
+			"captures a reference to an outer declaration", "var b = 1;\n{\n\tvar a = 2;\n\tprint b;\n}\n", 3, 6, "b",
+			"cannot rename 'a' to 'b': it would capture the reference at ",
+		},
+		{ "parameter captures a global", "var g = 1;\nfunc f(x) {\n\treturn g + x;\n}\n", 2, 8, "g", "cannot rename 'x' to 'g': it would capture" },
+		{ "invalid name", "var a = 1;\n", 1, 5, "1a", "'1a' is not a valid identifier" },
+		{ "keyword", "var a = 1;\n", 1, 5, "while", "'while' is not a valid identifier" },
+		{ "native", "print time();\n", 1, 7, "clock", "cannot rename native function 'time'" },
+		{ "nothing there", "var a = 1;\n", 1, 1, "b", "no variable, parameter, function, class or trait at " },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := rename(t, test.source, test.line, test.column, test.new_name);
+			if err == nil {
+				t.Fatalf("renamed, want %q", test.want);
+			}
+			if !strings.HasPrefix(err.Error(), test.want) {
+				t.Errorf("got %q, want %q", err.Error(), test.want);
+			}
+		});
+	}
+}
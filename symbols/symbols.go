@@ -0,0 +1,247 @@
+package symbols
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"aml/lexer"
+	"aml/parser"
+)
+
+type Pos struct {
+	File string;
+	Line uint;
+	Column uint;
+}
+
+func TokenPos(filename string, tok lexer.Token) Pos {
+	return Pos{ File: filename, Line: tok.Line, Column: tok.Column };
+}
+
+func (pos Pos) Before(other Pos) bool {
+	if pos.Line != other.Line {
+		return pos.Line < other.Line;
+	}
+	return pos.Column < other.Column;
+}
+
+func (pos Pos) String() string {
+	return fmt.Sprintf("%s:%d:%d", pos.File, pos.Line, pos.Column);
+}
+
+// reports whether pos falls on the name starting at start
+func covers(start Pos, name string, pos Pos) bool {
+	return start.File == pos.File && start.Line == pos.Line &&
+		pos.Column >= start.Column && pos.Column < start.Column + uint(utf8.RuneCountInString(name));
+}
+
+type Kind int;
+
+const (
+	Variable Kind = iota
+	Parameter
+	Function
+	Class
+	Trait
+	Native
+);
+
+func (kind Kind) String() string {
+	switch kind {
+		case Variable: return "variable";
+		case Parameter: return "parameter";
+		case Function: return "function";
+		case Class: return "class";
+		case Trait: return "trait";
+		case Native: return "native";
+	}
+	return "unknown";
+}
+
+type Symbol struct {
+	Name string;
+	Kind Kind;
+	Pos Pos; // zero for natives
+	Doc string; // the `///` comment of variables, functions, classes and traits
+	Scope *Scope;
+	Refs []*Reference;
+}
+
+func (sym *Symbol) String() string {
+	if sym.Kind == Native {
+		return fmt.Sprintf("%s %s", sym.Kind, sym.Name);
+	}
+	return fmt.Sprintf("%s %s at %s", sym.Kind, sym.Name, sym.Pos);
+}
+
+type Reference struct {
+	Pos Pos;
+	Symbol *Symbol;
+	Write bool; // the reference is assigned to
+}
+
+type ScopeKind int;
+
+const (
+	NativeScope ScopeKind = iota
+	GlobalScope
+	FunctionScope
+	BlockScope
+);
+
+// scopes mirror the interpreter: blocks and function bodies open one,
+// "for" initializers are declared in the enclosing scope.
+type Scope struct {
+	Kind ScopeKind;
+	Parent *Scope;
+	Children []*Scope;
+	Start Pos; // the function name or the opening brace
+	End Pos; // the closing brace
+	Symbols []*Symbol; // in declaration order
+}
+
+func (sc *Scope) contains(pos Pos) bool {
+	switch sc.Kind {
+		case NativeScope: return true;
+		case GlobalScope: return sc.Start.File == pos.File;
+	}
+	return sc.Start.File == pos.File && !pos.Before(sc.Start) && !sc.End.Before(pos);
+}
+
+// innermost scope around pos
+func (sc *Scope) innermost(pos Pos) *Scope {
+	for _, child := range sc.Children {
+		if child.contains(pos) {
+			return child.innermost(pos);
+		}
+	}
+	return sc;
+}
+
+// Index is the cross-reference index of a set of files: every definition with its scope
+// and every reference bound to its definition. each file is its own program and gets
+// its own global scope, the natives from the standard library are shared.
+type Index struct {
+	natives *Scope;
+	files map[string]*Scope;
+	symbols []*Symbol;
+	refs []*Reference;
+}
+
+func NewIndex() *Index {
+	natives := &Scope{ Kind: NativeScope };
+	for _, name := range native_names() {
+		natives.Symbols = append(natives.Symbols, &Symbol{ Name: name, Kind: Native, Scope: natives });
+	}
+	return &Index{
+		natives: natives,
+		files: make(map[string]*Scope),
+		symbols: make([]*Symbol, 0),
+		refs: make([]*Reference, 0),
+	};
+}
+
+// AddFile indexes a parsed file, adding a file a second time replaces it
+func (idx *Index) AddFile(filename string, stmts []parser.Stmt) {
+	if _, ok := idx.files[filename]; ok {
+		idx.remove_file(filename);
+	}
+	global := &Scope{ Kind: GlobalScope, Parent: idx.natives, Start: Pos{ File: filename } };
+	idx.natives.Children = append(idx.natives.Children, global);
+	idx.files[filename] = global;
+	b := &builder{ idx: idx, filename: filename, scope: global, refs: make(map[Pos]*Reference) };
+	b.build(stmts);
+}
+
+func (idx *Index) remove_file(filename string) {
+	symbols := make([]*Symbol, 0, len(idx.symbols));
+	for _, sym := range idx.symbols {
+		if sym.Pos.File != filename {
+			symbols = append(symbols, sym);
+		}
+	}
+	idx.symbols = symbols;
+	refs := make([]*Reference, 0, len(idx.refs));
+	for _, ref := range idx.refs {
+		if ref.Pos.File != filename {
+			refs = append(refs, ref);
+			continue;
+		}
+		if ref.Symbol.Kind == Native {
+			native_refs := make([]*Reference, 0, len(ref.Symbol.Refs));
+			for _, other := range ref.Symbol.Refs {
+				if other.Pos.File != filename {
+					native_refs = append(native_refs, other);
+				}
+			}
+			ref.Symbol.Refs = native_refs;
+		}
+	}
+	idx.refs = refs;
+	children := make([]*Scope, 0, len(idx.natives.Children));
+	for _, child := range idx.natives.Children {
+		if child.Start.File != filename {
+			children = append(children, child);
+		}
+	}
+	idx.natives.Children = children;
+	delete(idx.files, filename);
+}
+
+// GlobalScope returns the top level scope of filename, nil if it is not indexed
+func (idx *Index) GlobalScope(filename string) *Scope {
+	return idx.files[filename];
+}
+
+// Symbols returns every definition in the indexed files
+func (idx *Index) Symbols() []*Symbol {
+	return idx.symbols;
+}
+
+// References returns every reference that could be bound to a definition
+func (idx *Index) References() []*Reference {
+	return idx.refs;
+}
+
+// FindDefinition returns the symbol defined or referenced at pos, nil if there is none
+func (idx *Index) FindDefinition(pos Pos) *Symbol {
+	for _, sym := range idx.symbols {
+		if covers(sym.Pos, sym.Name, pos) {
+			return sym;
+		}
+	}
+	for _, ref := range idx.refs {
+		if covers(ref.Pos, ref.Symbol.Name, pos) {
+			return ref.Symbol;
+		}
+	}
+	return nil;
+}
+
+// FindReferences returns every use of sym, in source order
+func (idx *Index) FindReferences(sym *Symbol) []*Reference {
+	return sym.Refs;
+}
+
+// SymbolsInScope returns the symbols visible at pos, innermost first.
+// locals are visible once declared while globals are looked up when used,
+// so they are all visible. shadowed symbols are left out.
+func (idx *Index) SymbolsInScope(pos Pos) []*Symbol {
+	global, ok := idx.files[pos.File];
+	if !ok {
+		return nil;
+	}
+	visible := make([]*Symbol, 0);
+	seen := make(map[string]bool);
+	for sc := global.innermost(pos); sc != nil; sc = sc.Parent {
+		for i := len(sc.Symbols) - 1; i >= 0; i-- {
+			sym := sc.Symbols[i];
+			if seen[sym.Name] || (sc.Kind != GlobalScope && sc.Kind != NativeScope && pos.Before(sym.Pos)) {
+				continue;
+			}
+			seen[sym.Name] = true;
+			visible = append(visible, sym);
+		}
+	}
+	return visible;
+}